@@ -0,0 +1,83 @@
+package accounts
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/mreym/shopping/models"
+)
+
+const (
+	// VerificationLifetime is how long an email verification link works.
+	VerificationLifetime = 48 * time.Hour
+	// ResendInterval is the least time between two verification emails.
+	ResendInterval = time.Minute
+	// MaxSends verification emails may go out per SendWindow.
+	MaxSends   = 5
+	SendWindow = 24 * time.Hour
+
+	// ResetLifetime is how long a password reset link works.
+	ResetLifetime = 30 * time.Minute
+	// ResetInterval is the least time between two reset emails to a user.
+	ResetInterval = time.Minute
+	// ResetRequestsPerIP forgotten passwords may be reported from one address
+	// per FailureWindow before it has to wait LockoutDuration.
+	ResetRequestsPerIP = 10
+)
+
+var ErrEmailNotVerified = errors.New("please verify your email address first")
+
+// NewToken makes a random single-use token to email to a user, and the hash
+// of it to store. Only the hash is kept, so someone reading the database
+// can't use the links that were sent.
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// ResendWait is how long the user must wait before another verification email
+// may be sent to them, or 0 when one may go now.
+func ResendWait(v *models.EmailVerification, now time.Time) time.Duration {
+	if v == nil {
+		return 0
+	}
+	if wait := v.Sent_At.Add(ResendInterval).Sub(now); wait > 0 {
+		return wait
+	}
+	if v.Sends >= MaxSends {
+		if wait := v.Window_Start.Add(SendWindow).Sub(now); wait > 0 {
+			return wait
+		}
+	}
+	return 0
+}
+
+// NextVerification is the verification to store for an email with a new
+// token sent at now, counting it against the send limit.
+func NextVerification(prev *models.EmailVerification, hash string, now time.Time) models.EmailVerification {
+	v := models.EmailVerification{
+		Token_Hash:   hash,
+		Expires_At:   now.Add(VerificationLifetime),
+		Sent_At:      now,
+		Sends:        1,
+		Window_Start: now,
+	}
+	if prev != nil && now.Sub(prev.Window_Start) < SendWindow {
+		v.Sends = prev.Sends + 1
+		v.Window_Start = prev.Window_Start
+	}
+	return v
+}
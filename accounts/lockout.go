@@ -0,0 +1,101 @@
+package accounts
+
+import (
+	"strings"
+	"time"
+
+	"github.com/mreym/shopping/models"
+)
+
+const (
+	// FailureWindow is how long a failed sign-in counts against an account or
+	// address; after that much quiet the count starts again.
+	FailureWindow = 15 * time.Minute
+	// FreeFailures may happen before sign-ins to the account are slowed down.
+	FreeFailures = 3
+	// MaxDelay caps the wait between attempts that grows with each failure.
+	MaxDelay = 30 * time.Second
+	// AccountLockout failures lock the account, and IPLockout failures lock
+	// the address, for LockoutDuration.
+	AccountLockout  = 10
+	IPLockout       = 50
+	LockoutDuration = 15 * time.Minute
+)
+
+// AccountKey and IPKey are the keys failed sign-ins are counted under.
+func AccountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func IPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// ResetIPKey counts the password reset requests from an address.
+func ResetIPKey(ip string) string {
+	return "reset-ip:" + ip
+}
+
+// Delay is how long to wait after the last failure before trying again, once
+// an account has failed this many times: a second, doubling with each
+// failure up to MaxDelay.
+func Delay(failures int) time.Duration {
+	if failures < FreeFailures {
+		return 0
+	}
+	delay := time.Second
+	for i := FreeFailures; i < failures && delay < MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > MaxDelay {
+		delay = MaxDelay
+	}
+	return delay
+}
+
+// AccountWait is how long sign-ins to an account are refused for, or 0 when
+// one may be tried now.
+func AccountWait(t *models.LoginThrottle, now time.Time) time.Duration {
+	if wait := lockWait(t, now); wait > 0 || t == nil {
+		return wait
+	}
+	if now.Sub(t.Last_Failure) >= FailureWindow {
+		return 0
+	}
+	if wait := t.Last_Failure.Add(Delay(t.Failures)).Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// IPWait is how long sign-ins from an address are refused for. Addresses are
+// only locked, not slowed, as many customers may share one.
+func IPWait(t *models.LoginThrottle, now time.Time) time.Duration {
+	return lockWait(t, now)
+}
+
+func lockWait(t *models.LoginThrottle, now time.Time) time.Duration {
+	if t == nil || t.Locked_Until == nil {
+		return 0
+	}
+	if wait := t.Locked_Until.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// NextFailure is t, the count under key, after one more failed sign-in at
+// now. The count starts again when the last failure is older than
+// FailureWindow, and the key is locked once it reaches threshold failures.
+func NextFailure(t *models.LoginThrottle, key string, threshold int, now time.Time) models.LoginThrottle {
+	next := models.LoginThrottle{Key: key, Failures: 1, Last_Failure: now}
+	if t != nil && now.Sub(t.Last_Failure) < FailureWindow {
+		next.Failures = t.Failures + 1
+		next.Locked_Until = t.Locked_Until
+	}
+	if next.Failures >= threshold && lockWait(&next, now) == 0 {
+		lockedUntil := now.Add(LockoutDuration)
+		next.Locked_Until = &lockedUntil
+	}
+	return next
+}
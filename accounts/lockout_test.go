@@ -0,0 +1,84 @@
+package accounts
+
+import (
+	"testing"
+	"time"
+
+	"github.com/mreym/shopping/models"
+)
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		failures int
+		want     time.Duration
+	}{
+		{0, 0},
+		{FreeFailures - 1, 0},
+		{FreeFailures, time.Second},
+		{FreeFailures + 1, 2 * time.Second},
+		{FreeFailures + 2, 4 * time.Second},
+		{FreeFailures + 4, 16 * time.Second},
+		{FreeFailures + 5, MaxDelay},
+		{1000, MaxDelay},
+	}
+	for _, tt := range tests {
+		if got := Delay(tt.failures); got != tt.want {
+			t.Errorf("Delay(%d) = %v, want %v", tt.failures, got, tt.want)
+		}
+	}
+}
+
+func TestNextFailure(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	at := func(d time.Duration) *time.Time {
+		t := now.Add(d)
+		return &t
+	}
+	tests := []struct {
+		name     string
+		prev     *models.LoginThrottle
+		failures int
+		locked   *time.Time
+	}{
+		{"first failure", nil, 1, nil},
+		{"counts up within the window", &models.LoginThrottle{Failures: 2, Last_Failure: now.Add(-time.Minute)}, 3, nil},
+		{"starts again after the window", &models.LoginThrottle{Failures: 9, Last_Failure: now.Add(-FailureWindow)}, 1, nil},
+		{"locks at the threshold", &models.LoginThrottle{Failures: AccountLockout - 1, Last_Failure: now.Add(-time.Minute)}, AccountLockout, at(LockoutDuration)},
+		{"a lock isn't extended", &models.LoginThrottle{Failures: AccountLockout, Last_Failure: now.Add(-time.Minute), Locked_Until: at(time.Minute)}, AccountLockout + 1, at(time.Minute)},
+		{"locks again once a lock ran out", &models.LoginThrottle{Failures: AccountLockout, Last_Failure: now.Add(-time.Minute), Locked_Until: at(-time.Second)}, AccountLockout + 1, at(LockoutDuration)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NextFailure(tt.prev, "account:a@example.com", AccountLockout, now)
+			lockedOK := (got.Locked_Until == nil && tt.locked == nil) ||
+				(got.Locked_Until != nil && tt.locked != nil && got.Locked_Until.Equal(*tt.locked))
+			if got.Failures != tt.failures || !lockedOK || !got.Last_Failure.Equal(now) || got.Key != "account:a@example.com" {
+				t.Errorf("NextFailure() = %d failures locked until %v, want %d locked until %v", got.Failures, got.Locked_Until, tt.failures, tt.locked)
+			}
+		})
+	}
+}
+
+func TestAccountWait(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	lockedUntil := now.Add(10 * time.Minute)
+	tests := []struct {
+		name     string
+		throttle *models.LoginThrottle
+		want     time.Duration
+	}{
+		{"never failed", nil, 0},
+		{"free failures", &models.LoginThrottle{Failures: FreeFailures - 1, Last_Failure: now}, 0},
+		{"slowed down", &models.LoginThrottle{Failures: FreeFailures + 1, Last_Failure: now.Add(-500 * time.Millisecond)}, 1500 * time.Millisecond},
+		{"delay passed", &models.LoginThrottle{Failures: FreeFailures + 1, Last_Failure: now.Add(-3 * time.Second)}, 0},
+		{"window passed", &models.LoginThrottle{Failures: FreeFailures + 9, Last_Failure: now.Add(-FailureWindow)}, 0},
+		{"locked", &models.LoginThrottle{Failures: AccountLockout, Last_Failure: now, Locked_Until: &lockedUntil}, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AccountWait(tt.throttle, now); got != tt.want {
+				t.Errorf("AccountWait() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+// Package cartmerge combines a guest cart with the cart of the user who just
+// signed in. A cart holds one line per unit, so the quantity of a product is
+// the number of lines for it.
+package cartmerge
+
+import (
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+// Rules for a product that is in both carts.
+const (
+	// Sum keeps the lines from both carts.
+	Sum = "sum"
+	// Max keeps whichever cart has more of the product.
+	Max = "max"
+	// KeepUser keeps the signed in user's lines and drops the guest's.
+	KeepUser = "keep_user"
+	// KeepGuest replaces the user's lines with the guest's.
+	KeepGuest = "keep_guest"
+)
+
+// DefaultRule avoids doubling a product that was added on both devices.
+const DefaultRule = Max
+
+var ErrUnknownRule = errors.New("unknown cart merge rule")
+
+func Check(rule string) error {
+	switch rule {
+	case Sum, Max, KeepUser, KeepGuest:
+		return nil
+	}
+	return ErrUnknownRule
+}
+
+func group(lines []models.ProductUser) (map[primitive.ObjectID][]models.ProductUser, []primitive.ObjectID) {
+	byProduct := make(map[primitive.ObjectID][]models.ProductUser)
+	var order []primitive.ObjectID
+	for _, line := range lines {
+		if _, seen := byProduct[line.Product_ID]; !seen {
+			order = append(order, line.Product_ID)
+		}
+		byProduct[line.Product_ID] = append(byProduct[line.Product_ID], line)
+	}
+	return byProduct, order
+}
+
+// Merge returns the user's cart with the guest lines merged in. Products keep
+// the order of the user's cart, and products only the guest had follow it.
+func Merge(user, guest []models.ProductUser, rule string) ([]models.ProductUser, error) {
+	if err := Check(rule); err != nil {
+		return nil, err
+	}
+	userLines, userOrder := group(user)
+	guestLines, guestOrder := group(guest)
+
+	merged := make([]models.ProductUser, 0, len(user)+len(guest))
+	for _, id := range userOrder {
+		mine, theirs := userLines[id], guestLines[id]
+		switch {
+		case len(theirs) == 0 || rule == KeepUser:
+			merged = append(merged, mine...)
+		case rule == Sum:
+			merged = append(append(merged, mine...), theirs...)
+		case rule == KeepGuest:
+			merged = append(merged, theirs...)
+		case rule == Max && len(theirs) > len(mine):
+			merged = append(merged, theirs...)
+		default:
+			merged = append(merged, mine...)
+		}
+	}
+	for _, id := range guestOrder {
+		if _, both := userLines[id]; !both {
+			merged = append(merged, guestLines[id]...)
+		}
+	}
+	return merged, nil
+}
@@ -0,0 +1,31 @@
+// Command webhook-receiver runs a local endpoint that webhooks can be
+// pointed at while developing. It verifies signatures and logs what arrives.
+//
+// Register http://localhost:9090/ as a webhook with POST /admin/webhooks.
+// The shop generates the signing secret and returns it, only once, in the
+// response. Then start the receiver with it:
+//
+//	go run ./cmd/webhook-receiver -secret whsec_... -fail 2
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/mreym/shopping/webhooks"
+)
+
+func main() {
+	addr := flag.String("addr", ":9090", "address to listen on")
+	secret := flag.String("secret", os.Getenv("WEBHOOK_SECRET"), "the webhook's signing secret (default $WEBHOOK_SECRET)")
+	fail := flag.Int("fail", 0, "answer 500 to the first n attempts of each delivery")
+	flag.Parse()
+
+	if *secret == "" {
+		log.Fatal("a signing secret is needed, pass -secret or set WEBHOOK_SECRET")
+	}
+	log.Printf("listening for webhooks on %s", *addr)
+	log.Fatal(http.ListenAndServe(*addr, &webhooks.Receiver{Secret: *secret, FailFirst: *fail}))
+}
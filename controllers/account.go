@@ -0,0 +1,276 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/accounts"
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/notify"
+)
+
+// AppURL is where the shop is reached from outside, for links in emails,
+// from APP_URL.
+var AppURL = appURL()
+
+// RequireEmailVerification refuses checkouts from users who haven't verified
+// their email address, when REQUIRE_EMAIL_VERIFICATION is true.
+var RequireEmailVerification = os.Getenv("REQUIRE_EMAIL_VERIFICATION") == "true"
+
+func appURL() string {
+	if u := os.Getenv("APP_URL"); u != "" {
+		return strings.TrimSuffix(u, "/")
+	}
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+	return "http://localhost:" + port
+}
+
+// tooManyRequests refuses a request that may be tried again after wait.
+func tooManyRequests(c *gin.Context, wait time.Duration, msg string) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": msg, "retry_after": seconds})
+}
+
+// sendVerification emails the user a new verification link. Earlier links
+// stop working.
+func sendVerification(ctx context.Context, user models.Users) error {
+	token, hash, err := accounts.NewToken()
+	if err != nil {
+		return err
+	}
+	if err = database.SetVerification(ctx, UserCollection, user.ID, accounts.NextVerification(user.Verification, hash, time.Now())); err != nil {
+		return err
+	}
+	return deliverEmail(ctx, user, notify.EmailVerify, notify.VerifyEmail{
+		Shop:  ShopName,
+		Name:  firstName(user),
+		Link:  AppURL + "/users/verify?token=" + url.QueryEscape(token),
+		Hours: int(accounts.VerificationLifetime / time.Hour),
+	})
+}
+
+func notifyVerification(ctx context.Context, event events.UserSignedUp) error {
+	user, err := findUser(ctx, event.User_ID)
+	if err != nil {
+		return err
+	}
+	if user.Email_Verified {
+		return nil
+	}
+	err = sendVerification(ctx, user)
+	if err == database.ErrAlreadyVerified {
+		return nil
+	}
+	return err
+}
+
+// VerifyEmail follows the link from the verification email.
+func VerifyEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrInvalidVerification.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		_, err := database.VerifyEmail(ctx, UserCollection, accounts.HashToken(token), time.Now())
+		if err == database.ErrInvalidVerification {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Email address verified"})
+	}
+}
+
+// ResendVerification sends the signed in user a new verification link. Users
+// may ask once a minute and a few times a day.
+func ResendVerification() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+
+		user, err := findUser(ctx, c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		if user.Email_Verified {
+			c.JSON(http.StatusConflict, gin.H{"error": database.ErrAlreadyVerified.Error()})
+			return
+		}
+		if wait := accounts.ResendWait(user.Verification, time.Now()); wait > 0 {
+			tooManyRequests(c, wait, "a verification email was sent recently, try again later")
+			return
+		}
+		err = sendVerification(ctx, user)
+		if err == database.ErrAlreadyVerified {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Verification email sent"})
+	}
+}
+
+// requestPasswordReset emails a reset link to the account using email, if
+// there is one and it wasn't sent one a moment ago.
+func requestPasswordReset(email string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var user models.Users
+	err := UserCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user)
+	if err != nil {
+		if err != mongo.ErrNoDocuments {
+			log.Println(err)
+		}
+		return
+	}
+	now := time.Now()
+	token, hash, err := accounts.NewToken()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	reset := models.PasswordReset{Token_Hash: hash, Expires_At: now.Add(accounts.ResetLifetime), Requested_At: now}
+	if err = database.SetPasswordReset(ctx, UserCollection, user.ID, reset); err != nil {
+		if err != database.ErrResetTooSoon {
+			log.Println(err)
+		}
+		return
+	}
+	err = deliverEmail(ctx, user, notify.EmailPasswordReset, notify.PasswordReset{
+		Shop:    ShopName,
+		Name:    firstName(user),
+		Link:    AppURL + "/users/password/reset?token=" + url.QueryEscape(token),
+		Minutes: int(accounts.ResetLifetime / time.Minute),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// resetSlots bounds how many password reset emails are being looked up and
+// sent at once.
+var resetSlots = make(chan struct{}, 8)
+
+// ForgotPassword emails a password reset link. It answers the same whether
+// or not an account uses the address, and looks it up after answering so the
+// response time doesn't tell either. Each address may only ask a few times
+// in a while.
+func ForgotPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Email string `json:"email"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := Validate.Var(body.Email, "required,email"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "a valid email address is required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		wait, err := database.ReserveLoginAttempt(ctx, LoginThrottleCollection, accounts.ResetIPKey(c.ClientIP()), accounts.ResetRequestsPerIP, accounts.IPWait, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if wait > 0 {
+			tooManyRequests(c, wait, "too many password reset requests, try again later")
+			return
+		}
+		select {
+		case resetSlots <- struct{}{}:
+			go func() {
+				defer func() { <-resetSlots }()
+				requestPasswordReset(body.Email)
+			}()
+		default:
+			log.Println("too many password resets in progress, dropping one")
+		}
+		c.JSON(http.StatusAccepted, gin.H{"message": "If an account uses this address, a link to reset the password is on its way"})
+	}
+}
+
+// ResetPassword sets a new password with the token from the reset email,
+// given in the body or as ?token=. Every session of the user is signed out
+// and any sign-in lockout is lifted.
+func ResetPassword() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if body.Token == "" {
+			body.Token = c.Query("token")
+		}
+		if body.Token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrInvalidReset.Error()})
+			return
+		}
+		if err := Validate.Var(body.Password, "required,min=6"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "the password must be at least 6 characters"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		// check the token before the costly hash, so junk tokens cost nothing
+		tokenHash := accounts.HashToken(body.Token)
+		if _, err := database.FindPasswordReset(ctx, UserCollection, tokenHash, time.Now()); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrInvalidReset.Error()})
+			return
+		}
+		user, err := database.ResetPassword(ctx, UserCollection, tokenHash, HashPassword(body.Password), time.Now())
+		if err == database.ErrInvalidReset {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		// whoever reset the password owns the account, so let them back in
+		if user.Email != nil {
+			clearAccountLockout(ctx, *user.Email)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Password changed, please sign in again"})
+	}
+}
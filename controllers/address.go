@@ -2,219 +2,203 @@ package controllers
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 
+	"github.com/mreym/shopping/database"
 	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/postal"
 )
 
-func AddAddress() gin.HandlerFunc {
-	return func(c *gin.Context) {
-		user_id := c.Query("id")
-		if user_id == "" {
-			c.Header("Content-Type", "application/json")
-			c.JSON(http.StatusNotFound, gin.H{"error": "invalid code"})
-			c.Abort()
-			return
-		}
-		address, err := primitive.ObjectIDFromHex(user_id)
-		if err != nil {
-			c.IndentedJSON(500, "Internal server error")
-		}
-
-		var addresses models.Address
+const maxLabelLength = 30
 
-		addresses.Address_ID = primitive.NewObjectID()
-
-		if err = c.BindJSON(&addresses); err != nil {
-			c.IndentedJSON(http.StatusNotAcceptable, err.Error())
-		}
+// AddressValidator checks addresses after they are normalized. main adds the
+// offline postal code dataset to it when one is configured.
+var AddressValidator postal.Validator = postal.Chain{postal.FormatValidator{}}
 
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+// checkAddress normalizes an address and runs it through AddressValidator.
+func checkAddress(address models.Address) (models.Address, error) {
+	address = postal.Normalize(address)
+	return address, AddressValidator.Validate(address)
+}
 
-		match_filter := bson.D{{Key: "$match", Value: bson.D{primitive.E{Key: "_id", Value: address}}}}
-		unwind := bson.D{{Key: "$unwind", Value: bson.D{primitive.E{Key: "path", Value: "$address"}}}}
-		group := bson.D{{Key: "$group", Value: bson.D{primitive.E{Key: "_id", Value: "addres_id"}, {Key: "count", Value: bson.D{primitive.E{Key: "$sum", Value: 1}}}}}}
-		pointcursor, err := UserCollection.Aggregate(ctx, mongo.Pipeline{match_filter, unwind, group})
-		if err != nil {
-			c.IndentedJSON(500, "internal server error")
-		}
+func addressError(c *gin.Context, err error) {
+	var invalid postal.ValidationError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "fields": invalid})
+		return
+	}
+	c.JSON(addressStatus(err), gin.H{"error": err.Error()})
+}
 
-		var addressinfo []bson.M
-		if err = pointcursor.All(ctx, &addressinfo); err != nil {
-			panic(err)
-		}
+// normalizeLabel lower-cases the label and falls back to home when empty.
+func normalizeLabel(label string) (string, bool) {
+	label = strings.ToLower(strings.TrimSpace(label))
+	if label == "" {
+		return models.AddressHome, true
+	}
+	return label, len(label) <= maxLabelLength
+}
 
-		var size int32
-		for _, address_no := range addressinfo {
-			count := address_no["count"]
-			size = count.(int32)
-		}
-		if size < 2 {
-			filter := bson.D{primitive.E{Key: "_id", Value: address}}
-			update := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "address", Value: addresses}}}}
-			_, err := UserCollection.UpdateOne(ctx, filter, update)
-			if err != nil {
-				fmt.Println(err)
-			}
+func bindAddress(c *gin.Context) (models.Address, bool) {
+	var address models.Address
+	if err := c.BindJSON(&address); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return address, false
+	}
+	label, ok := normalizeLabel(address.Label)
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "label is too long"})
+		return address, false
+	}
+	address.Label = label
 
-		} else {
-			c.IndentedJSON(400, "Not Allowed")
-		}
-		defer cancel()
-		ctx.Done()
+	address, err := checkAddress(address)
+	if err != nil {
+		addressError(c, err)
+		return address, false
 	}
+	return address, true
+}
 
+func addressStatus(err error) int {
+	switch err {
+	case database.ErrAddressNotFound:
+		return http.StatusNotFound
+	case database.ErrTooManyAddresses, database.ErrInvalidDefaultKind, database.ErrUserIdIsNotValid:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
 }
 
-func EditHomeAddress(UserCollection *mongo.Collection) gin.HandlerFunc {
+func ListAddresses() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		user_id := c.Query("id")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
 
-		if user_id == "" {
-			c.Header("Content-Type", "application/type")
-			c.JSON(http.StatusNotFound, gin.H{"Error": "Invalid"})
-			c.Abort()
-			return
-		}
-		userID, err := primitive.ObjectIDFromHex(user_id)
+		addresses, err := database.ListAddresses(ctx, UserCollection, c.GetString("uid"))
 		if err != nil {
-			c.IndentedJSON(500, "internal server error")
+			c.JSON(addressStatus(err), gin.H{"error": err.Error()})
+			return
 		}
-		var editaddress models.Address
-		if err := c.BindJSON(&editaddress); err != nil {
-			c.IndentedJSON(http.StatusBadRequest, err.Error())
+		c.JSON(http.StatusOK, addresses)
+	}
+}
+
+func AddAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		address, ok := bindAddress(c)
+		if !ok {
+			return
 		}
-		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
-		filter := bson.D{primitive.E{Key: "_id", Value: userID}}
-		update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "address.0.house_name", Value: editaddress.House},
-			{Key: "address.0.street_name", Value: editaddress.Street},
-			{Key: "address.0.city_name", Value: editaddress.City},
-			{Key: "address.0.pin_code", Value: editaddress.Pincode}}}}
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
+
+		address, err := database.AddAddress(ctx, UserCollection, c.GetString("uid"), address)
 		if err != nil {
-			c.IndentedJSON(500, "Something Went Wrong")
+			c.JSON(addressStatus(err), gin.H{"error": err.Error()})
 			return
 		}
-		defer cancel()
-		ctx.Done()
-		c.IndentedJSON(200, "Successfully update the home address")
-
+		c.JSON(http.StatusCreated, address)
 	}
 }
 
-func EditWorkAddress(UserCollection *mongo.Collection) gin.HandlerFunc {
+func EditAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.Query("id")
-		if userID == "" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid"})
-			return
-		}
-		userObjectID, err := primitive.ObjectIDFromHex(userID)
+		addressID, err := primitive.ObjectIDFromHex(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address id"})
 			return
 		}
-
-		var editAddress models.Address
-		if err := c.BindJSON(&editAddress); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		address, ok := bindAddress(c)
+		if !ok {
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		filter := bson.D{primitive.E{Key: "_id", Value: userObjectID}}
-		update := bson.D{
-			{Key: "$set", Value: bson.D{
-				{Key: "address.1.house_name", Value: editAddress.House},
-				{Key: "address.1.street_name", Value: editAddress.Street},
-				{Key: "address.1.city_name", Value: editAddress.City},
-				{Key: "address.1.pin_code", Value: editAddress.Pincode},
-			}},
+		err = database.UpdateAddress(ctx, UserCollection, c.GetString("uid"), addressID, address)
+		if err != nil {
+			c.JSON(addressStatus(err), gin.H{"error": err.Error()})
+			return
 		}
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully updated the address"})
+	}
+}
 
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
+func DeleteAddress() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		addressID, err := primitive.ObjectIDFromHex(c.Param("id"))
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Something Went Wrong"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address id"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Successfully updated the work address"})
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = database.DeleteAddress(ctx, UserCollection, c.GetString("uid"), addressID)
+		if err != nil {
+			c.JSON(addressStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully Deleted"})
 	}
 }
 
-// func EditWorkAddress() gin.HandlerFunc {
-
-// 	return func(c *gin.Context) {
-// 		user_id := c.Query("id")
-// 		if user_id == "" {
-// 			c.Header("Content-Type", "application/type")
-// 			c.JSON(http.StatusNotFound, gin.H{"Error": "Invalid"})
-// 			c.Abort()
-// 			return
-// 		}
-// 		user_id, err := primitive.ObjectIDFromHex(user_id)
-// 		if err != nil {
-// 			c.IndentedJSON(500, "internal server error")
-// 		}
-// 		var editaddress models.Address
-// 		if err := c.BindJSON(&editaddress); err != nil {
-// 			c.IndentedJSON(http.StatusBadRequest, err.Error())
-// 		}
-// 		var ctx, cancel = context.WithTimeout(context.Background(), 100*time.Second)
-// 		defer cancel()
-// 		filter := bson.D{primitive.E{Key: "_id", Value: user_id}}
-// 		update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "address.1.house_name", Value: editaddress.House},
-// 			{Key: "adress.1.street_name", Value: editaddress.Street},
-// 			{Key: "adress.1.city_name", Value: editaddress.City},
-// 			{Key: "address.1.pin_code", Value: editaddress.Pincode}}}}
-// 		_, err = UserCollection.UpdateOne(ctx, filter, update)
-// 		if err != nil {
-// 			c.IndentedJSON(500, "Something Wrong")
-// 			return
-// 		}
-// 		defer cancel()
-// 		ctx.Done()
-// 		c.IndentedJSON(200, "Successfully updated the work address")
-// 	}
-
-// }
-
-func DeleteAddress(UserCollection *mongo.Collection) gin.HandlerFunc {
+// SetDefaultAddress makes an address the default for ?type=shipping, billing
+// or both (the default).
+func SetDefaultAddress() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.Query("id")
-		if userID == "" {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid Search Index"})
+		addressID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address id"})
 			return
 		}
 
-		userObjectID, err := primitive.ObjectIDFromHex(userID)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Internal server error"})
+		var kinds []string
+		switch c.DefaultQuery("type", "both") {
+		case "shipping":
+			kinds = []string{database.DefaultShipping}
+		case "billing":
+			kinds = []string{database.DefaultBilling}
+		case "both":
+			kinds = []string{database.DefaultShipping, database.DefaultBilling}
+		default:
+			c.JSON(http.StatusBadRequest, gin.H{"error": database.ErrInvalidDefaultKind.Error()})
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 		defer cancel()
 
-		filter := bson.D{primitive.E{Key: "_id", Value: userObjectID}}
-		update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "address", Value: []models.Address{}}}}}
-
-		_, err = UserCollection.UpdateOne(ctx, filter, update)
-		if err != nil {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Wrong Command"})
-			return
+		for _, kind := range kinds {
+			if err = database.SetDefaultAddress(ctx, UserCollection, c.GetString("uid"), addressID, kind); err != nil {
+				c.JSON(addressStatus(err), gin.H{"error": err.Error()})
+				return
+			}
 		}
+		c.JSON(http.StatusOK, gin.H{"message": "Default address updated"})
+	}
+}
 
-		c.JSON(http.StatusOK, gin.H{"message": "Successfully Deleted"})
+// defaultAddress returns the user's default address of kind, falling back to
+// the first address in the book.
+func defaultAddress(user *models.Users, kind string) *models.Address {
+	for i, address := range user.Address_Details {
+		if (kind == database.DefaultShipping && address.Default_Shipping) || (kind == database.DefaultBilling && address.Default_Billing) {
+			return &user.Address_Details[i]
+		}
+	}
+	if len(user.Address_Details) == 0 {
+		return nil
 	}
+	return &user.Address_Details[0]
 }
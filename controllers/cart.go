@@ -15,7 +15,6 @@ import (
 
 	"github.com/mreym/shopping/database"
 	"github.com/mreym/shopping/models"
-
 )
 
 type Application struct {
@@ -33,7 +32,7 @@ func NewApplication(prodCollection, userCollection *mongo.Collection) *Applicati
 func (app *Application) AddToCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		productQueryID := c.Query("id")
-		userQueryID := c.Query("userID")
+		userQueryID := c.GetString("uid")
 
 		if productQueryID == "" || userQueryID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
@@ -62,7 +61,7 @@ func (app *Application) AddToCart() gin.HandlerFunc {
 func (app *Application) RemoveItem() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		productQueryID := c.Query("id")
-		userQueryID := c.Query("userID")
+		userQueryID := c.GetString("uid")
 
 		if productQueryID == "" || userQueryID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
@@ -90,7 +89,7 @@ func (app *Application) RemoveItem() gin.HandlerFunc {
 
 func (app *Application) GetItemFromCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userID := c.Query("id")
+		userID := c.GetString("uid")
 		if userID == "" {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Invalid id"})
 			return
@@ -112,34 +111,33 @@ func (app *Application) GetItemFromCart() gin.HandlerFunc {
 			return
 		}
 
-		filterMatch := bson.D{{Key: "$match", Value: bson.D{primitive.E{Key: "_id", Value: userObjectID}}}}
-		unwind := bson.D{{Key: "$unwind", Value: "$usercart"}}
-		grouping := bson.D{{Key: "$group", Value: bson.D{primitive.E{Key: "_id", Value: "$_id"}, {Key: "total", Value: bson.D{primitive.E{Key: "$sum", Value: "$user_id"}}}}}}
-
-		pointCursor, err := app.userCollection.Aggregate(ctx, mongo.Pipeline{filterMatch, unwind, grouping})
+		// the cart is shown at today's prices, with what changed since the
+		// products were added
+		lines, changes, err := database.RepriceCart(ctx, app.prodCollection, filledCart.UserCart)
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 			return
 		}
 
-		var listing []bson.M
-		if err = pointCursor.All(ctx, &listing); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		quote, err := quoteCart(ctx, &filledCart, lines, shippingAddress(&filledCart), c.Query("shipping"), true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
 
-		var totalItems int
-		for _, json := range listing {
-			totalItems = json["total"].(int)
+		displayTotal, err := convertCart(ctx, displayCurrency(c, &filledCart), lines, quote.Total)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"totalItems": totalItems, "cartItems": filledCart.UserCart})
+		c.JSON(http.StatusOK, gin.H{"totalItems": len(lines), "total": quote.Total, "displayTotal": displayTotal, "appliedCoupon": filledCart.Applied_Coupon, "pricing": quote, "priceChanges": changes, "cartItems": lines})
 	}
 }
 
 func (app *Application) BuyFromCart() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		userQueryID := c.Query("id")
+		userQueryID := c.GetString("uid")
 		if userQueryID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "User ID is empty"})
 			return
@@ -148,9 +146,15 @@ func (app *Application) BuyFromCart() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Second)
 		defer cancel()
 
-		err := database.BuyItemFromCart(ctx, app.userCollection, userQueryID)
+		co, err := newCheckout(c, true)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = database.BuyItemFromCart(ctx, app.prodCollection, app.userCollection, OutboxCollection, userQueryID, co.price)
+		if err != nil {
+			co.rollback(ctx)
+			co.fail(err)
 			return
 		}
 
@@ -161,7 +165,7 @@ func (app *Application) BuyFromCart() gin.HandlerFunc {
 func (app *Application) InstantBuy() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		productQueryID := c.Query("id")
-		userQueryID := c.Query("userID")
+		userQueryID := c.GetString("uid")
 
 		if productQueryID == "" || userQueryID == "" {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
@@ -177,9 +181,15 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
 
-		err = database.InstantBuyer(ctx, app.prodCollection, app.userCollection, productID, userQueryID)
+		co, err := newCheckout(c, false)
 		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		err = database.InstantBuyer(ctx, app.prodCollection, app.userCollection, OutboxCollection, productID, userQueryID, co.price)
+		if err != nil {
+			co.rollback(ctx)
+			c.JSON(checkoutStatus(err), gin.H{"error": err.Error()})
 			return
 		}
 
@@ -187,4 +197,31 @@ func (app *Application) InstantBuy() gin.HandlerFunc {
 	}
 }
 
+// AcceptCartPrices is the customer's acknowledgement of the price changes
+// shown on the cart, sent back as the priceChanges the cart listed. Checkout
+// is refused until they have accepted them.
+func (app *Application) AcceptCartPrices() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Changes []models.CartChange `json:"changes"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		lines, changes, err := database.AcceptCartPrices(ctx, app.prodCollection, app.userCollection, c.GetString("uid"), body.Changes)
+		if err == database.ErrPricesNotShown {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"accepted": changes, "cartItems": lines})
+	}
+}
@@ -0,0 +1,319 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/accounts"
+	"github.com/mreym/shopping/coupons"
+	"github.com/mreym/shopping/currency"
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/postal"
+	"github.com/mreym/shopping/promotions"
+	"github.com/mreym/shopping/shipping"
+	"github.com/mreym/shopping/tax"
+)
+
+var ErrNoShippingAddress = errors.New("a shipping address is required")
+
+// checkoutStatus tells apart checkouts refused because of what the customer
+// asked for from ones that failed on our side.
+func checkoutStatus(err error) int {
+	var invalid postal.ValidationError
+	if errors.As(err, &invalid) {
+		return http.StatusBadRequest
+	}
+	switch err {
+	case accounts.ErrEmailNotVerified:
+		return http.StatusForbidden
+	case database.ErrCartPricesChanged, database.ErrCartChanged, database.ErrOutOfStock:
+		return http.StatusConflict
+	case ErrNoShippingAddress, database.ErrAddressNotFound, database.ErrCartIsEmpty,
+		database.ErrCouponNotFound, database.ErrCouponLimitReached, database.ErrCantFindProduct,
+		coupons.ErrNotStarted, coupons.ErrExpired, coupons.ErrUsedUp, coupons.ErrBelowMinimum,
+		coupons.ErrNoEligibleItems, shipping.ErrMethodUnavailable, shipping.ErrUnserviceable, currency.ErrUnknownCurrency:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// cartQuote is what a set of cart lines costs right now after promotions, the
+// applied coupon, tax and shipping to the address it ships to.
+type cartQuote struct {
+	Subtotal         models.Money              `json:"subtotal"`
+	Promotions       []models.AppliedPromotion `json:"promotions"`
+	Coupon           *models.Coupon            `json:"-"`
+	Coupon_Off       coupons.Result            `json:"coupon"`
+	Discount         models.Money              `json:"discount"`
+	Tax              models.Money              `json:"tax"`
+	Tax_Inclusive    bool                      `json:"tax_inclusive"`
+	Tax_Lines        []models.TaxLine          `json:"tax_lines"`
+	Shipping_Options []shipping.Option         `json:"shipping_options"`
+	Shipping_Method  string                    `json:"shipping_method"`
+	Shippable        bool                      `json:"shippable"`
+	Shipping         models.Money              `json:"shipping"`
+	Total            models.Money              `json:"total"`
+}
+
+// quoteCart prices lines for the user. The coupon is only considered when
+// withCoupon is set, and it can't take off more than promotions left. Tax is
+// worked out on the discounted lines and added unless prices include it.
+// Shipping uses method, or the default method when it is empty; a cart no
+// configured rate can ship is still quoted but not Shippable.
+func quoteCart(ctx context.Context, user *models.Users, lines []models.ProductUser, address *models.Address, method string, withCoupon bool) (*cartQuote, error) {
+	subtotal, err := database.CartTotal(lines)
+	if err != nil {
+		return nil, err
+	}
+	quote := &cartQuote{Subtotal: subtotal, Total: subtotal}
+
+	active, err := database.ActivePromotions(ctx, PromotionCollection)
+	if err != nil {
+		return nil, err
+	}
+	quote.Promotions, quote.Discount, err = promotions.Evaluate(active, lines, subtotal, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	quote.Coupon_Off = coupons.Result{Discount: models.ZeroMoney(subtotal.Currency)}
+	if withCoupon {
+		quote.Coupon, quote.Coupon_Off, err = cartCoupon(ctx, user, lines, subtotal)
+		if err != nil {
+			return nil, err
+		}
+		remaining, err := subtotal.Sub(quote.Discount)
+		if err != nil {
+			return nil, err
+		}
+		if quote.Coupon_Off.Discount, err = quote.Coupon_Off.Discount.Min(remaining); err != nil {
+			return nil, err
+		}
+		if quote.Discount, err = quote.Discount.Add(quote.Coupon_Off.Discount); err != nil {
+			return nil, err
+		}
+	}
+
+	if quote.Total, err = subtotal.Sub(quote.Discount); err != nil {
+		return nil, err
+	}
+
+	rates, err := database.ListTaxRates(ctx, TaxCollection)
+	if err != nil {
+		return nil, err
+	}
+	quote.Tax_Inclusive = PricesIncludeTax
+	quote.Tax_Lines, quote.Tax, err = tax.Calculate(lines, quote.Discount, rates, tax.RegionOf(address), PricesIncludeTax)
+	if err != nil {
+		return nil, err
+	}
+	if !PricesIncludeTax {
+		if quote.Total, err = quote.Total.Add(quote.Tax); err != nil {
+			return nil, err
+		}
+	}
+
+	options, configured, err := shippingOptions(ctx, lines, address, quote.Coupon_Off.Free_Shipping)
+	if err != nil {
+		return nil, err
+	}
+	quote.Shipping_Options = options
+	quote.Shipping = models.ZeroMoney(subtotal.Currency)
+	chosen, err := shipping.Choose(options, method, configured)
+	if err == shipping.ErrUnserviceable {
+		// still quoted, so the cart can be shown, but checkout refuses it
+		return quote, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	quote.Shippable = true
+	if chosen != nil {
+		quote.Shipping_Method = chosen.Method
+		quote.Shipping = chosen.Cost
+		if quote.Total, err = quote.Total.Add(chosen.Cost); err != nil {
+			return nil, err
+		}
+	}
+	return quote, nil
+}
+
+// checkoutRequest is the optional body of a checkout. Addresses can be picked
+// from the address book by id or given inline; anything left out falls back
+// to the user's default addresses.
+type checkoutRequest struct {
+	Shipping_Address_ID string          `json:"shipping_address_id"`
+	Billing_Address_ID  string          `json:"billing_address_id"`
+	Shipping_Address    *models.Address `json:"shipping_address"`
+	Billing_Address     *models.Address `json:"billing_address"`
+}
+
+// checkout prices an order being placed from a request and remembers what it
+// reserved along the way, so a failed order can hand it back.
+type checkout struct {
+	c        *gin.Context
+	fromCart bool
+	request  checkoutRequest
+	userID   string
+	redeemed *models.Coupon
+	changes  []models.CartChange
+}
+
+// newCheckout starts pricing an order. Only orders placed from the cart pick
+// up what was applied to the cart, such as a coupon. Address ids may also be
+// passed as query parameters.
+func newCheckout(c *gin.Context, fromCart bool) (*checkout, error) {
+	co := &checkout{c: c, fromCart: fromCart}
+	if c.Request.ContentLength > 0 {
+		if err := c.ShouldBindJSON(&co.request); err != nil {
+			return nil, err
+		}
+	}
+	if co.request.Shipping_Address_ID == "" {
+		co.request.Shipping_Address_ID = c.Query("shipping_address_id")
+	}
+	if co.request.Billing_Address_ID == "" {
+		co.request.Billing_Address_ID = c.Query("billing_address_id")
+	}
+	return co, nil
+}
+
+// pickAddress resolves one of the order's addresses: inline, then by id from
+// the address book, then the default of kind. The result is a copy so the
+// order keeps it as it was at checkout.
+func pickAddress(user *models.Users, inline *models.Address, addressID string, kind string) (*models.Address, error) {
+	if inline != nil {
+		snapshot, err := checkAddress(*inline)
+		if err != nil {
+			return nil, err
+		}
+		snapshot.Address_ID = primitive.NewObjectID()
+		snapshot.Default_Shipping, snapshot.Default_Billing = false, false
+		return &snapshot, nil
+	}
+
+	if addressID != "" {
+		id, err := primitive.ObjectIDFromHex(addressID)
+		if err != nil {
+			return nil, database.ErrAddressNotFound
+		}
+		for _, address := range user.Address_Details {
+			if address.Address_ID == id {
+				snapshot := address
+				return &snapshot, nil
+			}
+		}
+		return nil, database.ErrAddressNotFound
+	}
+
+	if address := defaultAddress(user, kind); address != nil {
+		snapshot := *address
+		return &snapshot, nil
+	}
+	return nil, nil
+}
+
+// addresses works out where the order ships and who it is billed to. Billing
+// falls back to the shipping address. Only pickup orders may have no address.
+func (co *checkout) addresses(user *models.Users) (*models.Address, *models.Address, error) {
+	shipTo, err := pickAddress(user, co.request.Shipping_Address, co.request.Shipping_Address_ID, database.DefaultShipping)
+	if err != nil {
+		return nil, nil, err
+	}
+	billTo, err := pickAddress(user, co.request.Billing_Address, co.request.Billing_Address_ID, database.DefaultBilling)
+	if err != nil {
+		return nil, nil, err
+	}
+	if billTo == nil {
+		billTo = shipTo
+	}
+	if shipTo == nil && co.c.Query("shipping") != models.ShippingPickup {
+		return nil, nil, ErrNoShippingAddress
+	}
+	return shipTo, billTo, nil
+}
+
+// price is the database.OrderPricer used for cart checkout and instant buys.
+// Cart lines are repriced from the catalog first, and the order is refused
+// while the customer hasn't accepted a change. The display currency is frozen
+// last so it converts the final total.
+func (co *checkout) price(ctx context.Context, user *models.Users, order *models.Order) error {
+	co.userID = user.ID.Hex()
+	if RequireEmailVerification && !user.Email_Verified {
+		return accounts.ErrEmailNotVerified
+	}
+
+	if co.fromCart {
+		lines, changes, err := database.RepriceCart(ctx, ProductCollection, order.Order_Cart)
+		if err != nil {
+			return err
+		}
+		if len(changes) > 0 {
+			co.changes = changes
+			return database.ErrCartPricesChanged
+		}
+		order.Order_Cart = lines
+	}
+
+	shipTo, billTo, err := co.addresses(user)
+	if err != nil {
+		return err
+	}
+	order.Shipping_Address = shipTo
+	order.Billing_Address = billTo
+
+	quote, err := quoteCart(ctx, user, order.Order_Cart, shipTo, co.c.Query("shipping"), co.fromCart)
+	if err != nil {
+		return err
+	}
+	if !quote.Shippable {
+		return shipping.ErrUnserviceable
+	}
+
+	if quote.Coupon != nil {
+		if err = database.RedeemCoupon(ctx, CouponCollection, *quote.Coupon, co.userID); err != nil {
+			return err
+		}
+		co.redeemed = quote.Coupon
+		order.Coupon_Code = &quote.Coupon.Code
+		order.Free_Shipping = quote.Coupon_Off.Free_Shipping
+	}
+
+	order.Promotions = quote.Promotions
+	order.Discount = &quote.Discount
+	order.Tax = quote.Tax
+	order.Tax_Inclusive = quote.Tax_Inclusive
+	order.Tax_Lines = quote.Tax_Lines
+	order.Shipping_Method = quote.Shipping_Method
+	order.Shipping = quote.Shipping
+	order.Price = quote.Total
+
+	return freezeDisplayPrice(ctx, order, displayCurrency(co.c, user))
+}
+
+// fail responds to a checkout that didn't go through, listing the cart
+// changes to accept when that is why.
+func (co *checkout) fail(err error) {
+	if len(co.changes) > 0 {
+		co.c.JSON(checkoutStatus(err), gin.H{"error": err.Error(), "priceChanges": co.changes})
+		return
+	}
+	co.c.JSON(checkoutStatus(err), gin.H{"error": err.Error()})
+}
+
+// rollback releases anything price reserved for an order that wasn't placed.
+func (co *checkout) rollback(ctx context.Context) {
+	if co.redeemed != nil {
+		if err := database.ReleaseCoupon(ctx, CouponCollection, co.redeemed.Code, co.userID); err != nil {
+			log.Println(err)
+		}
+		co.redeemed = nil
+	}
+}
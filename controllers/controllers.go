@@ -15,6 +15,7 @@ import (
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/events"
 	"github.com/mreym/shopping/models"
 	generate "github.com/mreym/shopping/tokens"
 )
@@ -58,7 +59,7 @@ func Signup() gin.HandlerFunc {
 
 		validationErr := Validate.Struct(user)
 		if validationErr != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr})
+			c.JSON(http.StatusBadRequest, gin.H{"error": validationErr.Error()})
 			return
 		}
 
@@ -71,6 +72,7 @@ func Signup() gin.HandlerFunc {
 
 		if count > 0 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "user already exists"})
+			return
 		}
 
 		count, err = UserCollection.CountDocuments(ctx, bson.M{"phone": user.Phone})
@@ -94,14 +96,35 @@ func Signup() gin.HandlerFunc {
 		user.Updated_At, _ = time.Parse(time.RFC3339, time.Now().Format(time.RFC3339))
 		user.ID = primitive.NewObjectID()
 		user.User_ID = user.ID.Hex()
-		token, refreshtoken, _ := generate.GenerateTokens(*user.Email, *user.First_Name, *user.Last_Name, *&user.User_ID)
+		token, refreshtoken, _ := generate.GenerateTokens(*user.Email, *user.First_Name, *user.Last_Name, *&user.User_ID, 0)
 		user.Token = &token
 		user.Refresh_Token = &refreshtoken
 		user.UserCart = make([]models.ProductUser, 0)
 		user.Address_Details = make([]models.Address, 0)
 		user.Order_Status = make([]models.Order, 0)
-		_, inserter := UserCollection.InsertOne(ctx, user)
+		// the verification email goes out from the UserSignedUp event
+		user.Email_Verified = false
+		user.Verification = nil
+		user.Password_Reset = nil
+		user.Session_Version = 0
+		locale := MailTemplates.Match(c.GetHeader("Accept-Language"))
+		if user.Locale != nil {
+			locale = MailTemplates.Match(*user.Locale)
+		}
+		user.Locale = &locale
+		inserter := database.Transaction(ctx, func(ctx context.Context) error {
+			if _, err := UserCollection.InsertOne(ctx, user); err != nil {
+				return err
+			}
+			return database.Publish(ctx, OutboxCollection, events.UserSignedUp{
+				User_ID:    user.User_ID,
+				Email:      *user.Email,
+				First_Name: *user.First_Name,
+				Locale:     locale,
+			})
+		})
 		if inserter != nil {
+			log.Println(inserter)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "the user did not get created"})
 			return
 		}
@@ -124,11 +147,29 @@ func Login() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err})
 			return
 		}
+		if user.Email == nil || user.Password == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "email and password are required"})
+			return
+		}
 
-		err := UserCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&founduser)
+		// the attempt is counted before comparing passwords, so guesses past the
+		// limit cost no bcrypt work and parallel ones can't slip through
+		wait, err := reserveLogin(ctx, *user.Email, c.ClientIP())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if wait > 0 {
+			recordLogin(ctx, c, *user.Email, "", models.LoginRefused)
+			tooManyRequests(c, wait, "too many failed sign-ins, try again later")
+			return
+		}
+
+		err = UserCollection.FindOne(ctx, bson.M{"email": user.Email}).Decode(&founduser)
 		defer cancel()
 
 		if err != nil {
+			recordLogin(ctx, c, *user.Email, "", models.LoginUnknownUser)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "login or password incorrect"})
 			return
 		}
@@ -137,14 +178,19 @@ func Login() gin.HandlerFunc {
 		defer cancel()
 
 		if !PasswordIsValid {
+			recordLogin(ctx, c, *user.Email, founduser.User_ID, models.LoginBadPassword)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": msg})
 			fmt.Println(msg)
 			return
 		}
-		token, refreshToken, _ := generate.GenerateTokens(*founduser.Email, *founduser.First_Name, *founduser.Last_Name, *&founduser.User_ID)
+		token, refreshToken, _ := generate.GenerateTokens(*founduser.Email, *founduser.First_Name, *founduser.Last_Name, *&founduser.User_ID, founduser.Session_Version)
 		defer cancel()
 
 		generate.UpdateAllTokens(token, refreshToken, founduser.User_ID)
+		founduser.Token = &token
+		founduser.Refresh_Token = &refreshToken
+		loginSucceeded(ctx, c, founduser)
+		mergeGuestCart(ctx, c, &founduser)
 
 		c.JSON(http.StatusFound, founduser)
 	}
@@ -159,10 +205,26 @@ func ProductViewerAdmin() gin.HandlerFunc {
 			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+		// carts are totalled in the store currency, so every price must be in it
+		if products.Price.IsNegative() || products.Price.Currency != models.DefaultCurrency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "price must not be negative and must be in " + models.DefaultCurrency})
+			return
+		}
+		if products.Stock != nil && *products.Stock < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "stock must not be negative"})
+			return
+		}
 
 		products.Product_ID = primitive.NewObjectID()
-		_, anyerr := ProductCollection.InsertOne(ctx, products)
+		// the search index picks the product up from the ProductUpdated event
+		anyerr := database.Transaction(ctx, func(ctx context.Context) error {
+			if _, err := ProductCollection.InsertOne(ctx, products); err != nil {
+				return err
+			}
+			return database.Publish(ctx, OutboxCollection, events.ProductUpdated{Product: products})
+		})
 		if anyerr != nil {
+			log.Println(anyerr)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "not inserted"})
 			return
 		}
@@ -200,6 +262,11 @@ func SearchProduct() gin.HandlerFunc {
 			c.IndentedJSON(400, "invalid")
 			return
 		}
+
+		if err := convertProducts(ctx, displayCurrency(c, nil), productList); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 		defer cancel()
 		c.IndentedJSON(200, productList)
 
@@ -232,7 +299,7 @@ func SearchProductByQuery() gin.HandlerFunc {
 			return
 		}
 
-		err = searchquerydb.All(ctx, searchProducts)
+		err = searchquerydb.All(ctx, &searchProducts)
 		if err != nil {
 			log.Println(err)
 			c.IndentedJSON(400, "invalid")
@@ -246,7 +313,15 @@ func SearchProductByQuery() gin.HandlerFunc {
 			return
 		}
 
+		if err := convertProducts(ctx, displayCurrency(c, nil), searchProducts); err != nil {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
 		defer cancel()
+		if len(searchProducts) > 0 {
+			SearchIndex.RecordQuery(queryParam, c.ClientIP())
+		}
 		c.IndentedJSON(200, searchProducts)
 	}
 
@@ -0,0 +1,171 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/coupons"
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+)
+
+var CouponCollection *mongo.Collection = database.CollectionData(database.Client, "Coupons")
+
+// cartCoupon works out the discount of the coupon applied to the user's cart.
+// It returns a nil coupon when none is applied.
+func cartCoupon(ctx context.Context, user *models.Users, lines []models.ProductUser, subtotal models.Money) (*models.Coupon, coupons.Result, error) {
+	if user.Applied_Coupon == nil || *user.Applied_Coupon == "" {
+		return nil, coupons.Result{Discount: models.ZeroMoney(subtotal.Currency)}, nil
+	}
+
+	coupon, err := database.FindCoupon(ctx, CouponCollection, *user.Applied_Coupon)
+	if err != nil {
+		return nil, coupons.Result{}, err
+	}
+	if err = coupons.Usable(coupon, user.ID.Hex(), time.Now()); err != nil {
+		return nil, coupons.Result{}, err
+	}
+	result, err := coupons.Apply(coupon, lines, subtotal)
+	if err != nil {
+		return nil, coupons.Result{}, err
+	}
+	return &coupon, result, nil
+}
+
+func CreateCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var coupon models.Coupon
+		if err := c.BindJSON(&coupon); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		coupon.Code = coupons.NormalizeCode(coupon.Code)
+		if err := coupons.Check(coupon); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := database.CreateCoupon(ctx, CouponCollection, coupon)
+		if err == database.ErrCouponExists {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Coupon created", "code": coupon.Code})
+	}
+}
+
+func ListCoupons() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.ListCoupons(ctx, CouponCollection)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func DeleteCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := database.DeleteCoupon(ctx, CouponCollection, coupons.NormalizeCode(c.Param("code")))
+		if err == database.ErrCouponNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Coupon deleted"})
+	}
+}
+
+// ApplyCoupon checks a code against the signed in user's cart and keeps it on
+// the cart so checkout takes it off the total.
+func (app *Application) ApplyCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Code string `json:"code"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		code := coupons.NormalizeCode(body.Code)
+		if code == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "coupon code is empty"})
+			return
+		}
+
+		userObjectID, err := primitive.ObjectIDFromHex(c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.Users
+		err = app.userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: userObjectID}}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		lines, _, err := database.RepriceCart(ctx, app.prodCollection, user.UserCart)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		user.Applied_Coupon = &code
+		quote, err := quoteCart(ctx, &user, lines, shippingAddress(&user), "", true)
+		if err == database.ErrCouponNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": coupons.ErrInvalidCoupon.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err = database.SetCartCoupon(ctx, app.userCollection, user.ID.Hex(), &code); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Coupon applied", "code": code, "quote": quote})
+	}
+}
+
+func (app *Application) RemoveCoupon() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := database.SetCartCoupon(ctx, app.userCollection, c.GetString("uid"), nil); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Coupon removed"})
+	}
+}
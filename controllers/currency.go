@@ -0,0 +1,209 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/currency"
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+)
+
+var RateCollection *mongo.Collection = database.CollectionData(database.Client, "ExchangeRates")
+
+func loadRates(ctx context.Context) (*currency.Rates, error) {
+	table, err := database.LoadExchangeRates(ctx, RateCollection)
+	if err != nil {
+		return nil, err
+	}
+	return currency.NewRates(table)
+}
+
+// displayCurrency picks the currency prices are shown in: the ?currency=
+// query parameter, then the user's saved preference, then the store currency.
+func displayCurrency(c *gin.Context, user *models.Users) string {
+	if requested := c.Query("currency"); requested != "" {
+		return strings.ToUpper(requested)
+	}
+	if user != nil && user.Display_Currency != nil && *user.Display_Currency != "" {
+		return *user.Display_Currency
+	}
+	return models.DefaultCurrency
+}
+
+func convertProducts(ctx context.Context, code string, products []models.Product) error {
+	if code == models.DefaultCurrency {
+		return nil
+	}
+	rates, err := loadRates(ctx)
+	if err != nil {
+		return err
+	}
+	for i := range products {
+		price, err := rates.Convert(products[i].Price, code)
+		if err != nil {
+			return err
+		}
+		products[i].Display_Price = &price
+	}
+	return nil
+}
+
+func convertCart(ctx context.Context, code string, cart []models.ProductUser, total models.Money) (*models.Money, error) {
+	if code == models.DefaultCurrency {
+		return nil, nil
+	}
+	rates, err := loadRates(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range cart {
+		price, err := rates.Convert(cart[i].Price, code)
+		if err != nil {
+			return nil, err
+		}
+		cart[i].Display_Price = &price
+	}
+	displayTotal, err := rates.Convert(total, code)
+	if err != nil {
+		return nil, err
+	}
+	return &displayTotal, nil
+}
+
+// freezeDisplayPrice records the display currency total and the rate used on
+// the order, so later rate changes don't alter what the customer was shown.
+func freezeDisplayPrice(ctx context.Context, order *models.Order, code string) error {
+	if code == models.DefaultCurrency {
+		return nil
+	}
+	rates, err := loadRates(ctx)
+	if err != nil {
+		return err
+	}
+	row, err := rates.Lookup(code)
+	if err != nil {
+		return err
+	}
+	display, err := rates.Convert(order.Price, code)
+	if err != nil {
+		return err
+	}
+	order.Exchange_Rate = &row
+	order.Display_Price = &display
+	return nil
+}
+
+// ListCurrencies returns the currencies customers can choose to display prices in.
+func ListCurrencies() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rates, err := loadRates(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"base": models.DefaultCurrency, "currencies": rates.Supported()})
+	}
+}
+
+func SetDisplayCurrency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Currency string `json:"currency"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rates, err := loadRates(ctx)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		row, err := rates.Lookup(body.Currency)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		err = database.SetDisplayCurrency(ctx, UserCollection, c.GetString("uid"), row.Currency)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Display currency updated", "currency": row.Currency})
+	}
+}
+
+func ListExchangeRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		table, err := database.LoadExchangeRates(ctx, RateCollection)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, table)
+	}
+}
+
+func SetExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rate models.ExchangeRate
+		if err := c.BindJSON(&rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rate.Currency = strings.ToUpper(strings.TrimSpace(rate.Currency))
+		if len(rate.Currency) != 3 || rate.Currency == models.DefaultCurrency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid currency code"})
+			return
+		}
+		if _, err := currency.ParseRate(rate.Rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := database.SetExchangeRate(ctx, RateCollection, rate); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Exchange rate saved"})
+	}
+}
+
+func DeleteExchangeRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := database.DeleteExchangeRate(ctx, RateCollection, strings.ToUpper(c.Param("currency")))
+		if err == database.ErrRateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Exchange rate deleted"})
+	}
+}
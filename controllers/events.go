@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/outbox"
+	"github.com/mreym/shopping/webhooks"
+)
+
+const (
+	defaultOutboxLimit = 100
+	maxOutboxLimit     = 1000
+)
+
+var OutboxCollection *mongo.Collection = database.CollectionData(database.Client, "Outbox")
+
+// NewDispatcher subscribes the shop's side effects to the domain events in
+// the outbox. main runs it in the background.
+func NewDispatcher() *outbox.Dispatcher {
+	d := outbox.NewDispatcher(OutboxCollection)
+	d.Handle(events.TypeUserSignedUp, "welcome-email", func(ctx context.Context, e events.Event) error {
+		return notifyWelcome(ctx, e.(events.UserSignedUp))
+	})
+	d.Handle(events.TypeUserSignedUp, "verification-email", func(ctx context.Context, e events.Event) error {
+		return notifyVerification(ctx, e.(events.UserSignedUp))
+	})
+	d.Handle(events.TypeOrderPlaced, "confirmation-email", func(ctx context.Context, e events.Event) error {
+		return notifyOrderPlaced(ctx, e.(events.OrderPlaced))
+	})
+	d.Handle(events.TypeOrderPlaced, "invoice", func(ctx context.Context, e events.Event) error {
+		return issueOrderInvoice(ctx, e.(events.OrderPlaced))
+	})
+	d.Handle(events.TypeOrderCancelled, "release-coupon", func(ctx context.Context, e events.Event) error {
+		return releaseOrderCoupon(ctx, e.(events.OrderCancelled))
+	})
+	d.Handle(events.TypeOrderCancelled, "cancellation-email", func(ctx context.Context, e events.Event) error {
+		return notifyOrderCancelled(ctx, e.(events.OrderCancelled))
+	})
+	d.Handle(events.TypeOrderCancelled, "credit-note", func(ctx context.Context, e events.Event) error {
+		return creditCancelledOrder(ctx, e.(events.OrderCancelled))
+	})
+	d.Handle(events.TypeProductUpdated, "search-index", func(ctx context.Context, e events.Event) error {
+		return RefreshSearchIndex(ctx)
+	})
+	for _, eventType := range webhooks.Events {
+		d.Handle(eventType, "webhooks", queueWebhooks)
+	}
+	return d
+}
+
+// ListOutbox shows the latest outbox messages for operators, filtered with
+// ?status=, e.g. failed.
+func ListOutbox() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := queryInt(c, "limit", defaultOutboxLimit, maxOutboxLimit)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.ListOutbox(ctx, OutboxCollection, c.Query("status"), int64(limit))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// RequeueOutboxMessage retries a message that used up its attempts.
+func RequeueOutboxMessage() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		messageID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		msg, err := database.RequeueOutboxMessage(ctx, OutboxCollection, messageID)
+		if err == database.ErrOutboxMessageNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "no failed message with that id"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, msg)
+	}
+}
@@ -0,0 +1,185 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/cartmerge"
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	token "github.com/mreym/shopping/tokens"
+)
+
+var GuestCartCollection *mongo.Collection = database.CollectionData(database.Client, "GuestCarts")
+
+// CartMergeRule decides what happens to a product that is in both the guest
+// cart and the user's cart at login. Set it with CART_MERGE_RULE; a login can
+// pick another rule with ?merge=.
+var CartMergeRule = cartMergeRule()
+
+func cartMergeRule() string {
+	if rule := os.Getenv("CART_MERGE_RULE"); rule != "" {
+		return rule
+	}
+	return cartmerge.DefaultRule
+}
+
+// guestCartID reads the cart id from the signed cart_token header. The bool
+// is false when no token was sent.
+func guestCartID(c *gin.Context) (primitive.ObjectID, bool, string) {
+	cartToken := c.Request.Header.Get("cart_token")
+	if cartToken == "" {
+		return primitive.NilObjectID, false, ""
+	}
+	claims, msg := token.ValidateCartToken(cartToken)
+	if msg != "" {
+		return primitive.NilObjectID, true, msg
+	}
+	cartID, err := primitive.ObjectIDFromHex(claims.Cart_ID)
+	if err != nil {
+		return primitive.NilObjectID, true, "the cart token is invalid"
+	}
+	return cartID, true, ""
+}
+
+func guestCartStatus(err error) int {
+	switch err {
+	case database.ErrGuestCartNotFound, database.ErrCantFindProduct:
+		return http.StatusNotFound
+	case database.ErrGuestCartFull:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+func GetGuestCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cartID, sent, msg := guestCartID(c)
+		if !sent || msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "a valid cart_token header is required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		cart, err := database.FindGuestCart(ctx, GuestCartCollection, cartID)
+		if err != nil {
+			c.JSON(guestCartStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		// shown at today's prices, like the user's cart
+		lines, changes, err := database.RepriceCart(ctx, ProductCollection, cart.Items)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		total, err := database.CartTotal(lines)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		displayTotal, err := convertCart(ctx, displayCurrency(c, nil), lines, total)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"totalItems": len(lines), "total": total, "displayTotal": displayTotal, "priceChanges": changes, "cartItems": lines, "expires_at": cart.Expires_At})
+	}
+}
+
+// AddGuestCartItem adds a product to the guest cart. Without a cart_token a
+// new cart is started and its token is returned for the following requests.
+func AddGuestCartItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("product"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+			return
+		}
+		cartID, sent, msg := guestCartID(c)
+		if msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		cartToken := ""
+		if !sent {
+			expiresAt := time.Now().Add(token.CartTokenLifetime)
+			cart, err := database.CreateGuestCart(ctx, GuestCartCollection, expiresAt)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			if cartToken, err = token.GenerateCartToken(cart.Cart_ID.Hex(), expiresAt); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+			cartID = cart.Cart_ID
+		}
+
+		if err = database.AddGuestCartItem(ctx, ProductCollection, GuestCartCollection, cartID, productID); err != nil {
+			c.JSON(guestCartStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if cartToken != "" {
+			c.JSON(http.StatusCreated, gin.H{"message": "Successfully added to the cart", "cart_token": cartToken})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully added to the cart"})
+	}
+}
+
+func RemoveGuestCartItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("product"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+			return
+		}
+		cartID, sent, msg := guestCartID(c)
+		if !sent || msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "a valid cart_token header is required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err = database.RemoveGuestCartItem(ctx, GuestCartCollection, cartID, productID); err != nil {
+			c.JSON(guestCartStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully removed item from cart"})
+	}
+}
+
+// mergeGuestCart folds the guest cart named by the cart_token header into the
+// user's cart. It never fails the login; problems are only logged.
+func mergeGuestCart(ctx context.Context, c *gin.Context, user *models.Users) {
+	cartID, sent, msg := guestCartID(c)
+	if !sent {
+		return
+	}
+	if msg != "" {
+		log.Println("guest cart not merged:", msg)
+		return
+	}
+	rule := c.DefaultQuery("merge", CartMergeRule)
+	merged, err := database.MergeGuestCart(ctx, GuestCartCollection, UserCollection, cartID, user.User_ID, rule)
+	if err != nil {
+		log.Println("guest cart not merged:", err)
+		return
+	}
+	user.UserCart = merged
+}
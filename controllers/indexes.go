@@ -0,0 +1,26 @@
+package controllers
+
+import (
+	"context"
+
+	"github.com/mreym/shopping/database"
+)
+
+// EnsureIndexes creates the unique indexes the shop relies on to refuse
+// duplicates. main runs it at startup; creating one that exists is a no-op.
+func EnsureIndexes(ctx context.Context) error {
+	if err := database.EnsureInvoiceIndexes(ctx, InvoiceCollection); err != nil {
+		return err
+	}
+	if err := database.EnsureReviewIndexes(ctx, ReviewCollection); err != nil {
+		return err
+	}
+	return database.EnsureWebhookIndexes(ctx, WebhookDeliveryCollection)
+}
+
+// Migrate brings documents written by earlier releases up to date. main
+// runs it at startup after EnsureIndexes; each step only touches documents
+// that still need it, so running it again is a no-op.
+func Migrate(ctx context.Context) error {
+	return database.VerifyExistingUsers(ctx, UserCollection)
+}
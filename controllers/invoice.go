@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/invoice"
+	"github.com/mreym/shopping/models"
+)
+
+var InvoiceCollection *mongo.Collection = database.CollectionData(database.Client, "Invoices")
+var CounterCollection *mongo.Collection = database.CollectionData(database.Client, "Counters")
+
+// InvoiceSeller is the name printed at the top of invoices, from
+// INVOICE_SELLER.
+var InvoiceSeller = invoiceSeller()
+
+func invoiceSeller() string {
+	if seller := os.Getenv("INVOICE_SELLER"); seller != "" {
+		return seller
+	}
+	return "Shopping"
+}
+
+func invoiceStatus(err error) int {
+	switch err {
+	case database.ErrOrderNotFound, database.ErrInvoiceNotFound, database.ErrUserIdIsNotValid:
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func numberFor(kind string) func(int64) string {
+	return func(n int64) string { return invoice.Number(kind, n) }
+}
+
+// issueOrderInvoice issues the invoice of an order as it is placed.
+func issueOrderInvoice(ctx context.Context, event events.OrderPlaced) error {
+	_, err := orderInvoice(ctx, event.Order, event.User_ID)
+	return err
+}
+
+// orderInvoice returns the invoice of an order, issuing it if it doesn't
+// exist yet, as for orders placed before invoices were issued at checkout.
+func orderInvoice(ctx context.Context, order models.Order, ownerID string) (models.Invoice, error) {
+	inv, err := database.FindInvoice(ctx, InvoiceCollection, order.Order_ID, models.InvoiceKindInvoice, nil)
+	if err != database.ErrInvoiceNotFound {
+		return inv, err
+	}
+	if inv, err = invoice.Build(order, ownerID, InvoiceSeller, time.Now()); err != nil {
+		return inv, err
+	}
+	return database.IssueInvoice(ctx, InvoiceCollection, CounterCollection, inv, numberFor(models.InvoiceKindInvoice))
+}
+
+// issueCreditNote returns the credit note of a refund, issuing it (and the
+// order's invoice it credits) when it doesn't exist yet.
+func issueCreditNote(ctx context.Context, order models.Order, refund models.Refund) (models.Invoice, error) {
+	note, err := database.FindInvoice(ctx, InvoiceCollection, order.Order_ID, models.InvoiceKindCreditNote, &refund.Refund_ID)
+	if err != database.ErrInvoiceNotFound {
+		return note, err
+	}
+	inv, err := orderInvoice(ctx, order, refund.User_ID)
+	if err != nil {
+		return note, err
+	}
+	r, err := database.FindReturn(ctx, ReturnCollection, refund.Return_ID)
+	if err != nil {
+		return note, err
+	}
+	if note, err = invoice.CreditNote(order, inv.Number, r, refund, InvoiceSeller, time.Now()); err != nil {
+		return note, err
+	}
+	return database.IssueInvoice(ctx, InvoiceCollection, CounterCollection, note, numberFor(models.InvoiceKindCreditNote))
+}
+
+// issueCancellationNote returns the credit note of a cancelled order,
+// issuing it (and the order's invoice it credits) when it doesn't exist yet.
+func issueCancellationNote(ctx context.Context, order models.Order, ownerID string) (models.Invoice, error) {
+	note, err := database.FindInvoice(ctx, InvoiceCollection, order.Order_ID, models.InvoiceKindCreditNote, nil)
+	if err != database.ErrInvoiceNotFound {
+		return note, err
+	}
+	inv, err := orderInvoice(ctx, order, ownerID)
+	if err != nil {
+		return note, err
+	}
+	return database.IssueInvoice(ctx, InvoiceCollection, CounterCollection, invoice.Cancellation(inv, time.Now()), numberFor(models.InvoiceKindCreditNote))
+}
+
+// creditCancelledOrder issues the credit note of an order as it is cancelled.
+func creditCancelledOrder(ctx context.Context, event events.OrderCancelled) error {
+	order, _, err := database.FindOrder(ctx, UserCollection, event.Order_ID, event.User_ID)
+	if err != nil {
+		return err
+	}
+	_, err = issueCancellationNote(ctx, order, event.User_ID)
+	return err
+}
+
+// orderCreditNotes makes sure every refund on the order, and its
+// cancellation, has its credit note.
+func orderCreditNotes(ctx context.Context, order models.Order, ownerID string) ([]models.Invoice, error) {
+	refunds, err := database.OrderRefunds(ctx, RefundCollection, order.Order_ID)
+	if err != nil {
+		return nil, err
+	}
+	notes := make([]models.Invoice, 0, len(refunds)+1)
+	if order.Cancelled_At != nil {
+		note, err := issueCancellationNote(ctx, order, ownerID)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	for _, refund := range refunds {
+		note, err := issueCreditNote(ctx, order, refund)
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, nil
+}
+
+// sendInvoice answers with JSON, or a PDF download for ?format=pdf.
+func sendInvoice(c *gin.Context, inv models.Invoice, body interface{}) {
+	if c.Query("format") == "pdf" {
+		c.Header("Content-Disposition", `attachment; filename="`+inv.Number+`.pdf"`)
+		c.Data(http.StatusOK, "application/pdf", invoice.PDF(inv))
+		return
+	}
+	c.JSON(http.StatusOK, body)
+}
+
+func invoiceHandler(userID func(c *gin.Context) string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, ownerID, err := database.FindOrder(ctx, UserCollection, orderID, userID(c))
+		if err != nil {
+			c.JSON(invoiceStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		inv, err := orderInvoice(ctx, order, ownerID)
+		if err != nil {
+			c.JSON(invoiceStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		notes, err := orderCreditNotes(ctx, order, ownerID)
+		if err != nil {
+			c.JSON(invoiceStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		sendInvoice(c, inv, gin.H{"invoice": inv, "credit_notes": notes})
+	}
+}
+
+// OrderInvoice gives the signed in user the invoice of one of their orders,
+// with the credit notes for any refunds on it or its cancellation.
+func OrderInvoice() gin.HandlerFunc {
+	return invoiceHandler(func(c *gin.Context) string { return c.GetString("uid") })
+}
+
+// AdminOrderInvoice is OrderInvoice for any user's order.
+func AdminOrderInvoice() gin.HandlerFunc {
+	return invoiceHandler(func(c *gin.Context) string { return "" })
+}
+
+// OrderCreditNote returns one credit note of the user's order by number.
+func OrderCreditNote() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, _, err = database.FindOrder(ctx, UserCollection, orderID, c.GetString("uid")); err != nil {
+			c.JSON(invoiceStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		note, err := database.FindInvoiceByNumber(ctx, InvoiceCollection, c.Param("number"))
+		if err != nil || note.Order_ID != orderID || note.Kind != models.InvoiceKindCreditNote {
+			c.JSON(http.StatusNotFound, gin.H{"error": database.ErrInvoiceNotFound.Error()})
+			return
+		}
+		sendInvoice(c, note, note)
+	}
+}
+
+// GetInvoice looks up any invoice or credit note by number, for accounting.
+func GetInvoice() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		inv, err := database.FindInvoiceByNumber(ctx, InvoiceCollection, c.Param("number"))
+		if err != nil {
+			c.JSON(invoiceStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		sendInvoice(c, inv, inv)
+	}
+}
@@ -0,0 +1,161 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/accounts"
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+)
+
+const (
+	defaultLoginAttemptsLimit = 100
+	maxLoginAttemptsLimit     = 1000
+)
+
+var LoginThrottleCollection *mongo.Collection = database.CollectionData(database.Client, "LoginThrottles")
+var LoginAttemptCollection *mongo.Collection = database.CollectionData(database.Client, "LoginAttempts")
+
+// TrustedProxies are the reverse proxies, by address or CIDR, whose
+// X-Forwarded-For header gives the client address, from the comma separated
+// TRUSTED_PROXIES. By default none are trusted and the connection's own
+// address is used.
+var TrustedProxies = trustedProxies()
+
+func trustedProxies() []string {
+	proxies := make([]string, 0)
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			proxies = append(proxies, proxy)
+		}
+	}
+	return proxies
+}
+
+// reserveLogin counts a sign-in for email from ip against the address and
+// the account before the password is compared. It returns how long the
+// sign-in must wait instead when either has failed too often recently.
+func reserveLogin(ctx context.Context, email string, ip string) (time.Duration, error) {
+	now := time.Now()
+	wait, err := database.ReserveLoginAttempt(ctx, LoginThrottleCollection, accounts.IPKey(ip), accounts.IPLockout, accounts.IPWait, now)
+	if err != nil || wait > 0 {
+		return wait, err
+	}
+	return database.ReserveLoginAttempt(ctx, LoginThrottleCollection, accounts.AccountKey(email), accounts.AccountLockout, accounts.AccountWait, now)
+}
+
+// recordLogin adds a sign-in attempt to the audit trail.
+func recordLogin(ctx context.Context, c *gin.Context, email string, userID string, outcome string) {
+	err := database.RecordLoginAttempt(ctx, LoginAttemptCollection, models.LoginAttempt{
+		Email:      email,
+		User_ID:    userID,
+		IP:         c.ClientIP(),
+		User_Agent: c.Request.UserAgent(),
+		Outcome:    outcome,
+		At:         time.Now(),
+	})
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// loginSucceeded forgets the account's failed sign-ins. The address only
+// gets this sign-in's reservation back, so one working password doesn't
+// reset an attack from it.
+func loginSucceeded(ctx context.Context, c *gin.Context, user models.Users) {
+	recordLogin(ctx, c, *user.Email, user.User_ID, models.LoginSucceeded)
+	clearAccountLockout(ctx, *user.Email)
+	if err := database.ReleaseLoginAttempt(ctx, LoginThrottleCollection, accounts.IPKey(c.ClientIP())); err != nil {
+		log.Println(err)
+	}
+}
+
+func clearAccountLockout(ctx context.Context, email string) {
+	if err := database.ClearLoginFailures(ctx, LoginThrottleCollection, accounts.AccountKey(email)); err != nil && err != database.ErrNotLocked {
+		log.Println(err)
+	}
+}
+
+// LockedLogins lists the accounts and addresses that can't sign in right now.
+func LockedLogins() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.LockedLogins(ctx, LoginThrottleCollection, time.Now())
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// LoginAttempts is the sign-in audit trail, newest first, filtered with
+// ?email= and ?ip=.
+func LoginAttempts() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit, ok := queryInt(c, "limit", defaultLoginAttemptsLimit, maxLoginAttemptsLimit)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.LoginAttempts(ctx, LoginAttemptCollection, c.Query("email"), c.Query("ip"), int64(limit))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func unlockLogin(c *gin.Context, key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := database.ClearLoginFailures(ctx, LoginThrottleCollection, key)
+	if err == database.ErrNotLocked {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	log.Printf("sign-in lockout of %s cleared by %s", key, moderator(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Unlocked"})
+}
+
+// UnlockUser lifts the lockout of a user's account and forgets its failed
+// sign-ins.
+func UnlockUser() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		user, err := findUser(ctx, c.Param("id"))
+		if err != nil || user.Email == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		unlockLogin(c, accounts.AccountKey(*user.Email))
+	}
+}
+
+// UnlockIP lifts the lockout of an IP address.
+func UnlockIP() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		unlockLogin(c, accounts.IPKey(c.Param("ip")))
+	}
+}
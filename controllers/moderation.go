@@ -0,0 +1,251 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/moderation"
+)
+
+const (
+	defaultModerationLogLimit = 100
+	maxModerationLogLimit     = 1000
+)
+
+var ModerationLogCollection *mongo.Collection = database.CollectionData(database.Client, "ModerationLog")
+
+// ModerationAutoApprove publishes text no filter objects to without waiting
+// for a moderator. Turn it on with MODERATION_AUTO_APPROVE=true.
+var ModerationAutoApprove = os.Getenv("MODERATION_AUTO_APPROVE") == "true"
+
+// DuplicateFilter flags customer text that has been posted before.
+var DuplicateFilter = moderation.Duplicate{Exists: fingerprintUsed}
+
+// ContentFilter checks customer text before it is shown. main replaces the
+// built-in word list when word list files are configured.
+var ContentFilter moderation.Filter = moderation.Pipeline{
+	moderation.NewWordList("profanity", moderation.DefaultWords),
+	moderation.Links{},
+	DuplicateFilter,
+}
+
+func fingerprintUsed(ctx context.Context, content moderation.Content, fingerprint string) (bool, error) {
+	kind, ok := moderatedKinds[content.Kind]
+	if !ok {
+		return false, nil
+	}
+	return database.FingerprintUsed(ctx, kind.collection, fingerprint, content.ID)
+}
+
+// moderatedKind is how moderation reaches each kind of customer text.
+type moderatedKind struct {
+	collection *mongo.Collection
+	// list and item return somewhere to decode a queue or a single text
+	list func() interface{}
+	item func() interface{}
+	// changed updates whatever is derived from the approved texts after a
+	// moderation decision
+	changed func(ctx context.Context, target database.ModerationTarget) error
+}
+
+var moderatedKinds = map[string]moderatedKind{
+	moderation.KindReview: {
+		collection: ReviewCollection,
+		list:       func() interface{} { list := make([]models.Review, 0); return &list },
+		item:       func() interface{} { return &models.Review{} },
+		changed: func(ctx context.Context, target database.ModerationTarget) error {
+			_, err := database.RefreshRating(ctx, ReviewCollection, ProductCollection, target.Product_ID)
+			return err
+		},
+	},
+	moderation.KindQuestion: {
+		collection: QuestionCollection,
+		list:       func() interface{} { list := make([]models.Question, 0); return &list },
+		item:       func() interface{} { return &models.Question{} },
+		changed:    func(ctx context.Context, target database.ModerationTarget) error { return nil },
+	},
+	moderation.KindAnswer: {
+		collection: AnswerCollection,
+		list:       func() interface{} { list := make([]models.Answer, 0); return &list },
+		item:       func() interface{} { return &models.Answer{} },
+		changed: func(ctx context.Context, target database.ModerationTarget) error {
+			return database.RefreshAnswerCount(ctx, AnswerCollection, QuestionCollection, target.Question_ID)
+		},
+	},
+}
+
+func moderationStatus(err error) int {
+	switch err {
+	case database.ErrNothingToModerate:
+		return http.StatusNotFound
+	case database.ErrModerationStatusMoved:
+		return http.StatusConflict
+	}
+	return http.StatusInternalServerError
+}
+
+// moderator names who made a decision in the audit trail, from the optional
+// moderator header.
+func moderator(c *gin.Context) string {
+	if name := c.Request.Header.Get("moderator"); name != "" {
+		return name
+	}
+	return "admin"
+}
+
+// logModeration records a decision in the audit trail. A failure is only
+// logged: the decision itself has already been saved.
+func logModeration(ctx context.Context, action models.ModerationAction) {
+	if err := database.LogModeration(ctx, ModerationLogCollection, action); err != nil {
+		log.Println(err)
+	}
+}
+
+// screen runs customer text through the content filters and returns the
+// moderation status it starts in.
+func screen(ctx context.Context, content moderation.Content) ([]models.ModerationFlag, string, error) {
+	flags, err := ContentFilter.Check(ctx, content)
+	if err != nil {
+		return nil, "", err
+	}
+	return flags, moderation.Status(flags, ModerationAutoApprove), nil
+}
+
+// logScreening records in the audit trail what the filters made of newly
+// posted or edited text.
+func logScreening(ctx context.Context, kind string, targetID, productID primitive.ObjectID, status string, flags []models.ModerationFlag) {
+	logModeration(ctx, models.ModerationAction{
+		Kind:       kind,
+		Target_ID:  targetID,
+		Product_ID: productID,
+		To:         status,
+		Moderator:  "filters",
+		Flags:      flags,
+	})
+}
+
+func validModerationStatus(status string) bool {
+	switch status {
+	case models.ModerationPending, models.ModerationApproved, models.ModerationRejected, models.ModerationHidden:
+		return true
+	}
+	return false
+}
+
+// ModerationQueue lists texts of a kind waiting for a moderator, or those
+// in another status with ?status=.
+func ModerationQueue(kindName string) gin.HandlerFunc {
+	kind := moderatedKinds[kindName]
+	return func(c *gin.Context) {
+		status := c.DefaultQuery("status", models.ModerationPending)
+		if !validModerationStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid status"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list := kind.list()
+		if err := database.ModerationQueue(ctx, kind.collection, status, list); err != nil {
+			c.JSON(moderationStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// Moderate moves the :id text of a kind to the status to: approving text
+// that was held, rejected or hidden, rejecting held text or hiding
+// published text. Every decision goes into the audit trail.
+func Moderate(kindName, to string) gin.HandlerFunc {
+	kind := moderatedKinds[kindName]
+	return func(c *gin.Context) {
+		id, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + kindName + " id"})
+			return
+		}
+		var body struct {
+			Note string `json:"note"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		target, err := database.FindModerationTarget(ctx, kind.collection, id)
+		if err != nil {
+			c.JSON(moderationStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !moderation.CanMove(target.Status, to) {
+			c.JSON(http.StatusConflict, gin.H{"error": "cannot move a " + target.Status + " " + kindName + " to " + to, "status": target.Status})
+			return
+		}
+		item := kind.item()
+		if err = database.Moderate(ctx, kind.collection, id, target.Status, to, item); err != nil {
+			c.JSON(moderationStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		logModeration(ctx, models.ModerationAction{
+			Kind:       kindName,
+			Target_ID:  id,
+			Product_ID: target.Product_ID,
+			From:       target.Status,
+			To:         to,
+			Moderator:  moderator(c),
+			Note:       body.Note,
+			Flags:      target.Flags,
+		})
+		if err = kind.changed(ctx, target); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, item)
+	}
+}
+
+// ModerationLog is the audit trail of moderation decisions, newest first.
+// Narrow it with ?kind= and ?target=<id>.
+func ModerationLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var targetID *primitive.ObjectID
+		if target := c.Query("target"); target != "" {
+			id, err := primitive.ObjectIDFromHex(target)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid target id"})
+				return
+			}
+			targetID = &id
+		}
+		limit, ok := queryInt(c, "limit", defaultModerationLogLimit, maxModerationLogLimit)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.ModerationLog(ctx, ModerationLogCollection, c.Query("kind"), targetID, int64(limit))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
@@ -0,0 +1,157 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/notify"
+)
+
+// Notifier sends customer emails: through the SMTP_HOST mail server when one
+// is set, otherwise as .eml files in MAIL_DIR, otherwise only to the log.
+var Notifier notify.Notifier = notifier()
+
+var MailTemplates = mailTemplates()
+
+// ShopName signs customer emails, from SHOP_NAME or else INVOICE_SELLER.
+var ShopName = shopName()
+
+func shopName() string {
+	if name := os.Getenv("SHOP_NAME"); name != "" {
+		return name
+	}
+	return InvoiceSeller
+}
+
+func notifier() notify.Notifier {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = shopName() + " <no-reply@localhost>"
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := os.Getenv("SMTP_PORT")
+		if port == "" {
+			port = "587"
+		}
+		return notify.SMTP{
+			Host:     host,
+			Port:     port,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     from,
+		}
+	}
+	if dir := os.Getenv("MAIL_DIR"); dir != "" {
+		return notify.FileNotifier{Dir: dir, From: from}
+	}
+	return notify.LogNotifier{}
+}
+
+func mailTemplates() *notify.Templates {
+	templates, err := notify.LoadTemplates()
+	if err != nil {
+		log.Fatal(err)
+	}
+	return templates
+}
+
+func firstName(user models.Users) string {
+	if user.First_Name == nil {
+		return ""
+	}
+	return *user.First_Name
+}
+
+// findUser loads a user by the hex id kept on orders, shipments and events.
+func findUser(ctx context.Context, userID string) (models.Users, error) {
+	var user models.Users
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return user, err
+	}
+	err = UserCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(&user)
+	return user, err
+}
+
+// deliverEmail renders the named email in the user's language and sends it.
+func deliverEmail(ctx context.Context, user models.Users, name string, data interface{}) error {
+	if user.Email == nil || *user.Email == "" {
+		return nil
+	}
+	locale := notify.DefaultLocale
+	if user.Locale != nil {
+		locale = *user.Locale
+	}
+	msg, err := MailTemplates.Render(name, locale, data)
+	if err != nil {
+		return err
+	}
+	msg.To = *user.Email
+	return Notifier.Send(ctx, msg)
+}
+
+// sendEmail is deliverEmail in the background, for emails that aren't sent
+// through the outbox. Failures are only logged.
+func sendEmail(user models.Users, name string, data interface{}) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := deliverEmail(ctx, user, name, data); err != nil {
+			log.Println(err)
+		}
+	}()
+}
+
+func notifyWelcome(ctx context.Context, event events.UserSignedUp) error {
+	user, err := findUser(ctx, event.User_ID)
+	if err != nil {
+		return err
+	}
+	return deliverEmail(ctx, user, notify.EmailWelcome, notify.Welcome{Shop: ShopName, Name: firstName(user)})
+}
+
+func notifyOrderPlaced(ctx context.Context, event events.OrderPlaced) error {
+	user, err := findUser(ctx, event.User_ID)
+	if err != nil {
+		return err
+	}
+	return deliverEmail(ctx, user, notify.EmailOrderPlaced, notify.NewOrderPlaced(ShopName, firstName(user), event.Order))
+}
+
+func notifyOrderCancelled(ctx context.Context, event events.OrderCancelled) error {
+	user, err := findUser(ctx, event.User_ID)
+	if err != nil {
+		return err
+	}
+	return deliverEmail(ctx, user, notify.EmailOrderCancelled, notify.OrderCancelled{
+		Shop:     ShopName,
+		Name:     firstName(user),
+		Order_ID: event.Order_ID.Hex(),
+		Reason:   event.Reason,
+	})
+}
+
+// notifyShipment tells the customer a shipment of theirs has moved.
+func notifyShipment(ctx context.Context, shipment models.Shipment, event models.ShipmentEvent) {
+	user, err := findUser(ctx, shipment.User_ID)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	sendEmail(user, notify.EmailShipmentUpdate, notify.ShipmentUpdate{
+		Shop:            ShopName,
+		Name:            firstName(user),
+		Order_ID:        shipment.Order_ID.Hex(),
+		Carrier:         shipment.Carrier,
+		Tracking_Number: shipment.Tracking_Number,
+		Status:          event.Status,
+		Location:        event.Location,
+	})
+}
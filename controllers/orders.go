@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+)
+
+// ListOrders returns the signed in user's orders. Display prices on them are
+// the ones frozen at checkout, not converted again at today's rates.
+func (app *Application) ListOrders() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userObjectID, err := primitive.ObjectIDFromHex(c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.Users
+		err = app.userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: userObjectID}}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		orders := user.Order_Status
+		if orders == nil {
+			orders = make([]models.Order, 0)
+		}
+		c.JSON(http.StatusOK, orders)
+	}
+}
+
+// CancelOrder cancels one of the signed in user's orders that hasn't
+// shipped yet and has no open returns. The coupon it used is given back,
+// a credit note issued and the customer emailed through the outbox.
+func (app *Application) CancelOrder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+			return
+		}
+		var body struct {
+			Reason string `json:"reason"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		userID := c.GetString("uid")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, _, err = database.FindOrder(ctx, app.userCollection, orderID, userID); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		order, err := database.CancelOrder(ctx, app.userCollection, ShipmentCollection, ReturnCollection, OutboxCollection, userID, orderID, strings.TrimSpace(body.Reason))
+		switch err {
+		case nil:
+		case database.ErrOrderCancelled, database.ErrOrderShipped, database.ErrOrderHasReturns:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		case database.ErrOrderNotFound, database.ErrUserIdIsNotValid:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, order)
+	}
+}
+
+// releaseOrderCoupon gives back the coupon use of a cancelled order.
+func releaseOrderCoupon(ctx context.Context, event events.OrderCancelled) error {
+	order, _, err := database.FindOrder(ctx, UserCollection, event.Order_ID, event.User_ID)
+	if err != nil || order.Coupon_Code == nil {
+		return err
+	}
+	return database.ReleaseCoupon(ctx, CouponCollection, *order.Coupon_Code, event.User_ID)
+}
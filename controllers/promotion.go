@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/promotions"
+)
+
+var PromotionCollection *mongo.Collection = database.CollectionData(database.Client, "Promotions")
+
+func CreatePromotion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var promotion models.Promotion
+		if err := c.BindJSON(&promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := promotions.Check(promotion); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		id, err := database.CreatePromotion(ctx, PromotionCollection, promotion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Promotion created", "id": id})
+	}
+}
+
+func ListPromotions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.ListPromotions(ctx, PromotionCollection)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+func SetPromotionActive() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		promotionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion id"})
+			return
+		}
+		var body struct {
+			Active bool `json:"active"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = database.SetPromotionActive(ctx, PromotionCollection, promotionID, body.Active)
+		if err == database.ErrPromotionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Promotion updated"})
+	}
+}
+
+func DeletePromotion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		promotionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid promotion id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = database.DeletePromotion(ctx, PromotionCollection, promotionID)
+		if err == database.ErrPromotionNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Promotion deleted"})
+	}
+}
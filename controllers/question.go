@@ -0,0 +1,327 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/moderation"
+)
+
+const (
+	maxQuestionLength       = 1000
+	maxAnswerLength         = 5000
+	defaultQuestionsPerPage = 10
+	maxQuestionsPerPage     = 50
+)
+
+var QuestionCollection *mongo.Collection = database.CollectionData(database.Client, "Questions")
+var AnswerCollection *mongo.Collection = database.CollectionData(database.Client, "Answers")
+
+func questionStatus(err error) int {
+	switch err {
+	case database.ErrQuestionNotFound, database.ErrAnswerNotFound, database.ErrCantFindProduct:
+		return http.StatusNotFound
+	case database.ErrAlreadyUpvoted:
+		return http.StatusConflict
+	case database.ErrCantUpvoteOwnAnswer:
+		return http.StatusForbidden
+	case database.ErrUserIdIsNotValid:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// bindText reads the {"text": ...} body of a question or answer.
+func bindText(c *gin.Context, max int) (string, bool) {
+	var body struct {
+		Text string `json:"text"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return "", false
+	}
+	text := strings.TrimSpace(body.Text)
+	if text == "" || len([]rune(text)) > max {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "text must be between 1 and " + strconv.Itoa(max) + " characters"})
+		return "", false
+	}
+	return text, true
+}
+
+// authorName is the name a customer's questions and answers are shown
+// under.
+func authorName(ctx context.Context, userCollection *mongo.Collection, userID string) (string, error) {
+	userObjectID, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		return "", database.ErrUserIdIsNotValid
+	}
+	var user models.Users
+	if err = userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: userObjectID}}).Decode(&user); err != nil {
+		return "", database.ErrUserIdIsNotValid
+	}
+	if user.First_Name == nil {
+		return "", nil
+	}
+	return *user.First_Name, nil
+}
+
+// loadQuestion reads the :id question, which must have been approved.
+func loadQuestion(ctx context.Context, c *gin.Context) (models.Question, bool) {
+	questionID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid question id"})
+		return models.Question{}, false
+	}
+	question, err := database.FindQuestion(ctx, QuestionCollection, questionID)
+	if err == nil && question.Status != models.ModerationApproved {
+		err = database.ErrQuestionNotFound
+	}
+	if err != nil {
+		c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+		return question, false
+	}
+	return question, true
+}
+
+// ProductQuestions lists a product's questions a page at a time with their
+// answers, staff answers first and then the most upvoted.
+func ProductQuestions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+			return
+		}
+		page, ok := queryInt(c, "page", 1, 0)
+		if !ok {
+			return
+		}
+		perPage, ok := queryInt(c, "per_page", defaultQuestionsPerPage, maxQuestionsPerPage)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, total, err := database.ProductQuestions(ctx, QuestionCollection, productID, page, perPage)
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		ids := make([]primitive.ObjectID, 0, len(list))
+		for _, question := range list {
+			ids = append(ids, question.Question_ID)
+		}
+		answers, err := database.QuestionAnswers(ctx, AnswerCollection, ids)
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		for i := range list {
+			list[i].Answers = answers[list[i].Question_ID]
+		}
+		c.JSON(http.StatusOK, gin.H{"questions": list, "page": page, "per_page": perPage, "total": total})
+	}
+}
+
+// AskQuestion posts the signed in user's question about a product. It is
+// shown once it has passed moderation.
+func (app *Application) AskQuestion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+			return
+		}
+		text, ok := bindText(c, maxQuestionLength)
+		if !ok {
+			return
+		}
+		userID := c.GetString("uid")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		author, err := authorName(ctx, app.userCollection, userID)
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		flags, status, err := screen(ctx, moderation.Content{Kind: moderation.KindQuestion, Author: userID, Text: text})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		question, err := database.CreateQuestion(ctx, QuestionCollection, app.prodCollection, models.Question{
+			Product_ID:  productID,
+			User_ID:     userID,
+			Author:      author,
+			Text:        text,
+			Status:      status,
+			Flags:       flags,
+			Fingerprint: moderation.Fingerprint(text),
+		})
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		logScreening(ctx, moderation.KindQuestion, question.Question_ID, productID, status, flags)
+		c.JSON(http.StatusCreated, question)
+	}
+}
+
+// AnswerQuestion posts the signed in user's answer to a question. Only
+// customers who have ordered the product may answer; their answers are
+// moderated like any other customer text.
+func (app *Application) AnswerQuestion() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		text, ok := bindText(c, maxAnswerLength)
+		if !ok {
+			return
+		}
+		userID := c.GetString("uid")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		question, ok := loadQuestion(ctx, c)
+		if !ok {
+			return
+		}
+		bought, err := database.HasPurchased(ctx, app.userCollection, userID, question.Product_ID)
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if !bought {
+			c.JSON(http.StatusForbidden, gin.H{"error": "only customers who bought this product can answer"})
+			return
+		}
+		author, err := authorName(ctx, app.userCollection, userID)
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		flags, status, err := screen(ctx, moderation.Content{Kind: moderation.KindAnswer, Author: userID, Text: text})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		answer, err := database.CreateAnswer(ctx, AnswerCollection, models.Answer{
+			Question_ID:       question.Question_ID,
+			Product_ID:        question.Product_ID,
+			User_ID:           userID,
+			Author:            author,
+			Text:              text,
+			Verified_Purchase: true,
+			Status:            status,
+			Flags:             flags,
+			Fingerprint:       moderation.Fingerprint(text),
+		})
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		logScreening(ctx, moderation.KindAnswer, answer.Answer_ID, answer.Product_ID, status, flags)
+		if err = database.RefreshAnswerCount(ctx, AnswerCollection, QuestionCollection, question.Question_ID); err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, answer)
+	}
+}
+
+// UpvoteAnswer records that the signed in user found an answer useful.
+func UpvoteAnswer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		answerID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid answer id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		answer, err := database.UpvoteAnswer(ctx, AnswerCollection, answerID, c.GetString("uid"))
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, answer)
+	}
+}
+
+// UnansweredQuestions is the staff queue of published questions still
+// waiting for an answer, oldest first.
+func UnansweredQuestions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.UnansweredQuestions(ctx, QuestionCollection)
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// StaffAnswer answers a question on behalf of the shop. Staff answers are
+// published straight away under the moderator header's name.
+func StaffAnswer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		text, ok := bindText(c, maxAnswerLength)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		question, ok := loadQuestion(ctx, c)
+		if !ok {
+			return
+		}
+		staff := moderator(c)
+		answer, err := database.CreateAnswer(ctx, AnswerCollection, models.Answer{
+			Question_ID: question.Question_ID,
+			Product_ID:  question.Product_ID,
+			Author:      staff,
+			Text:        text,
+			Staff:       true,
+			Status:      models.ModerationApproved,
+			Flags:       make([]models.ModerationFlag, 0),
+			Fingerprint: moderation.Fingerprint(text),
+		})
+		if err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		logModeration(ctx, models.ModerationAction{
+			Kind:       moderation.KindAnswer,
+			Target_ID:  answer.Answer_ID,
+			Product_ID: answer.Product_ID,
+			To:         models.ModerationApproved,
+			Moderator:  staff,
+			Note:       "staff answer",
+		})
+		if err = database.RefreshAnswerCount(ctx, AnswerCollection, QuestionCollection, question.Question_ID); err != nil {
+			c.JSON(questionStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, answer)
+	}
+}
@@ -0,0 +1,326 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/returns"
+)
+
+var ReturnCollection *mongo.Collection = database.CollectionData(database.Client, "Returns")
+var RefundCollection *mongo.Collection = database.CollectionData(database.Client, "Refunds")
+
+// ReturnWindow is how long after ordering a customer may ask for a return.
+// Set it in days with RETURN_WINDOW_DAYS.
+var ReturnWindow = returnWindow()
+
+func returnWindow() time.Duration {
+	days, err := strconv.Atoi(os.Getenv("RETURN_WINDOW_DAYS"))
+	if err != nil || days <= 0 {
+		days = 30
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func returnStatus(err error) int {
+	switch err {
+	case database.ErrReturnNotFound, database.ErrOrderNotFound:
+		return http.StatusNotFound
+	case database.ErrReturnStatusMoved, database.ErrOrderCancelled, returns.ErrBadTransition:
+		return http.StatusConflict
+	case returns.ErrWindowClosed, returns.ErrNoItems, returns.ErrNotInOrder, returns.ErrTooMany,
+		returns.ErrRefundTooLarge, returns.ErrInvalidQuantity, database.ErrUserIdIsNotValid:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// syncOrderReturns writes the returned units of an order back onto it from
+// its returns.
+func syncOrderReturns(ctx context.Context, r models.Return) error {
+	list, err := database.OrderReturns(ctx, ReturnCollection, r.Order_ID)
+	if err != nil {
+		return err
+	}
+	return database.SetOrderReturns(ctx, UserCollection, r.User_ID, r.Order_ID, returns.Summarize(list))
+}
+
+// RequestReturn lets the customer ask to send back units of one of their
+// orders while the return window is open.
+func (app *Application) RequestReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+			return
+		}
+		var body struct {
+			Items []models.ReturnItem `json:"items"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		userID := c.GetString("uid")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, _, err := database.FindOrder(ctx, app.userCollection, orderID, userID)
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		now := time.Now()
+		r := models.Return{Order_ID: orderID, User_ID: userID}
+		r, err = database.CreateReturn(ctx, app.userCollection, ReturnCollection, r, func(existing []models.Return) ([]models.ReturnItem, error) {
+			return returns.Check(order, existing, body.Items, now, ReturnWindow)
+		})
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, r)
+	}
+}
+
+func ListMyReturns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.UserReturns(ctx, ReturnCollection, c.GetString("uid"))
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// ListReturns is the admin queue, filtered with ?status=.
+func ListReturns() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.ListReturns(ctx, ReturnCollection, c.Query("status"))
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// loadReturn reads the :id return and checks it may move to status.
+func loadReturn(ctx context.Context, c *gin.Context, to string) (models.Return, bool) {
+	returnID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid return id"})
+		return models.Return{}, false
+	}
+	r, err := database.FindReturn(ctx, ReturnCollection, returnID)
+	if err != nil {
+		c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+		return r, false
+	}
+	if !returns.CanMove(r.Status, to) {
+		c.JSON(returnStatus(returns.ErrBadTransition), gin.H{"error": returns.ErrBadTransition.Error(), "status": r.Status})
+		return r, false
+	}
+	return r, true
+}
+
+func ApproveReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		r, ok := loadReturn(ctx, c, models.ReturnApproved)
+		if !ok {
+			return
+		}
+		r, err := database.MoveReturn(ctx, ReturnCollection, r.Return_ID, r.Status, models.ReturnApproved, nil)
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+func RejectReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Note string `json:"note"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		r, ok := loadReturn(ctx, c, models.ReturnRejected)
+		if !ok {
+			return
+		}
+		extra := bson.D{primitive.E{Key: "admin_note", Value: body.Note}}
+		r, err := database.MoveReturn(ctx, ReturnCollection, r.Return_ID, r.Status, models.ReturnRejected, extra)
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// ReceiveReturn marks the parcel as back in the warehouse, restocks the
+// units and shows them as returned on the order.
+func ReceiveReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		r, ok := loadReturn(ctx, c, models.ReturnReceived)
+		if !ok {
+			return
+		}
+		r, err := database.ReceiveReturn(ctx, ReturnCollection, ProductCollection, OutboxCollection, r.Return_ID, r.Status)
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err = syncOrderReturns(ctx, r); err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, r)
+	}
+}
+
+// refundableLeft is what is still unrefunded on the order of r, out of limit,
+// for telling an admin how much they may refund.
+func refundableLeft(ctx context.Context, r models.Return, limit models.Money) models.Money {
+	order, _, err := database.FindOrder(ctx, UserCollection, r.Order_ID, r.User_ID)
+	if err != nil || order.Refunded == nil {
+		return limit
+	}
+	left, err := limit.Sub(*order.Refunded)
+	if err != nil {
+		return limit
+	}
+	return left
+}
+
+// RefundReturn pays back a received return. The amount defaults to what the
+// items cost after discounts and tax; admins may refund less, but never more
+// than is left unrefunded on the order.
+func RefundReturn() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Amount *models.Money `json:"amount"`
+			Note   string        `json:"note"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&body); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		r, ok := loadReturn(ctx, c, models.ReturnRefunded)
+		if !ok {
+			return
+		}
+		order, _, err := database.FindOrder(ctx, UserCollection, r.Order_ID, r.User_ID)
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		amount, err := returns.RefundAmount(order, r.Items)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if body.Amount != nil {
+			if body.Amount.IsNegative() || body.Amount.Currency != amount.Currency {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "amount must be positive and in " + amount.Currency})
+				return
+			}
+			amount = *body.Amount
+		}
+
+		limit, err := returns.Refundable(order)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		refundID := primitive.NewObjectID()
+		r, err = database.MoveReturn(ctx, ReturnCollection, r.Return_ID, r.Status, models.ReturnRefunded, bson.D{primitive.E{Key: "refund_id", Value: refundID}})
+		if err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		// hand the return back so the refund can be tried again
+		unmove := func() {
+			if _, moveErr := database.MoveReturn(ctx, ReturnCollection, r.Return_ID, models.ReturnRefunded, models.ReturnReceived, bson.D{primitive.E{Key: "refund_id", Value: nil}}); moveErr != nil {
+				log.Println(moveErr)
+			}
+		}
+		if err = database.ReserveRefund(ctx, UserCollection, r.User_ID, r.Order_ID, amount, limit); err != nil {
+			unmove()
+			resp := gin.H{"error": err.Error()}
+			if err == returns.ErrRefundTooLarge {
+				resp["refundable"] = refundableLeft(ctx, r, limit)
+			}
+			c.JSON(returnStatus(err), resp)
+			return
+		}
+		refund, err := database.CreateRefund(ctx, RefundCollection, models.Refund{
+			Refund_ID: refundID,
+			Return_ID: r.Return_ID,
+			Order_ID:  r.Order_ID,
+			User_ID:   r.User_ID,
+			Amount:    amount,
+			Note:      body.Note,
+		})
+		if err != nil {
+			if releaseErr := database.ReleaseRefund(ctx, UserCollection, r.User_ID, r.Order_ID, amount); releaseErr != nil {
+				log.Println(releaseErr)
+			}
+			unmove()
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if err = syncOrderReturns(ctx, r); err != nil {
+			c.JSON(returnStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		// the credit note is issued now so it carries today's date; if this
+		// fails it is issued when the invoice is next fetched
+		if _, err = issueCreditNote(ctx, order, refund); err != nil {
+			log.Println(err)
+		}
+		c.JSON(http.StatusCreated, refund)
+	}
+}
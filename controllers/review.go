@@ -0,0 +1,290 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/moderation"
+	"github.com/mreym/shopping/reviews"
+)
+
+const (
+	defaultReviewsPerPage = 10
+	maxReviewsPerPage     = 50
+)
+
+var ReviewCollection *mongo.Collection = database.CollectionData(database.Client, "Reviews")
+
+func reviewStatus(err error) int {
+	switch err {
+	case database.ErrReviewNotFound, database.ErrCantFindProduct:
+		return http.StatusNotFound
+	case database.ErrAlreadyReviewed, database.ErrAlreadyVoted:
+		return http.StatusConflict
+	case database.ErrCantVoteOwnReview:
+		return http.StatusForbidden
+	case reviews.ErrInvalidRating, reviews.ErrTooLong, database.ErrUserIdIsNotValid:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+type reviewBody struct {
+	Rating int    `json:"rating"`
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+}
+
+func bindReview(c *gin.Context) (models.Review, bool) {
+	var body reviewBody
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return models.Review{}, false
+	}
+	review := models.Review{Rating: body.Rating, Title: body.Title, Body: body.Body}
+	if err := reviews.Clean(&review); err != nil {
+		c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+		return review, false
+	}
+	return review, true
+}
+
+func reviewParam(c *gin.Context) (primitive.ObjectID, bool) {
+	reviewID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid review id"})
+		return reviewID, false
+	}
+	return reviewID, true
+}
+
+func queryInt(c *gin.Context, name string, fallback, max int) (int, bool) {
+	value := c.Query(name)
+	if value == "" {
+		return fallback, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 || (max > 0 && n > max) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid " + name})
+		return 0, false
+	}
+	return n, true
+}
+
+// screenReview runs the review's text through the content filters and sets
+// the moderation status it starts in.
+func screenReview(ctx context.Context, review *models.Review) error {
+	text := review.Title + "\n" + review.Body
+	flags, status, err := screen(ctx, moderation.Content{
+		Kind:   moderation.KindReview,
+		ID:     review.Review_ID,
+		Author: review.User_ID,
+		Text:   text,
+	})
+	if err != nil {
+		return err
+	}
+	review.Flags = flags
+	review.Status = status
+	review.Fingerprint = moderation.Fingerprint(text)
+	return nil
+}
+
+// ProductReviews lists a product's reviews a page at a time, with its rating
+// summary. ?sort= is recent, helpful, rating_high or rating_low and
+// ?verified=true keeps only verified purchases.
+func ProductReviews() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+			return
+		}
+		page, ok := queryInt(c, "page", 1, 0)
+		if !ok {
+			return
+		}
+		perPage, ok := queryInt(c, "per_page", defaultReviewsPerPage, maxReviewsPerPage)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var product models.Product
+		err = ProductCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: productID}}).Decode(&product)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": database.ErrCantFindProduct.Error()})
+			return
+		}
+		summary := models.RatingSummary{}
+		if product.Rating_Summary != nil {
+			summary = *product.Rating_Summary
+		}
+
+		list, total, err := database.ProductReviews(ctx, ReviewCollection, productID, c.Query("verified") == "true", c.Query("sort"), page, perPage)
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"reviews": list, "page": page, "per_page": perPage, "total": total, "summary": summary})
+	}
+}
+
+// PostReview adds the signed in user's review of a product. It is marked as
+// a verified purchase when one of their orders contains the product, and is
+// shown once it has passed moderation.
+func (app *Application) PostReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+			return
+		}
+		review, ok := bindReview(c)
+		if !ok {
+			return
+		}
+		userID := c.GetString("uid")
+		userObjectID, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.Users
+		err = app.userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: userObjectID}}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		verified, err := database.HasPurchased(ctx, app.userCollection, userID, productID)
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+
+		// the id is known before screening, so the moderation log and the
+		// duplicate filter see the review as it will be saved
+		review.Review_ID = primitive.NewObjectID()
+		review.Product_ID = productID
+		review.User_ID = userID
+		if user.First_Name != nil {
+			review.Author = *user.First_Name
+		}
+		review.Verified_Purchase = verified
+		if err = screenReview(ctx, &review); err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		review, err = database.CreateReview(ctx, ReviewCollection, app.prodCollection, review)
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		logScreening(ctx, moderation.KindReview, review.Review_ID, review.Product_ID, review.Status, review.Flags)
+		summary, err := database.RefreshRating(ctx, ReviewCollection, app.prodCollection, productID)
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"review": review, "summary": summary})
+	}
+}
+
+// UpdateReview edits the user's review. The new text is moderated again.
+func UpdateReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewID, ok := reviewParam(c)
+		if !ok {
+			return
+		}
+		review, ok := bindReview(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		review.Review_ID = reviewID
+		if err := screenReview(ctx, &review); err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		review, err := database.UpdateReview(ctx, ReviewCollection, reviewID, c.GetString("uid"), review)
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		logScreening(ctx, moderation.KindReview, review.Review_ID, review.Product_ID, review.Status, review.Flags)
+		summary, err := database.RefreshRating(ctx, ReviewCollection, ProductCollection, review.Product_ID)
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"review": review, "summary": summary})
+	}
+}
+
+func DeleteReview() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewID, ok := reviewParam(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		review, err := database.DeleteReview(ctx, ReviewCollection, reviewID, c.GetString("uid"))
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		summary, err := database.RefreshRating(ctx, ReviewCollection, ProductCollection, review.Product_ID)
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Review deleted", "summary": summary})
+	}
+}
+
+// VoteReviewHelpful records that the signed in user found a review helpful.
+// Each user counts once and nobody can vote on their own review.
+func VoteReviewHelpful() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		reviewID, ok := reviewParam(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := database.VoteHelpful(ctx, ReviewCollection, reviewID, c.GetString("uid")); err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		review, err := database.FindReview(ctx, ReviewCollection, reviewID)
+		if err != nil {
+			c.JSON(reviewStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, review)
+	}
+}
@@ -0,0 +1,65 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+
+	"github.com/mreym/shopping/search"
+)
+
+const defaultSuggestLimit = 10
+
+var SearchIndex = search.NewIndex()
+
+// RefreshSearchIndex reloads product names and categories from the catalog
+// into the suggestion index. It is called at startup and after product writes.
+func RefreshSearchIndex(ctx context.Context) error {
+	names, err := ProductCollection.Distinct(ctx, "product_name", bson.D{})
+	if err != nil {
+		return err
+	}
+
+	categories, err := ProductCollection.Distinct(ctx, "category", bson.D{})
+	if err != nil {
+		return err
+	}
+
+	SearchIndex.Load(toStrings(names), toStrings(categories))
+	return nil
+}
+
+func toStrings(values []interface{}) []string {
+	out := make([]string, 0, len(values))
+	for _, v := range values {
+		if s, ok := v.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+func SearchSuggest() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := c.Query("q")
+		if query == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "query is empty"})
+			return
+		}
+
+		limit := defaultSuggestLimit
+		if l := c.Query("limit"); l != "" {
+			n, err := strconv.Atoi(l)
+			if err != nil || n <= 0 || n > 50 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "invalid limit"})
+				return
+			}
+			limit = n
+		}
+
+		c.JSON(http.StatusOK, gin.H{"query": query, "suggestions": SearchIndex.Suggest(query, limit)})
+	}
+}
@@ -0,0 +1,217 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+)
+
+var ShipmentCollection *mongo.Collection = database.CollectionData(database.Client, "Shipments")
+
+var shipmentStatuses = map[string]bool{
+	models.ShipmentLabelCreated:   true,
+	models.ShipmentInTransit:      true,
+	models.ShipmentOutForDelivery: true,
+	models.ShipmentDelivered:      true,
+	models.ShipmentException:      true,
+}
+
+func orderHasProduct(order models.Order, productID primitive.ObjectID) bool {
+	for _, item := range order.Order_Cart {
+		if item.Product_ID == productID {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateShipment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			Order_ID        string   `json:"order_id"`
+			Carrier         string   `json:"carrier"`
+			Tracking_Number string   `json:"tracking_number"`
+			Items           []string `json:"items"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		orderID, err := primitive.ObjectIDFromHex(body.Order_ID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+			return
+		}
+		if strings.TrimSpace(body.Carrier) == "" || strings.TrimSpace(body.Tracking_Number) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "carrier and tracking_number are required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		order, ownerID, err := database.FindOrder(ctx, UserCollection, orderID, "")
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if order.Cancelled_At != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": database.ErrOrderCancelled.Error()})
+			return
+		}
+
+		shipment := models.Shipment{
+			Order_ID:        orderID,
+			User_ID:         ownerID,
+			Carrier:         strings.TrimSpace(body.Carrier),
+			Tracking_Number: strings.TrimSpace(body.Tracking_Number),
+		}
+		for _, item := range body.Items {
+			productID, err := primitive.ObjectIDFromHex(item)
+			if err != nil || !orderHasProduct(order, productID) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "item " + item + " is not part of the order"})
+				return
+			}
+			shipment.Items = append(shipment.Items, productID)
+		}
+
+		shipment, err = database.CreateShipment(ctx, UserCollection, ShipmentCollection, shipment)
+		if err == database.ErrOrderCancelled {
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		notifyShipment(ctx, shipment, shipment.Events[0])
+		c.JSON(http.StatusCreated, shipment)
+	}
+}
+
+func UpdateShipment() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shipmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment id"})
+			return
+		}
+		var body struct {
+			Carrier         string `json:"carrier"`
+			Tracking_Number string `json:"tracking_number"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(body.Carrier) == "" || strings.TrimSpace(body.Tracking_Number) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "carrier and tracking_number are required"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = database.UpdateShipmentCarrier(ctx, ShipmentCollection, shipmentID, strings.TrimSpace(body.Carrier), strings.TrimSpace(body.Tracking_Number))
+		if err == database.ErrShipmentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Shipment updated"})
+	}
+}
+
+func AddShipmentEvent() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shipmentID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipment id"})
+			return
+		}
+		var event models.ShipmentEvent
+		if err := c.BindJSON(&event); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !shipmentStatuses[event.Status] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unknown shipment status"})
+			return
+		}
+		if event.Occurred_At.IsZero() {
+			event.Occurred_At = time.Now()
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		shipment, err := database.AddShipmentEvent(ctx, ShipmentCollection, shipmentID, event)
+		if err == database.ErrShipmentNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		notifyShipment(ctx, shipment, event)
+		c.JSON(http.StatusOK, shipment)
+	}
+}
+
+func ListOrderShipments() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		shipments, err := database.OrderShipments(ctx, ShipmentCollection, orderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, shipments)
+	}
+}
+
+// OrderTracking shows the signed in user where the parcels of their order are.
+func (app *Application) OrderTracking() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		orderID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, _, err = database.FindOrder(ctx, app.userCollection, orderID, c.GetString("uid")); err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+
+		shipments, err := database.OrderShipments(ctx, ShipmentCollection, orderID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"order_id": orderID, "shipments": shipments})
+	}
+}
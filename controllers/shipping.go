@@ -0,0 +1,136 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/shipping"
+)
+
+var ShippingCollection *mongo.Collection = database.CollectionData(database.Client, "ShippingRates")
+
+// shippingOptions lists how the lines can be shipped to the address, and
+// whether any shipping rates are configured at all. A free shipping coupon
+// makes every option free.
+func shippingOptions(ctx context.Context, lines []models.ProductUser, address *models.Address, free bool) ([]shipping.Option, bool, error) {
+	rates, err := database.ListShippingRates(ctx, ShippingCollection)
+	if err != nil {
+		return nil, false, err
+	}
+
+	pincode := ""
+	if address != nil && address.Pincode != nil {
+		pincode = *address.Pincode
+	}
+	options := shipping.Options(rates, shipping.CartWeight(lines), pincode)
+	if free {
+		for i := range options {
+			options[i].Cost = models.ZeroMoney(options[i].Cost.Currency)
+		}
+	}
+	return options, len(rates) > 0, nil
+}
+
+// ShippingOptions lists the shipping methods available for the signed in
+// user's cart and what each costs.
+func (app *Application) ShippingOptions() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userObjectID, err := primitive.ObjectIDFromHex(c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.Users
+		err = app.userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: userObjectID}}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		lines, _, err := database.RepriceCart(ctx, app.prodCollection, user.UserCart)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		quote, err := quoteCart(ctx, &user, lines, shippingAddress(&user), "", true)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"weight_grams": shipping.CartWeight(lines), "options": quote.Shipping_Options})
+	}
+}
+
+func CreateShippingRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rate models.ShippingRate
+		if err := c.BindJSON(&rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := shipping.Check(rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		id, err := database.CreateShippingRate(ctx, ShippingCollection, rate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Shipping rate created", "id": id})
+	}
+}
+
+func ListShippingRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rates, err := database.ListShippingRates(ctx, ShippingCollection)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, rates)
+	}
+}
+
+func DeleteShippingRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rateID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping rate id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = database.DeleteShippingRate(ctx, ShippingCollection, rateID)
+		if err == database.ErrShippingRateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Shipping rate deleted"})
+	}
+}
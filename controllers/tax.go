@@ -0,0 +1,89 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/tax"
+)
+
+var TaxCollection *mongo.Collection = database.CollectionData(database.Client, "TaxRates")
+
+// PricesIncludeTax is true when catalog prices already contain tax, so tax is
+// reported but not added to the total.
+var PricesIncludeTax = os.Getenv("PRICES_INCLUDE_TAX") == "true"
+
+// shippingAddress is the address an order for the user goes to.
+func shippingAddress(user *models.Users) *models.Address {
+	return defaultAddress(user, database.DefaultShipping)
+}
+
+func CreateTaxRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var rate models.TaxRate
+		if err := c.BindJSON(&rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := tax.Check(rate); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		id, err := database.CreateTaxRate(ctx, TaxCollection, rate)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"message": "Tax rate created", "id": id})
+	}
+}
+
+func ListTaxRates() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		rates, err := database.ListTaxRates(ctx, TaxCollection)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"prices_include_tax": PricesIncludeTax, "rates": rates})
+	}
+}
+
+func DeleteTaxRate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rateID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rate id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err = database.DeleteTaxRate(ctx, TaxCollection, rateID)
+		if err == database.ErrTaxRateNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Tax rate deleted"})
+	}
+}
@@ -0,0 +1,344 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/outbox"
+	"github.com/mreym/shopping/webhooks"
+)
+
+const (
+	webhookPollInterval = 2 * time.Second
+	webhookLease        = time.Minute
+	webhookMaxAttempts  = 8
+	webhookMinBackoff   = 10 * time.Second
+	webhookMaxBackoff   = 6 * time.Hour
+
+	defaultDeliveriesLimit = 50
+	maxDeliveriesLimit     = 500
+)
+
+var WebhookCollection *mongo.Collection = database.CollectionData(database.Client, "Webhooks")
+var WebhookDeliveryCollection *mongo.Collection = database.CollectionData(database.Client, "WebhookDeliveries")
+
+// WebhookClient sends the deliveries. Its timeout bounds each attempt.
+var WebhookClient = &http.Client{Timeout: 10 * time.Second}
+
+func webhookStatus(err error) int {
+	switch {
+	case err == database.ErrWebhookNotFound, err == database.ErrDeliveryNotFound:
+		return http.StatusNotFound
+	case err == database.ErrDeliveryInProgress:
+		return http.StatusConflict
+	case err == webhooks.ErrInvalidURL, err == webhooks.ErrNoEvents, errors.Is(err, webhooks.ErrUnknownEvent):
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// queueWebhooks hands an outbox event to every webhook subscribed to it.
+func queueWebhooks(ctx context.Context, event events.Event) error {
+	msg, ok := outbox.Message(ctx)
+	if !ok {
+		return errors.New("webhooks: event is not from the outbox")
+	}
+	hooks, err := database.SubscribedWebhooks(ctx, WebhookCollection, event.Type())
+	if err != nil || len(hooks) == 0 {
+		return err
+	}
+	payload, err := webhooks.Encode(msg.Message_ID.Hex(), msg.Created_At, event)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		err = database.QueueWebhookDelivery(ctx, WebhookDeliveryCollection, models.WebhookDelivery{
+			Webhook_ID: hook.Webhook_ID,
+			Message_ID: msg.Message_ID,
+			Event_Type: event.Type(),
+			Payload:    payload,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeliverWebhooks sends queued deliveries until ctx is done, retrying failed
+// ones with exponential backoff. main runs it in the background.
+func DeliverWebhooks(ctx context.Context) {
+	for {
+		delivery, err := database.ClaimWebhookDelivery(ctx, WebhookDeliveryCollection, webhookLease)
+		if err == nil {
+			sendWebhook(ctx, delivery)
+			continue
+		}
+		if err != database.ErrNoDeliveriesDue {
+			log.Println(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(webhookPollInterval):
+		}
+	}
+}
+
+func sendWebhook(ctx context.Context, delivery models.WebhookDelivery) {
+	var attempt models.WebhookAttempt
+	delivered := false
+	hook, err := database.FindWebhook(ctx, WebhookCollection, delivery.Webhook_ID)
+	switch {
+	case err == database.ErrWebhookNotFound:
+		attempt = models.WebhookAttempt{At: time.Now(), Error: "the webhook was deleted"}
+		delivery.Attempts = webhookMaxAttempts
+	case err != nil:
+		attempt = models.WebhookAttempt{At: time.Now(), Error: err.Error()}
+	case !hook.Active:
+		attempt = models.WebhookAttempt{At: time.Now(), Error: "the webhook is disabled"}
+		delivery.Attempts = webhookMaxAttempts
+	default:
+		attempt, delivered = webhooks.Send(ctx, WebhookClient, hook, delivery)
+	}
+
+	status := models.WebhookDelivered
+	next := attempt.At
+	if !delivered {
+		status = models.WebhookFailed
+		if delivery.Attempts < webhookMaxAttempts {
+			status = models.WebhookPending
+			next = time.Now().Add(outbox.Backoff(delivery.Attempts, webhookMinBackoff, webhookMaxBackoff))
+		}
+		log.Printf("webhook delivery %s to %s: %s", delivery.Delivery_ID.Hex(), hook.URL, attempt.Error)
+	}
+	if err = database.RecordWebhookAttempt(ctx, WebhookDeliveryCollection, delivery.Delivery_ID, attempt, status, next); err != nil {
+		log.Println(err)
+	}
+}
+
+func webhookParam(c *gin.Context) (primitive.ObjectID, bool) {
+	webhookID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid webhook id"})
+		return webhookID, false
+	}
+	return webhookID, true
+}
+
+func ListWebhooks() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		list, err := database.ListWebhooks(ctx, WebhookCollection)
+		if err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"webhooks": list, "events": webhooks.Events})
+	}
+}
+
+// CreateWebhook registers an endpoint for the given event types. The signing
+// secret is only shown in this response.
+func CreateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var body struct {
+			URL         string   `json:"url"`
+			Events      []string `json:"events"`
+			Description string   `json:"description"`
+			Active      *bool    `json:"active"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		hook := models.Webhook{URL: body.URL, Events: body.Events, Description: body.Description, Active: true}
+		if body.Active != nil {
+			hook.Active = *body.Active
+		}
+		if err := webhooks.Check(&hook); err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		hook.Secret = secret
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		hook, err = database.CreateWebhook(ctx, WebhookCollection, hook)
+		if err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, gin.H{"webhook": hook, "secret": secret})
+	}
+}
+
+// UpdateWebhook changes the url, events, description or active flag of a
+// webhook; fields left out stay as they are.
+func UpdateWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, ok := webhookParam(c)
+		if !ok {
+			return
+		}
+		var body struct {
+			URL         *string  `json:"url"`
+			Events      []string `json:"events"`
+			Description *string  `json:"description"`
+			Active      *bool    `json:"active"`
+		}
+		if err := c.BindJSON(&body); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		hook, err := database.FindWebhook(ctx, WebhookCollection, webhookID)
+		if err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		if body.URL != nil {
+			hook.URL = *body.URL
+		}
+		if body.Events != nil {
+			hook.Events = body.Events
+		}
+		if body.Description != nil {
+			hook.Description = *body.Description
+		}
+		if body.Active != nil {
+			hook.Active = *body.Active
+		}
+		if err = webhooks.Check(&hook); err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		hook, err = database.UpdateWebhook(ctx, WebhookCollection, webhookID, bson.D{
+			primitive.E{Key: "url", Value: hook.URL},
+			primitive.E{Key: "events", Value: hook.Events},
+			primitive.E{Key: "description", Value: hook.Description},
+			primitive.E{Key: "active", Value: hook.Active},
+		})
+		if err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, hook)
+	}
+}
+
+func DeleteWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, ok := webhookParam(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := database.DeleteWebhook(ctx, WebhookCollection, webhookID); err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted"})
+	}
+}
+
+// RotateWebhookSecret gives a webhook a new signing secret. Deliveries sent
+// from now on are signed with it.
+func RotateWebhookSecret() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, ok := webhookParam(c)
+		if !ok {
+			return
+		}
+		secret, err := webhooks.NewSecret()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		hook, err := database.UpdateWebhook(ctx, WebhookCollection, webhookID, bson.D{primitive.E{Key: "secret", Value: secret}})
+		if err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"webhook": hook, "secret": secret})
+	}
+}
+
+// ListWebhookDeliveries shows a webhook's latest deliveries with every
+// attempt, filtered with ?status=, e.g. failed.
+func ListWebhookDeliveries() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		webhookID, ok := webhookParam(c)
+		if !ok {
+			return
+		}
+		limit, ok := queryInt(c, "limit", defaultDeliveriesLimit, maxDeliveriesLimit)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if _, err := database.FindWebhook(ctx, WebhookCollection, webhookID); err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		list, err := database.WebhookDeliveries(ctx, WebhookDeliveryCollection, webhookID, c.Query("status"), int64(limit))
+		if err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, list)
+	}
+}
+
+// RedeliverWebhook sends a delivery again, with a fresh set of attempts.
+func RedeliverWebhook() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		deliveryID, err := primitive.ObjectIDFromHex(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid delivery id"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		delivery, err := database.RedeliverWebhook(ctx, WebhookDeliveryCollection, deliveryID)
+		if err != nil {
+			c.JSON(webhookStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusAccepted, delivery)
+	}
+}
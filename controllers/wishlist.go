@@ -0,0 +1,374 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/models"
+)
+
+var WishlistCollection *mongo.Collection = database.CollectionData(database.Client, "Wishlists")
+
+const maxWishlistName = 60
+
+type wishlistRequest struct {
+	Name   string `json:"name"`
+	Public bool   `json:"public"`
+}
+
+func bindWishlist(c *gin.Context) (wishlistRequest, bool) {
+	var body wishlistRequest
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return body, false
+	}
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Name == "" || len(body.Name) > maxWishlistName {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "name is required and must be at most 60 characters"})
+		return body, false
+	}
+	return body, true
+}
+
+func wishlistStatus(err error) int {
+	switch err {
+	case database.ErrWishlistNotFound, database.ErrItemNotInWishlist, database.ErrItemNotInCart, database.ErrItemNotSaved, database.ErrCantFindProduct:
+		return http.StatusNotFound
+	case database.ErrTooManyWishlists, database.ErrUserIdIsNotValid:
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// wishlistParams reads the :id and, when present, :product path parameters.
+func wishlistParams(c *gin.Context) (primitive.ObjectID, primitive.ObjectID, bool) {
+	var productID primitive.ObjectID
+	wishlistID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wishlist id"})
+		return wishlistID, productID, false
+	}
+	if c.Param("product") != "" {
+		if productID, err = primitive.ObjectIDFromHex(c.Param("product")); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+			return wishlistID, productID, false
+		}
+	}
+	return wishlistID, productID, true
+}
+
+func CreateWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body, ok := bindWishlist(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		wishlist, err := database.CreateWishlist(ctx, WishlistCollection, c.GetString("uid"), body.Name, body.Public)
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, wishlist)
+	}
+}
+
+func ListWishlists() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		wishlists, err := database.ListWishlists(ctx, WishlistCollection, c.GetString("uid"))
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, wishlists)
+	}
+}
+
+func GetWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, _, ok := wishlistParams(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		wishlist, err := database.FindWishlist(ctx, WishlistCollection, wishlistID, c.GetString("uid"))
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, wishlist)
+	}
+}
+
+// SharedWishlist shows a public wishlist to anyone with its share link. Only
+// the name and items are shown, not who owns it.
+func SharedWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		wishlist, err := database.SharedWishlist(ctx, WishlistCollection, c.Param("token"))
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"name": wishlist.Name, "items": wishlist.Items, "updated_at": wishlist.Updated_At})
+	}
+}
+
+func UpdateWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, _, ok := wishlistParams(c)
+		if !ok {
+			return
+		}
+		body, ok := bindWishlist(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := database.UpdateWishlist(ctx, WishlistCollection, wishlistID, c.GetString("uid"), body.Name, body.Public)
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Wishlist updated"})
+	}
+}
+
+// ShareWishlist issues a new share token, which stops old links working.
+func ShareWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, _, ok := wishlistParams(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		token, err := database.RotateShareToken(ctx, WishlistCollection, wishlistID, c.GetString("uid"))
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"share_token": token, "share_path": "/wishlists/shared/" + token})
+	}
+}
+
+func DeleteWishlist() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, _, ok := wishlistParams(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := database.DeleteWishlist(ctx, WishlistCollection, wishlistID, c.GetString("uid"))
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully Deleted"})
+	}
+}
+
+func (app *Application) AddWishlistItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, productID, ok := wishlistParams(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := database.AddWishlistItem(ctx, app.prodCollection, WishlistCollection, wishlistID, c.GetString("uid"), productID)
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Added to the wishlist"})
+	}
+}
+
+func RemoveWishlistItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, productID, ok := wishlistParams(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		err := database.RemoveWishlistItem(ctx, WishlistCollection, wishlistID, c.GetString("uid"), productID)
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Removed from the wishlist"})
+	}
+}
+
+// WishlistItemToCart adds a wishlist product to the cart at today's price.
+// The product stays on the wishlist unless ?remove=true.
+func (app *Application) WishlistItemToCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		wishlistID, productID, ok := wishlistParams(c)
+		if !ok {
+			return
+		}
+		userID := c.GetString("uid")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		wishlist, err := database.FindWishlist(ctx, WishlistCollection, wishlistID, userID)
+		if err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		onList := false
+		for _, item := range wishlist.Items {
+			onList = onList || item.Product_ID == productID
+		}
+		if !onList {
+			c.JSON(http.StatusNotFound, gin.H{"error": database.ErrItemNotInWishlist.Error()})
+			return
+		}
+
+		if err = database.AddProductToCart(ctx, app.prodCollection, app.userCollection, productID, userID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if c.Query("remove") == "true" {
+			if err = database.RemoveWishlistItem(ctx, WishlistCollection, wishlistID, userID, productID); err != nil {
+				c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+				return
+			}
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully added to the cart"})
+	}
+}
+
+func savedItemParam(c *gin.Context) (primitive.ObjectID, bool) {
+	productID, err := primitive.ObjectIDFromHex(c.Param("product"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product id"})
+		return productID, false
+	}
+	return productID, true
+}
+
+func (app *Application) ListSavedForLater() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userObjectID, err := primitive.ObjectIDFromHex(c.GetString("uid"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user"})
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		var user models.Users
+		err = app.userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: userObjectID}}).Decode(&user)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+		saved := user.Saved_For_Later
+		if saved == nil {
+			saved = make([]models.ProductUser, 0)
+		}
+		total, err := database.CartTotal(saved)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		displayTotal, err := convertCart(ctx, displayCurrency(c, &user), saved, total)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"total": total, "displayTotal": displayTotal, "items": saved})
+	}
+}
+
+// SaveForLater moves a product out of the cart without losing it.
+func (app *Application) SaveForLater() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := savedItemParam(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := database.SaveForLater(ctx, app.userCollection, c.GetString("uid"), productID); err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Saved for later"})
+	}
+}
+
+func (app *Application) MoveSavedToCart() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := savedItemParam(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := database.MoveToCart(ctx, app.userCollection, c.GetString("uid"), productID); err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Moved back to the cart"})
+	}
+}
+
+func (app *Application) RemoveSavedItem() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		productID, ok := savedItemParam(c)
+		if !ok {
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		if err := database.RemoveSavedItem(ctx, app.userCollection, c.GetString("uid"), productID); err != nil {
+			c.JSON(wishlistStatus(err), gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Successfully Deleted"})
+	}
+}
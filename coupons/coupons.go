@@ -0,0 +1,142 @@
+package coupons
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrInvalidCoupon   = errors.New("this coupon is not valid")
+	ErrNotStarted      = errors.New("this coupon is not active yet")
+	ErrExpired         = errors.New("this coupon has expired")
+	ErrUsedUp          = errors.New("this coupon has reached its usage limit")
+	ErrBelowMinimum    = errors.New("the cart value is below the coupon minimum")
+	ErrNoEligibleItems = errors.New("no item in the cart is eligible for this coupon")
+)
+
+type Result struct {
+	Discount      models.Money `json:"discount"`
+	Free_Shipping bool         `json:"free_shipping"`
+}
+
+// NormalizeCode makes coupon codes case and whitespace insensitive.
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Check validates the coupon definition itself, for admins creating one.
+func Check(c models.Coupon) error {
+	if c.Code == "" {
+		return ErrInvalidCoupon
+	}
+	switch c.Type {
+	case models.CouponPercentage:
+		if c.Percent <= 0 || c.Percent > 10000 {
+			return errors.New("percent must be between 1 and 10000 basis points")
+		}
+	case models.CouponFixed:
+		if c.Amount == nil || c.Amount.Amount <= 0 {
+			return errors.New("fixed coupons need a positive amount")
+		}
+	case models.CouponFreeShipping:
+	default:
+		return errors.New("unknown coupon type")
+	}
+	// carts are priced in the store currency, so amounts compared with or
+	// taken off them must be too
+	if (c.Amount != nil && c.Amount.Currency != models.DefaultCurrency) || (c.Min_Cart_Value != nil && c.Min_Cart_Value.Currency != models.DefaultCurrency) {
+		return errors.New("amount and min_cart_value must be in " + models.DefaultCurrency)
+	}
+	if c.Per_User_Limit < 0 || c.Global_Limit < 0 {
+		return errors.New("usage limits cannot be negative")
+	}
+	if c.Valid_From != nil && c.Valid_Until != nil && c.Valid_Until.Before(*c.Valid_From) {
+		return errors.New("valid_until is before valid_from")
+	}
+	return nil
+}
+
+// Usable reports whether userID may still redeem the coupon at now.
+func Usable(c models.Coupon, userID string, now time.Time) error {
+	if c.Valid_From != nil && now.Before(*c.Valid_From) {
+		return ErrNotStarted
+	}
+	if c.Valid_Until != nil && now.After(*c.Valid_Until) {
+		return ErrExpired
+	}
+	if c.Global_Limit > 0 && c.Used_Count >= c.Global_Limit {
+		return ErrUsedUp
+	}
+	if c.Per_User_Limit > 0 && c.Used_By[userID] >= c.Per_User_Limit {
+		return ErrUsedUp
+	}
+	return nil
+}
+
+func eligible(c models.Coupon, item models.ProductUser) bool {
+	if len(c.Product_IDs) == 0 && len(c.Categories) == 0 {
+		return true
+	}
+	for _, id := range c.Product_IDs {
+		if id == item.Product_ID {
+			return true
+		}
+	}
+	if item.Category != nil {
+		for _, category := range c.Categories {
+			if strings.EqualFold(category, *item.Category) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Apply computes what the coupon takes off the cart. The minimum cart value is
+// checked against the whole cart, the discount only against eligible lines,
+// and a discount never exceeds what those lines cost.
+func Apply(c models.Coupon, cart []models.ProductUser, subtotal models.Money) (Result, error) {
+	result := Result{Discount: models.ZeroMoney(subtotal.Currency)}
+
+	if c.Min_Cart_Value != nil {
+		remaining, err := subtotal.Sub(*c.Min_Cart_Value)
+		if err != nil {
+			return result, err
+		}
+		if remaining.IsNegative() {
+			return result, ErrBelowMinimum
+		}
+	}
+
+	eligibleTotal := models.ZeroMoney(subtotal.Currency)
+	matched := false
+	for _, item := range cart {
+		if !eligible(c, item) {
+			continue
+		}
+		matched = true
+		var err error
+		if eligibleTotal, err = eligibleTotal.Add(item.Price); err != nil {
+			return result, err
+		}
+	}
+	if !matched {
+		return result, ErrNoEligibleItems
+	}
+
+	var err error
+	switch c.Type {
+	case models.CouponPercentage:
+		result.Discount, err = eligibleTotal.Percent(c.Percent)
+	case models.CouponFixed:
+		result.Discount, err = c.Amount.Min(eligibleTotal)
+	case models.CouponFreeShipping:
+		result.Free_Shipping = true
+	default:
+		err = ErrInvalidCoupon
+	}
+	return result, err
+}
@@ -0,0 +1,104 @@
+package coupons
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+func inr(amount int64) *models.Money {
+	m := models.NewMoney(amount, "INR")
+	return &m
+}
+
+func item(id primitive.ObjectID, category string, price int64) models.ProductUser {
+	return models.ProductUser{Product_ID: id, Category: &category, Price: *inr(price)}
+}
+
+func TestCheck(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	until := from.Add(-time.Hour)
+	tests := []struct {
+		name    string
+		coupon  models.Coupon
+		wantErr bool
+	}{
+		{"percentage", models.Coupon{Code: "TEN", Type: models.CouponPercentage, Percent: 1000}, false},
+		{"fixed", models.Coupon{Code: "FIFTY", Type: models.CouponFixed, Amount: inr(5000)}, false},
+		{"free shipping", models.Coupon{Code: "SHIP", Type: models.CouponFreeShipping}, false},
+		{"no code", models.Coupon{Type: models.CouponFreeShipping}, true},
+		{"unknown type", models.Coupon{Code: "X", Type: "bogus"}, true},
+		{"percent zero", models.Coupon{Code: "X", Type: models.CouponPercentage}, true},
+		{"percent over 100%", models.Coupon{Code: "X", Type: models.CouponPercentage, Percent: 10001}, true},
+		{"fixed without amount", models.Coupon{Code: "X", Type: models.CouponFixed}, true},
+		{"fixed negative", models.Coupon{Code: "X", Type: models.CouponFixed, Amount: inr(-1)}, true},
+		{"other currency", models.Coupon{Code: "X", Type: models.CouponFixed, Amount: &models.Money{Amount: 100, Currency: "USD"}}, true},
+		{"minimum in other currency", models.Coupon{Code: "X", Type: models.CouponFreeShipping, Min_Cart_Value: &models.Money{Amount: 100, Currency: "USD"}}, true},
+		{"negative limit", models.Coupon{Code: "X", Type: models.CouponFreeShipping, Per_User_Limit: -1}, true},
+		{"ends before it starts", models.Coupon{Code: "X", Type: models.CouponFreeShipping, Valid_From: &from, Valid_Until: &until}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check(tt.coupon); (err != nil) != tt.wantErr {
+				t.Errorf("Check() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	shoe, shirt := primitive.NewObjectID(), primitive.NewObjectID()
+	cart := []models.ProductUser{item(shoe, "Shoes", 40000), item(shirt, "Shirts", 10000)}
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		want   Result
+		err    error
+	}{
+		{"percentage of the cart", models.Coupon{Type: models.CouponPercentage, Percent: 1000}, Result{Discount: *inr(5000)}, nil},
+		{"percentage of a category", models.Coupon{Type: models.CouponPercentage, Percent: 1000, Categories: []string{"shirts"}}, Result{Discount: *inr(1000)}, nil},
+		{"fixed on a product", models.Coupon{Type: models.CouponFixed, Amount: inr(500), Product_IDs: []primitive.ObjectID{shoe}}, Result{Discount: *inr(500)}, nil},
+		{"fixed capped at the eligible lines", models.Coupon{Type: models.CouponFixed, Amount: inr(20000), Product_IDs: []primitive.ObjectID{shirt}}, Result{Discount: *inr(10000)}, nil},
+		{"free shipping", models.Coupon{Type: models.CouponFreeShipping}, Result{Discount: *inr(0), Free_Shipping: true}, nil},
+		{"minimum met", models.Coupon{Type: models.CouponFreeShipping, Min_Cart_Value: inr(50000)}, Result{Discount: *inr(0), Free_Shipping: true}, nil},
+		{"below minimum", models.Coupon{Type: models.CouponFreeShipping, Min_Cart_Value: inr(50001)}, Result{Discount: *inr(0)}, ErrBelowMinimum},
+		{"nothing eligible", models.Coupon{Type: models.CouponPercentage, Percent: 1000, Categories: []string{"Hats"}}, Result{Discount: *inr(0)}, ErrNoEligibleItems},
+		{"unknown type", models.Coupon{Type: "bogus"}, Result{Discount: *inr(0)}, ErrInvalidCoupon},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Apply(tt.coupon, cart, *inr(50000))
+			if err != tt.err || got != tt.want {
+				t.Errorf("Apply() = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestUsable(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	before, after := now.Add(-time.Hour), now.Add(time.Hour)
+	tests := []struct {
+		name   string
+		coupon models.Coupon
+		err    error
+	}{
+		{"no limits", models.Coupon{}, nil},
+		{"within dates", models.Coupon{Valid_From: &before, Valid_Until: &after}, nil},
+		{"not started", models.Coupon{Valid_From: &after}, ErrNotStarted},
+		{"expired", models.Coupon{Valid_Until: &before}, ErrExpired},
+		{"global limit reached", models.Coupon{Global_Limit: 2, Used_Count: 2}, ErrUsedUp},
+		{"user limit reached", models.Coupon{Per_User_Limit: 1, Used_By: map[string]int{"u1": 1}}, ErrUsedUp},
+		{"another user's use", models.Coupon{Per_User_Limit: 1, Used_By: map[string]int{"u2": 1}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Usable(tt.coupon, "u1", now); err != tt.err {
+				t.Errorf("Usable() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package currency
+
+import (
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrUnknownCurrency = errors.New("no exchange rate for this currency")
+	ErrInvalidRate     = errors.New("exchange rate must be a positive decimal")
+)
+
+// ParseRate reads a decimal rate such as "0.0119" exactly.
+func ParseRate(rate string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(rate))
+	if !ok || r.Sign() <= 0 {
+		return nil, ErrInvalidRate
+	}
+	return r, nil
+}
+
+// Convert turns m into the target currency using rate (units of the target per
+// unit of m's currency), adjusting for the two currencies' minor units.
+func Convert(m models.Money, rate *big.Rat, to string) (models.Money, error) {
+	to = strings.ToUpper(to)
+	scale := new(big.Rat).Set(rate)
+	shift := models.MinorUnits(to) - models.MinorUnits(m.Currency)
+	ten := big.NewRat(10, 1)
+	for ; shift > 0; shift-- {
+		scale.Mul(scale, ten)
+	}
+	for ; shift < 0; shift++ {
+		scale.Quo(scale, ten)
+	}
+
+	converted, err := m.MulRat(scale)
+	if err != nil {
+		return models.Money{}, err
+	}
+	converted.Currency = to
+	return converted, nil
+}
+
+// Rates is a snapshot of the admin managed exchange rate table, all quoted
+// against models.DefaultCurrency.
+type Rates struct {
+	table map[string]models.ExchangeRate
+	rates map[string]*big.Rat
+}
+
+func NewRates(table []models.ExchangeRate) (*Rates, error) {
+	r := &Rates{
+		table: make(map[string]models.ExchangeRate, len(table)),
+		rates: make(map[string]*big.Rat, len(table)),
+	}
+	for _, row := range table {
+		rate, err := ParseRate(row.Rate)
+		if err != nil {
+			return nil, err
+		}
+		r.table[row.Currency] = row
+		r.rates[row.Currency] = rate
+	}
+	return r, nil
+}
+
+// Supported lists the currencies a customer can display prices in.
+func (r *Rates) Supported() []string {
+	list := []string{models.DefaultCurrency}
+	for code := range r.rates {
+		if code != models.DefaultCurrency {
+			list = append(list, code)
+		}
+	}
+	sort.Strings(list[1:])
+	return list
+}
+
+// Lookup returns the table row used to convert store prices into currency.
+// The store currency itself always converts at 1.
+func (r *Rates) Lookup(currency string) (models.ExchangeRate, error) {
+	currency = strings.ToUpper(currency)
+	if currency == models.DefaultCurrency {
+		return models.ExchangeRate{Currency: currency, Rate: "1"}, nil
+	}
+	row, ok := r.table[currency]
+	if !ok {
+		return models.ExchangeRate{}, ErrUnknownCurrency
+	}
+	return row, nil
+}
+
+// Convert converts an amount priced in the store currency into currency.
+func (r *Rates) Convert(m models.Money, currency string) (models.Money, error) {
+	row, err := r.Lookup(currency)
+	if err != nil {
+		return models.Money{}, err
+	}
+	if m.Currency == row.Currency {
+		return m, nil
+	}
+	if m.Currency != models.DefaultCurrency {
+		return models.Money{}, models.ErrCurrencyMismatch
+	}
+	rate, err := ParseRate(row.Rate)
+	if err != nil {
+		return models.Money{}, err
+	}
+	return Convert(m, rate, row.Currency)
+}
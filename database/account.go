@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/accounts"
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrInvalidVerification = errors.New("the verification link is invalid or has expired")
+	ErrAlreadyVerified     = errors.New("this email address is already verified")
+	ErrInvalidReset        = errors.New("the password reset link is invalid or has expired")
+	ErrResetTooSoon        = errors.New("a password reset link was sent moments ago")
+	ErrCantSaveUser        = errors.New("cannot update the user")
+)
+
+// VerifyExistingUsers marks users created before email verification as
+// verified. They have no email_verified field and signed up without being
+// asked to verify, so they shouldn't be locked out of checkout now. Once
+// they have the field this does nothing.
+func VerifyExistingUsers(ctx context.Context, userCollection *mongo.Collection) error {
+	filter := bson.D{primitive.E{Key: "email_verified", Value: bson.D{{Key: "$exists", Value: false}}}}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "email_verified", Value: true}}}}
+	_, err := userCollection.UpdateMany(ctx, filter, update)
+	return err
+}
+
+// SetVerification stores the verification email just sent to a user, which
+// replaces any earlier link. Verified users are left alone.
+func SetVerification(ctx context.Context, userCollection *mongo.Collection, userID primitive.ObjectID, v models.EmailVerification) error {
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: userID},
+		primitive.E{Key: "email_verified", Value: bson.D{{Key: "$ne", Value: true}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "verification", Value: v}}}}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrAlreadyVerified
+	}
+	return nil
+}
+
+// VerifyEmail marks the user whose verification token hashes to tokenHash as
+// verified, as long as the link hasn't expired. The token can't be used
+// again.
+func VerifyEmail(ctx context.Context, userCollection *mongo.Collection, tokenHash string, now time.Time) (models.Users, error) {
+	var user models.Users
+	filter := bson.D{
+		primitive.E{Key: "verification.token_hash", Value: tokenHash},
+		primitive.E{Key: "verification.expires_at", Value: bson.D{{Key: "$gt", Value: now}}},
+	}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			primitive.E{Key: "email_verified", Value: true},
+			primitive.E{Key: "updated_at", Value: now},
+		}},
+		{Key: "$unset", Value: bson.D{primitive.E{Key: "verification", Value: ""}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrInvalidVerification
+	}
+	if err != nil {
+		log.Println(err)
+		return user, ErrCantSaveUser
+	}
+	return user, nil
+}
+
+// SetPasswordReset stores a password reset link for a user, which replaces
+// any earlier one, unless the last was asked for less than
+// accounts.ResetInterval ago. Checking in the same write keeps concurrent
+// requests from all sending mail.
+func SetPasswordReset(ctx context.Context, userCollection *mongo.Collection, userID primitive.ObjectID, reset models.PasswordReset) error {
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: userID},
+		{Key: "$or", Value: bson.A{
+			bson.D{primitive.E{Key: "password_reset", Value: nil}},
+			bson.D{primitive.E{Key: "password_reset.requested_at", Value: bson.D{{Key: "$lte", Value: reset.Requested_At.Add(-accounts.ResetInterval)}}}},
+		}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "password_reset", Value: reset}}}}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrResetTooSoon
+	}
+	return nil
+}
+
+// FindPasswordReset returns the user whose unexpired reset token hashes to
+// tokenHash.
+func FindPasswordReset(ctx context.Context, userCollection *mongo.Collection, tokenHash string, now time.Time) (models.Users, error) {
+	var user models.Users
+	err := userCollection.FindOne(ctx, resetFilter(tokenHash, now)).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrInvalidReset
+	}
+	if err != nil {
+		log.Println(err)
+		return user, ErrCantSaveUser
+	}
+	return user, nil
+}
+
+func resetFilter(tokenHash string, now time.Time) bson.D {
+	return bson.D{
+		primitive.E{Key: "password_reset.token_hash", Value: tokenHash},
+		primitive.E{Key: "password_reset.expires_at", Value: bson.D{{Key: "$gt", Value: now}}},
+	}
+}
+
+// ResetPassword sets the password of the user whose reset token hashes to
+// tokenHash, as long as the link hasn't expired, and signs out all of their
+// sessions. The token can't be used again. Following the link proves the
+// email address, so it counts as verified too.
+func ResetPassword(ctx context.Context, userCollection *mongo.Collection, tokenHash string, passwordHash string, now time.Time) (models.Users, error) {
+	var user models.Users
+	filter := resetFilter(tokenHash, now)
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			primitive.E{Key: "password", Value: passwordHash},
+			primitive.E{Key: "token", Value: nil},
+			primitive.E{Key: "refresh_token", Value: nil},
+			primitive.E{Key: "email_verified", Value: true},
+			primitive.E{Key: "updated_at", Value: now},
+		}},
+		{Key: "$unset", Value: bson.D{
+			primitive.E{Key: "password_reset", Value: ""},
+			primitive.E{Key: "verification", Value: ""},
+		}},
+		{Key: "$inc", Value: bson.D{primitive.E{Key: "session_version", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := userCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return user, ErrInvalidReset
+	}
+	if err != nil {
+		log.Println(err)
+		return user, ErrCantSaveUser
+	}
+	return user, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+)
+
+const MaxAddresses = 20
+
+const (
+	DefaultShipping = "default_shipping"
+	DefaultBilling  = "default_billing"
+)
+
+var (
+	ErrAddressNotFound    = errors.New("address not found")
+	ErrCantSaveAddress    = errors.New("cannot save the address")
+	ErrTooManyAddresses   = errors.New("the address book is full")
+	ErrInvalidDefaultKind = errors.New("default must be shipping or billing")
+)
+
+func ListAddresses(ctx context.Context, userCollection *mongo.Collection, userID string) ([]models.Address, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIdIsNotValid
+	}
+
+	var user models.Users
+	projection := bson.D{primitive.E{Key: "address", Value: 1}}
+	err = userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}, options.FindOne().SetProjection(projection)).Decode(&user)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIdIsNotValid
+	}
+	if user.Address_Details == nil {
+		return make([]models.Address, 0), nil
+	}
+	return user.Address_Details, nil
+}
+
+// AddAddress puts a new address in the book. The first address becomes the
+// default for both shipping and billing.
+func AddAddress(ctx context.Context, userCollection *mongo.Collection, userID string, address models.Address) (models.Address, error) {
+	existing, err := ListAddresses(ctx, userCollection, userID)
+	if err != nil {
+		return address, err
+	}
+	if len(existing) >= MaxAddresses {
+		return address, ErrTooManyAddresses
+	}
+
+	address.Address_ID = primitive.NewObjectID()
+	if len(existing) == 0 {
+		address.Default_Shipping = true
+		address.Default_Billing = true
+	}
+
+	id, _ := primitive.ObjectIDFromHex(userID)
+	filter := bson.D{primitive.E{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "address", Value: address}}}}
+	if _, err = userCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return address, ErrCantSaveAddress
+	}
+
+	for _, kind := range []string{DefaultShipping, DefaultBilling} {
+		if (kind == DefaultShipping && address.Default_Shipping) || (kind == DefaultBilling && address.Default_Billing) {
+			if err = SetDefaultAddress(ctx, userCollection, userID, address.Address_ID, kind); err != nil {
+				return address, err
+			}
+		}
+	}
+	return address, nil
+}
+
+// UpdateAddress replaces the fields of one address, keeping its defaults.
+func UpdateAddress(ctx context.Context, userCollection *mongo.Collection, userID string, addressID primitive.ObjectID, address models.Address) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: "address._id", Value: addressID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "address.$.label", Value: address.Label},
+		primitive.E{Key: "address.$.house_name", Value: address.House},
+		primitive.E{Key: "address.$.street_name", Value: address.Street},
+		primitive.E{Key: "address.$.city_name", Value: address.City},
+		primitive.E{Key: "address.$.pin_code", Value: address.Pincode},
+		primitive.E{Key: "address.$.country", Value: address.Country},
+	}}}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveAddress
+	}
+	if result.MatchedCount == 0 {
+		return ErrAddressNotFound
+	}
+	return nil
+}
+
+// DeleteAddress removes one address. If it was a default, the first address
+// left takes over that default.
+func DeleteAddress(ctx context.Context, userCollection *mongo.Collection, userID string, addressID primitive.ObjectID) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: "address._id", Value: addressID}}
+	update := bson.D{{Key: "$pull", Value: bson.D{primitive.E{Key: "address", Value: bson.D{primitive.E{Key: "_id", Value: addressID}}}}}}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveAddress
+	}
+	if result.MatchedCount == 0 {
+		return ErrAddressNotFound
+	}
+
+	remaining, err := ListAddresses(ctx, userCollection, userID)
+	if err != nil || len(remaining) == 0 {
+		return err
+	}
+	hasShipping, hasBilling := false, false
+	for _, address := range remaining {
+		hasShipping = hasShipping || address.Default_Shipping
+		hasBilling = hasBilling || address.Default_Billing
+	}
+	if !hasShipping {
+		if err = SetDefaultAddress(ctx, userCollection, userID, remaining[0].Address_ID, DefaultShipping); err != nil {
+			return err
+		}
+	}
+	if !hasBilling {
+		return SetDefaultAddress(ctx, userCollection, userID, remaining[0].Address_ID, DefaultBilling)
+	}
+	return nil
+}
+
+// SetDefaultAddress marks one address as the default of kind and clears that
+// flag on every other address in the same write.
+func SetDefaultAddress(ctx context.Context, userCollection *mongo.Collection, userID string, addressID primitive.ObjectID, kind string) error {
+	if kind != DefaultShipping && kind != DefaultBilling {
+		return ErrInvalidDefaultKind
+	}
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: "address._id", Value: addressID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "address.$[chosen]." + kind, Value: true},
+		primitive.E{Key: "address.$[other]." + kind, Value: false},
+	}}}
+	arrayFilters := options.ArrayFilters{Filters: []interface{}{
+		bson.D{primitive.E{Key: "chosen._id", Value: addressID}},
+		bson.D{primitive.E{Key: "other._id", Value: bson.D{{Key: "$ne", Value: addressID}}}},
+	}}
+	result, err := userCollection.UpdateOne(ctx, filter, update, options.Update().SetArrayFilters(arrayFilters))
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveAddress
+	}
+	if result.MatchedCount == 0 {
+		return ErrAddressNotFound
+	}
+	return nil
+}
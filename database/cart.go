@@ -11,8 +11,8 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 
+	"github.com/mreym/shopping/events"
 	"github.com/mreym/shopping/models"
-
 )
 
 var (
@@ -23,6 +23,8 @@ var (
 	ErrCantRemoveItemCart = errors.New("cannot remove this item from the cart")
 	ErrCantGetItem        = errors.New("was unable to get item form the cart")
 	ErrCantBuyCart        = errors.New("cannot update the purchase")
+	ErrCartIsEmpty        = errors.New("the cart is empty")
+	ErrCartChanged        = errors.New("the cart changed during checkout, review it and try again")
 )
 
 func AddProductToCart(ctx context.Context, prodCollection, userCollection *mongo.Collection, productID primitive.ObjectID, userID string) error {
@@ -63,7 +65,7 @@ func RemoveCartItem(ctx context.Context, prodCollection, userCollection *mongo.C
 		return ErrUserIdIsNotValid
 	}
 	filter := bson.D{primitive.E{Key: "_id", Value: id}}
-	update := bson.D{{Key:"$pull", Value: bson.M{"usercart": bson.M{"_id": productID}}}}
+	update := bson.D{{Key: "$pull", Value: bson.M{"usercart": bson.M{"_id": productID}}}}
 	_, err = userCollection.UpdateMany(ctx, filter, update)
 	if err != nil {
 		log.Println(err)
@@ -73,7 +75,14 @@ func RemoveCartItem(ctx context.Context, prodCollection, userCollection *mongo.C
 
 }
 
-func BuyItemFromCart(ctx context.Context, userCollection *mongo.Collection, userID string) error {
+// OrderPricer fills in the pricing of an order (display currency, and any
+// adjustments to the total) before it is written to the user.
+type OrderPricer func(ctx context.Context, user *models.Users, order *models.Order) error
+
+// BuyItemFromCart places an order for everything in the user's cart. The
+// order, the stock it takes and its OrderPlaced event are written in one
+// transaction.
+func BuyItemFromCart(ctx context.Context, prodCollection, userCollection, outboxCollection *mongo.Collection, userID string, pricer OrderPricer) error {
 	// fetch sa cart ng user
 	// find the total ng cart
 	// add order sa user collection
@@ -87,66 +96,92 @@ func BuyItemFromCart(ctx context.Context, userCollection *mongo.Collection, user
 		return ErrUserIdIsNotValid
 	}
 
+	raw, err := userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).DecodeBytes()
+	if err != nil {
+		log.Println(err)
+		return ErrCantGetItem
+	}
 	var getcartitems models.Users
-	var ordercart models.Order
+	if err = bson.Unmarshal(raw, &getcartitems); err != nil {
+		log.Println(err)
+		return ErrCantGetItem
+	}
+	if len(getcartitems.UserCart) == 0 {
+		return ErrCartIsEmpty
+	}
 
+	var ordercart models.Order
 	ordercart.Order_ID = primitive.NewObjectID()
 	ordercart.Ordered_At = time.Now()
-	ordercart.Order_Cart = make([]models.ProductUser, 0)
+	ordercart.Order_Cart = getcartitems.UserCart
 	ordercart.Payment_Method.COD = true
 
-	unwind := bson.D{{Key: "$unwind", Value: bson.D{primitive.E{Key: "path", Value: "$usercart"}}}}
-	grouping := bson.D{{Key: "$group", Value: bson.D{primitive.E{Key: "_id", Value: "$_id"}, {Key: "total", Value: bson.D{primitive.E{Key: "$sum", Value: "$usercart.price"}}}}}}
-	currentresults, err := userCollection.Aggregate(ctx, mongo.Pipeline{unwind, grouping})
-	ctx.Done()
+	ordercart.Price, err = CartTotal(getcartitems.UserCart)
 	if err != nil {
-		panic(err)
+		log.Println(err)
+		return err
 	}
-
-	var getusercart []bson.M
-	if err = currentresults.All(ctx, &getusercart); err != nil {
-		panic(err)
+	if pricer != nil {
+		if err = pricer(ctx, &getcartitems, &ordercart); err != nil {
+			return err
+		}
 	}
-	var total_price int32
 
-	for _, user_item := range getusercart {
-		price := user_item["total"]
-		total_price = price.(int32)
+	// the order is pushed and the cart emptied in one write so a failure
+	// can't leave a placed order with a full cart or vice versa, and only
+	// if the cart is still the one that was priced, so nothing added since
+	// is dropped without being ordered
+	usercart_empty := make([]models.ProductUser, 0)
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "usercart", Value: raw.Lookup("usercart")},
+	}
+	update := bson.D{
+		{Key: "$push", Value: bson.D{primitive.E{Key: "orders", Value: ordercart}}},
+		{Key: "$set", Value: bson.D{
+			primitive.E{Key: "usercart", Value: usercart_empty},
+			primitive.E{Key: "applied_coupon", Value: nil},
+		}},
+	}
+	err = Transaction(ctx, func(ctx context.Context) error {
+		result, err := userCollection.UpdateOne(ctx, filter, update)
+		if err != nil {
+			return err
+		}
+		if result.MatchedCount == 0 {
+			return ErrCartChanged
+		}
+		if err = takeStock(ctx, prodCollection, outboxCollection, ordercart.Order_Cart); err != nil {
+			return err
+		}
+		return Publish(ctx, outboxCollection, events.OrderPlaced{User_ID: userID, Order: ordercart})
+	})
+	if err == ErrCartChanged || err == ErrOutOfStock {
+		return err
 	}
-
-	ordercart.Price = int(total_price)
-
-	filter := bson.D{primitive.E{Key: "_id", Value: id}}
-	update := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "orders", Value: ordercart}}}}
-	_, err = userCollection.UpdateMany(ctx, filter, update)
 	if err != nil {
 		log.Println(err)
+		return ErrCantBuyCart
 	}
+	return nil
 
-	err = userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(&getcartitems)
-	if err != nil {
-		log.Println(err)
-	}
+}
 
-	filter2 := bson.D{primitive.E{Key: "_id", Value: id}}
-	update2 := bson.M{"$push": bson.M{"orders.$[].order_list": bson.M{"$each": getcartitems.UserCart}}}
-	_, err = userCollection.UpdateOne(ctx, filter2, update2)
-	if err != nil {
-		log.Println(err)
+// CartTotal adds up the price of every line in the cart. All lines must be
+// priced in the same currency.
+func CartTotal(cart []models.ProductUser) (models.Money, error) {
+	if len(cart) == 0 {
+		return models.ZeroMoney(models.DefaultCurrency), nil
 	}
 
-	usercart_empty := make([]models.ProductUser, 0)
-	filter3 := bson.D{primitive.E{Key: "_id", Value: id}}
-	update3 := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "usercart", Value: usercart_empty}}}}
-	_, err = userCollection.UpdateOne(ctx, filter3, update3)
-	if err != nil {
-		return ErrCantBuyCart
+	prices := make([]models.Money, 0, len(cart))
+	for _, item := range cart {
+		prices = append(prices, item.Price)
 	}
-	return nil
-
+	return models.SumMoney(cart[0].Price.Currency, prices...)
 }
 
-func InstantBuyer(ctx context.Context, prodCollection, userCollection *mongo.Collection, productID primitive.ObjectID, UserID string) error {
+func InstantBuyer(ctx context.Context, prodCollection, userCollection, outboxCollection *mongo.Collection, productID primitive.ObjectID, UserID string, pricer OrderPricer) error {
 	id, err := primitive.ObjectIDFromHex(UserID)
 
 	if err != nil {
@@ -154,32 +189,67 @@ func InstantBuyer(ctx context.Context, prodCollection, userCollection *mongo.Col
 		return ErrUserIdIsNotValid
 	}
 
+	var buyer models.Users
 	var product_details models.ProductUser
 	var orders_detail models.Order
 
-	orders_detail.Order_ID = primitive.NewObjectID()
-	orders_detail.Ordered_At = time.Now()
-	orders_detail.Order_Cart = make([]models.ProductUser, 0)
-	orders_detail.Payment_Method.COD = true
-	err = prodCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: productID}}).Decode(&product_details)
+	err = userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(&buyer)
 	if err != nil {
 		log.Println(err)
+		return ErrUserIdIsNotValid
 	}
 
+	rawProduct, err := prodCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: productID}}).DecodeBytes()
+	if err != nil {
+		log.Println(err)
+		return ErrCantFindProduct
+	}
+	if err = bson.Unmarshal(rawProduct, &product_details); err != nil {
+		log.Println(err)
+		return ErrCantFindProduct
+	}
+
+	orders_detail.Order_ID = primitive.NewObjectID()
+	orders_detail.Ordered_At = time.Now()
+	orders_detail.Order_Cart = []models.ProductUser{product_details}
+	orders_detail.Payment_Method.COD = true
 	orders_detail.Price = product_details.Price
+	if pricer != nil {
+		if err = pricer(ctx, &buyer, &orders_detail); err != nil {
+			return err
+		}
+	}
 
 	filter := bson.D{primitive.E{Key: "_id", Value: id}}
 	update := bson.D{{Key: "$push", Value: bson.D{primitive.E{Key: "orders", Value: orders_detail}}}}
-	_, err = userCollection.UpdateOne(ctx, filter, update)
-	if err != nil {
-		log.Println(err)
+	// the order is only written while the product still has the price it
+	// was priced at
+	priced := bson.D{
+		primitive.E{Key: "_id", Value: productID},
+		primitive.E{Key: "price", Value: rawProduct.Lookup("price")},
+	}
+	err = Transaction(ctx, func(ctx context.Context) error {
+		unchanged, err := prodCollection.CountDocuments(ctx, priced)
+		if err != nil {
+			return err
+		}
+		if unchanged == 0 {
+			return ErrCartPricesChanged
+		}
+		if err = takeStock(ctx, prodCollection, outboxCollection, orders_detail.Order_Cart); err != nil {
+			return err
+		}
+		if _, err := userCollection.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+		return Publish(ctx, outboxCollection, events.OrderPlaced{User_ID: UserID, Order: orders_detail})
+	})
+	if err == ErrCartPricesChanged || err == ErrOutOfStock {
+		return err
 	}
-
-	filter2 := bson.D{primitive.E{Key: "_id", Value: id}}
-	update2 := bson.M{"$push": bson.M{"orders.$[].order_list": product_details}}
-	_, err = userCollection.UpdateOne(ctx, filter2, update2)
 	if err != nil {
 		log.Println(err)
+		return ErrCantBuyCart
 	}
 	return nil
 }
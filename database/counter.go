@@ -0,0 +1,38 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+var ErrCantNumber = errors.New("cannot get the next number")
+
+// NextSequence hands out 1, 2, 3... for name. The increment is a single
+// atomic write so two callers never get the same number.
+func NextSequence(ctx context.Context, counterCollection *mongo.Collection, name string) (int64, error) {
+	value, err := nextSequence(ctx, counterCollection, name)
+	if err != nil {
+		log.Println(err)
+		return 0, ErrCantNumber
+	}
+	return value, nil
+}
+
+// nextSequence is NextSequence returning the driver's error as it is, for use
+// in a Transaction.
+func nextSequence(ctx context.Context, counterCollection *mongo.Collection, name string) (int64, error) {
+	var counter struct {
+		Value int64 `bson:"value"`
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: name}}
+	update := bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "value", Value: int64(1)}}}}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := counterCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&counter)
+	return counter.Value, err
+}
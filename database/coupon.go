@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrCouponNotFound     = errors.New("coupon not found")
+	ErrCouponExists       = errors.New("a coupon with this code already exists")
+	ErrCantSaveCoupon     = errors.New("cannot save the coupon")
+	ErrCouponLimitReached = errors.New("this coupon has reached its usage limit")
+	ErrCantApplyCoupon    = errors.New("cannot apply the coupon to the cart")
+)
+
+func CreateCoupon(ctx context.Context, couponCollection *mongo.Collection, coupon models.Coupon) error {
+	coupon.Used_Count = 0
+	coupon.Used_By = make(map[string]int)
+	coupon.Created_At = time.Now()
+	_, err := couponCollection.InsertOne(ctx, coupon)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrCouponExists
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveCoupon
+	}
+	return nil
+}
+
+func ListCoupons(ctx context.Context, couponCollection *mongo.Collection) ([]models.Coupon, error) {
+	cursor, err := couponCollection.Find(ctx, bson.D{})
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantSaveCoupon
+	}
+	coupons := make([]models.Coupon, 0)
+	if err = cursor.All(ctx, &coupons); err != nil {
+		log.Println(err)
+		return nil, ErrCantSaveCoupon
+	}
+	return coupons, nil
+}
+
+func FindCoupon(ctx context.Context, couponCollection *mongo.Collection, code string) (models.Coupon, error) {
+	var coupon models.Coupon
+	err := couponCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: code}}).Decode(&coupon)
+	if err == mongo.ErrNoDocuments {
+		return coupon, ErrCouponNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return coupon, ErrCouponNotFound
+	}
+	return coupon, nil
+}
+
+func DeleteCoupon(ctx context.Context, couponCollection *mongo.Collection, code string) error {
+	result, err := couponCollection.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: code}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveCoupon
+	}
+	if result.DeletedCount == 0 {
+		return ErrCouponNotFound
+	}
+	return nil
+}
+
+// RedeemCoupon counts one use of the coupon by the user. The limits are part
+// of the update filter so concurrent checkouts can't go over them.
+func RedeemCoupon(ctx context.Context, couponCollection *mongo.Collection, coupon models.Coupon, userID string) error {
+	usedBy := "used_by." + userID
+	filter := bson.D{primitive.E{Key: "_id", Value: coupon.Code}}
+	if coupon.Global_Limit > 0 {
+		filter = append(filter, primitive.E{Key: "used_count", Value: bson.D{{Key: "$lt", Value: coupon.Global_Limit}}})
+	}
+	if coupon.Per_User_Limit > 0 {
+		filter = append(filter, primitive.E{Key: "$or", Value: bson.A{
+			bson.D{{Key: usedBy, Value: bson.D{{Key: "$exists", Value: false}}}},
+			bson.D{{Key: usedBy, Value: bson.D{{Key: "$lt", Value: coupon.Per_User_Limit}}}},
+		}})
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "used_count", Value: 1}, {Key: usedBy, Value: 1}}}}
+
+	result, err := couponCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveCoupon
+	}
+	if result.ModifiedCount == 0 {
+		return ErrCouponLimitReached
+	}
+	return nil
+}
+
+// ReleaseCoupon gives back a use taken by RedeemCoupon when the order it was
+// taken for could not be placed.
+func ReleaseCoupon(ctx context.Context, couponCollection *mongo.Collection, code string, userID string) error {
+	filter := bson.D{primitive.E{Key: "_id", Value: code}}
+	update := bson.D{{Key: "$inc", Value: bson.D{{Key: "used_count", Value: -1}, {Key: "used_by." + userID, Value: -1}}}}
+	_, err := couponCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveCoupon
+	}
+	return nil
+}
+
+func SetCartCoupon(ctx context.Context, userCollection *mongo.Collection, userID string, code *string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "applied_coupon", Value: code}}}}
+	_, err = userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantApplyCoupon
+	}
+	return nil
+}
@@ -55,3 +55,9 @@ func ProductData(client *mongo.Client, collectionName string) *mongo.Collection
 	return productCollection
 
 }
+
+func CollectionData(client *mongo.Client, collectionName string) *mongo.Collection {
+	var collection *mongo.Collection = client.Database("Shopping").Collection(collectionName)
+	return collection
+
+}
@@ -0,0 +1,156 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/cartmerge"
+	"github.com/mreym/shopping/models"
+)
+
+// MaxGuestCartLines caps how much an anonymous shopper can put in a cart.
+const MaxGuestCartLines = 100
+
+var (
+	ErrGuestCartNotFound = errors.New("the guest cart does not exist or has expired")
+	ErrCantSaveGuestCart = errors.New("cannot save the guest cart")
+	ErrGuestCartFull     = errors.New("the guest cart is full")
+)
+
+func CreateGuestCart(ctx context.Context, guestCollection *mongo.Collection, expiresAt time.Time) (models.GuestCart, error) {
+	now := time.Now()
+	cart := models.GuestCart{
+		Cart_ID:    primitive.NewObjectID(),
+		Items:      make([]models.ProductUser, 0),
+		Created_At: now,
+		Updated_At: now,
+		Expires_At: expiresAt,
+	}
+	if _, err := guestCollection.InsertOne(ctx, cart); err != nil {
+		log.Println(err)
+		return cart, ErrCantSaveGuestCart
+	}
+	return cart, nil
+}
+
+func liveGuestCart(cartID primitive.ObjectID) bson.D {
+	return bson.D{
+		primitive.E{Key: "_id", Value: cartID},
+		primitive.E{Key: "expires_at", Value: bson.D{{Key: "$gt", Value: time.Now()}}},
+	}
+}
+
+func FindGuestCart(ctx context.Context, guestCollection *mongo.Collection, cartID primitive.ObjectID) (models.GuestCart, error) {
+	var cart models.GuestCart
+	err := guestCollection.FindOne(ctx, liveGuestCart(cartID)).Decode(&cart)
+	if err == mongo.ErrNoDocuments {
+		return cart, ErrGuestCartNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return cart, ErrCantGetItem
+	}
+	return cart, nil
+}
+
+func AddGuestCartItem(ctx context.Context, prodCollection, guestCollection *mongo.Collection, cartID primitive.ObjectID, productID primitive.ObjectID) error {
+	var product models.ProductUser
+	err := prodCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: productID}}).Decode(&product)
+	if err != nil {
+		log.Println(err)
+		return ErrCantFindProduct
+	}
+
+	filter := append(liveGuestCart(cartID), primitive.E{Key: "items." + strconv.Itoa(MaxGuestCartLines-1), Value: bson.D{{Key: "$exists", Value: false}}})
+	update := bson.D{
+		{Key: "$push", Value: bson.D{primitive.E{Key: "items", Value: product}}},
+		{Key: "$set", Value: bson.D{primitive.E{Key: "updated_at", Value: time.Now()}}},
+	}
+	result, err := guestCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveGuestCart
+	}
+	if result.MatchedCount == 0 {
+		if _, err = FindGuestCart(ctx, guestCollection, cartID); err != nil {
+			return err
+		}
+		return ErrGuestCartFull
+	}
+	return nil
+}
+
+func RemoveGuestCartItem(ctx context.Context, guestCollection *mongo.Collection, cartID primitive.ObjectID, productID primitive.ObjectID) error {
+	update := bson.D{
+		{Key: "$pull", Value: bson.D{primitive.E{Key: "items", Value: bson.D{primitive.E{Key: "_id", Value: productID}}}}},
+		{Key: "$set", Value: bson.D{primitive.E{Key: "updated_at", Value: time.Now()}}},
+	}
+	result, err := guestCollection.UpdateOne(ctx, liveGuestCart(cartID), update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantRemoveItemCart
+	}
+	if result.MatchedCount == 0 {
+		return ErrGuestCartNotFound
+	}
+	return nil
+}
+
+// MergeGuestCart moves a guest cart into the user's cart using rule for
+// products in both. The guest cart is removed first, so it can only ever be
+// merged once.
+func MergeGuestCart(ctx context.Context, guestCollection, userCollection *mongo.Collection, cartID primitive.ObjectID, userID string, rule string) ([]models.ProductUser, error) {
+	if err := cartmerge.Check(rule); err != nil {
+		return nil, err
+	}
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIdIsNotValid
+	}
+
+	var guest models.GuestCart
+	err = guestCollection.FindOneAndDelete(ctx, liveGuestCart(cartID)).Decode(&guest)
+	if err == mongo.ErrNoDocuments {
+		return nil, ErrGuestCartNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantGetItem
+	}
+
+	// Put the guest cart back if the merge can't be written, so a later login
+	// can try again.
+	restore := func(err error) ([]models.ProductUser, error) {
+		if _, insertErr := guestCollection.InsertOne(ctx, guest); insertErr != nil {
+			log.Println(insertErr)
+		}
+		return nil, err
+	}
+
+	var user models.Users
+	err = userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(&user)
+	if err != nil {
+		log.Println(err)
+		return restore(ErrUserIdIsNotValid)
+	}
+	merged, err := cartmerge.Merge(user.UserCart, guest.Items, rule)
+	if err != nil {
+		return restore(err)
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "usercart", Value: merged}}}}
+	if _, err = userCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return restore(ErrCantupdateUser)
+	}
+	return merged, nil
+}
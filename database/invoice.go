@@ -0,0 +1,120 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrInvoiceNotFound = errors.New("invoice not found")
+	ErrCantSaveInvoice = errors.New("cannot save the invoice")
+	ErrCantLoadInvoice = errors.New("cannot load the invoice")
+)
+
+// EnsureInvoiceIndexes makes the database refuse a second invoice for the
+// same order, kind and refund, and a second use of a number.
+func EnsureInvoiceIndexes(ctx context.Context, invoiceCollection *mongo.Collection) error {
+	_, err := invoiceCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "order_id", Value: 1}, {Key: "kind", Value: 1}, {Key: "refund_id", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.D{{Key: "number", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+	})
+	return err
+}
+
+func invoiceKey(orderID primitive.ObjectID, kind string, refundID *primitive.ObjectID) bson.D {
+	return bson.D{
+		primitive.E{Key: "order_id", Value: orderID},
+		primitive.E{Key: "kind", Value: kind},
+		primitive.E{Key: "refund_id", Value: refundID},
+	}
+}
+
+// FindInvoice looks up the invoice of an order, or with a refundID the credit
+// note of that refund.
+func FindInvoice(ctx context.Context, invoiceCollection *mongo.Collection, orderID primitive.ObjectID, kind string, refundID *primitive.ObjectID) (models.Invoice, error) {
+	var inv models.Invoice
+	err := invoiceCollection.FindOne(ctx, invoiceKey(orderID, kind, refundID)).Decode(&inv)
+	if err == mongo.ErrNoDocuments {
+		return inv, ErrInvoiceNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return inv, ErrCantLoadInvoice
+	}
+	return inv, nil
+}
+
+func FindInvoiceByNumber(ctx context.Context, invoiceCollection *mongo.Collection, number string) (models.Invoice, error) {
+	var inv models.Invoice
+	err := invoiceCollection.FindOne(ctx, bson.D{primitive.E{Key: "number", Value: number}}).Decode(&inv)
+	if err == mongo.ErrNoDocuments {
+		return inv, ErrInvoiceNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return inv, ErrCantLoadInvoice
+	}
+	return inv, nil
+}
+
+func OrderCreditNotes(ctx context.Context, invoiceCollection *mongo.Collection, orderID primitive.ObjectID) ([]models.Invoice, error) {
+	filter := bson.D{primitive.E{Key: "order_id", Value: orderID}, primitive.E{Key: "kind", Value: models.InvoiceKindCreditNote}}
+	cursor, err := invoiceCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "issued_at", Value: 1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadInvoice
+	}
+	list := make([]models.Invoice, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadInvoice
+	}
+	return list, nil
+}
+
+// IssueInvoice numbers and stores an invoice unless one already exists for
+// the same order, kind and refund, in which case that one is returned. An
+// invoice, once issued, is never changed.
+//
+// The number is taken in the same transaction as the insert, so an insert
+// that loses a race on the unique indexes from EnsureInvoiceIndexes, or
+// fails, hands its number back and the numbering has no gaps.
+func IssueInvoice(ctx context.Context, invoiceCollection, counterCollection *mongo.Collection, inv models.Invoice, number func(int64) string) (models.Invoice, error) {
+	existing, err := FindInvoice(ctx, invoiceCollection, inv.Order_ID, inv.Kind, inv.Refund_ID)
+	if err != ErrInvoiceNotFound {
+		return existing, err
+	}
+
+	inv.Invoice_ID = primitive.NewObjectID()
+	err = Transaction(ctx, func(ctx context.Context) error {
+		seq, err := nextSequence(ctx, counterCollection, inv.Kind)
+		if err != nil {
+			return err
+		}
+		inv.Number = number(seq)
+		_, err = invoiceCollection.InsertOne(ctx, inv)
+		return err
+	})
+	if mongo.IsDuplicateKeyError(err) {
+		return FindInvoice(ctx, invoiceCollection, inv.Order_ID, inv.Kind, inv.Refund_ID)
+	}
+	if err != nil {
+		log.Println(err)
+		return inv, ErrCantSaveInvoice
+	}
+	return inv, nil
+}
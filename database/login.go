@@ -0,0 +1,154 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/accounts"
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrNotLocked        = errors.New("there are no failed sign-ins to clear")
+	ErrCantSaveLogin    = errors.New("cannot record the sign-in")
+	ErrCantLoadLogins   = errors.New("cannot load the sign-ins")
+	ErrCantClearLockout = errors.New("cannot clear the failed sign-ins")
+)
+
+// reserveRetries is how often ReserveLoginAttempt re-reads a count that
+// another sign-in changed under it before giving up.
+const reserveRetries = 5
+
+// ReserveLoginAttempt counts a sign-in under key as failed before the
+// password is compared, so a burst of parallel guesses can't all get past the
+// wait; a sign-in that succeeds hands its reservation back. When the key must
+// wait, nothing is counted and the wait, from waitFor, is returned instead.
+func ReserveLoginAttempt(ctx context.Context, throttleCollection *mongo.Collection, key string, threshold int, waitFor func(*models.LoginThrottle, time.Time) time.Duration, now time.Time) (time.Duration, error) {
+	filter := bson.D{primitive.E{Key: "_id", Value: key}}
+	for i := 0; i < reserveRetries; i++ {
+		var current *models.LoginThrottle
+		var t models.LoginThrottle
+		err := throttleCollection.FindOne(ctx, filter).Decode(&t)
+		if err == nil {
+			current = &t
+		} else if err != mongo.ErrNoDocuments {
+			log.Println(err)
+			return 0, ErrCantLoadLogins
+		}
+		if wait := waitFor(current, now); wait > 0 {
+			return wait, nil
+		}
+
+		next := accounts.NextFailure(current, key, threshold, now)
+		if current == nil {
+			_, err = throttleCollection.InsertOne(ctx, next)
+			if mongo.IsDuplicateKeyError(err) {
+				continue
+			}
+			if err != nil {
+				log.Println(err)
+				return 0, ErrCantSaveLogin
+			}
+			return 0, nil
+		}
+		// only if no other sign-in changed the count since it was read
+		swap := bson.D{
+			primitive.E{Key: "_id", Value: key},
+			primitive.E{Key: "failures", Value: current.Failures},
+			primitive.E{Key: "last_failure", Value: current.Last_Failure},
+		}
+		result, err := throttleCollection.ReplaceOne(ctx, swap, next)
+		if err != nil {
+			log.Println(err)
+			return 0, ErrCantSaveLogin
+		}
+		if result.MatchedCount == 1 {
+			return 0, nil
+		}
+	}
+	// too many sign-ins at once for one key is a burst in itself
+	return time.Second, nil
+}
+
+// ReleaseLoginAttempt hands back the reservation of a sign-in that succeeded.
+func ReleaseLoginAttempt(ctx context.Context, throttleCollection *mongo.Collection, key string) error {
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: key},
+		primitive.E{Key: "failures", Value: bson.D{{Key: "$gt", Value: 0}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "failures", Value: -1}}}}
+	if _, err := throttleCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantSaveLogin
+	}
+	return nil
+}
+
+// ClearLoginFailures forgets the failed sign-ins under key, lifting any lock.
+func ClearLoginFailures(ctx context.Context, throttleCollection *mongo.Collection, key string) error {
+	result, err := throttleCollection.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: key}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantClearLockout
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotLocked
+	}
+	return nil
+}
+
+// LockedLogins lists the accounts and addresses locked at now.
+func LockedLogins(ctx context.Context, throttleCollection *mongo.Collection, now time.Time) ([]models.LoginThrottle, error) {
+	filter := bson.D{primitive.E{Key: "locked_until", Value: bson.D{{Key: "$gt", Value: now}}}}
+	cursor, err := throttleCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "locked_until", Value: -1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadLogins
+	}
+	list := make([]models.LoginThrottle, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadLogins
+	}
+	return list, nil
+}
+
+func RecordLoginAttempt(ctx context.Context, attemptCollection *mongo.Collection, attempt models.LoginAttempt) error {
+	attempt.Attempt_ID = primitive.NewObjectID()
+	if _, err := attemptCollection.InsertOne(ctx, attempt); err != nil {
+		log.Println(err)
+		return ErrCantSaveLogin
+	}
+	return nil
+}
+
+// LoginAttempts returns the latest sign-in attempts, newest first, optionally
+// only those for an email or from an address.
+func LoginAttempts(ctx context.Context, attemptCollection *mongo.Collection, email string, ip string, limit int64) ([]models.LoginAttempt, error) {
+	filter := bson.D{}
+	if email != "" {
+		filter = append(filter, primitive.E{Key: "email", Value: email})
+	}
+	if ip != "" {
+		filter = append(filter, primitive.E{Key: "ip", Value: ip})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "at", Value: -1}}).SetLimit(limit)
+	cursor, err := attemptCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadLogins
+	}
+	list := make([]models.LoginAttempt, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadLogins
+	}
+	return list, nil
+}
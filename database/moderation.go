@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrNothingToModerate     = errors.New("there is no such text to moderate")
+	ErrModerationStatusMoved = errors.New("the content was moderated by someone else first")
+	ErrCantModerate          = errors.New("cannot save the moderation decision")
+	ErrCantLoadModerationLog = errors.New("cannot load the moderation log")
+)
+
+// ModerationTarget is what every kind of moderated customer text has in
+// common.
+type ModerationTarget struct {
+	ID          primitive.ObjectID      `bson:"_id"`
+	Product_ID  primitive.ObjectID      `bson:"product_id"`
+	Question_ID primitive.ObjectID      `bson:"question_id"`
+	Status      string                  `bson:"status"`
+	Flags       []models.ModerationFlag `bson:"flags"`
+}
+
+func FindModerationTarget(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID) (ModerationTarget, error) {
+	var target ModerationTarget
+	err := collection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(&target)
+	if err == mongo.ErrNoDocuments {
+		return target, ErrNothingToModerate
+	}
+	if err != nil {
+		log.Println(err)
+		return target, ErrCantModerate
+	}
+	return target, nil
+}
+
+// ModerationQueue decodes the collection's texts in a moderation status into
+// results, oldest first so they are handled in the order they came in.
+func ModerationQueue(ctx context.Context, collection *mongo.Collection, status string, results interface{}) error {
+	filter := bson.D{primitive.E{Key: "status", Value: status}}
+	opts := options.Find().SetSort(bson.D{{Key: "updated_at", Value: 1}})
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return ErrCantModerate
+	}
+	if err = cursor.All(ctx, results); err != nil {
+		log.Println(err)
+		return ErrCantModerate
+	}
+	return nil
+}
+
+// Moderate moves a text from one moderation status to another and decodes
+// the result into result. It fails with ErrModerationStatusMoved when the
+// text is no longer in from.
+func Moderate(ctx context.Context, collection *mongo.Collection, id primitive.ObjectID, from, to string, result interface{}) error {
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: "status", Value: from}}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "status", Value: to}}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := collection.FindOneAndUpdate(ctx, filter, update, opts).Decode(result)
+	if err == mongo.ErrNoDocuments {
+		return ErrModerationStatusMoved
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrCantModerate
+	}
+	return nil
+}
+
+// FingerprintUsed reports whether a text in the collection other than
+// except already has the fingerprint.
+func FingerprintUsed(ctx context.Context, collection *mongo.Collection, fingerprint string, except primitive.ObjectID) (bool, error) {
+	filter := bson.D{
+		primitive.E{Key: "fingerprint", Value: fingerprint},
+		primitive.E{Key: "_id", Value: bson.D{{Key: "$ne", Value: except}}},
+	}
+	count, err := collection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return false, ErrCantModerate
+	}
+	return count > 0, nil
+}
+
+func LogModeration(ctx context.Context, logCollection *mongo.Collection, action models.ModerationAction) error {
+	action.Action_ID = primitive.NewObjectID()
+	action.Created_At = time.Now()
+	if _, err := logCollection.InsertOne(ctx, action); err != nil {
+		log.Println(err)
+		return ErrCantModerate
+	}
+	return nil
+}
+
+// ModerationLog returns the latest moderation actions, newest first,
+// optionally only those of one kind of content or one item.
+func ModerationLog(ctx context.Context, logCollection *mongo.Collection, kind string, targetID *primitive.ObjectID, limit int64) ([]models.ModerationAction, error) {
+	filter := bson.D{}
+	if kind != "" {
+		filter = append(filter, primitive.E{Key: "kind", Value: kind})
+	}
+	if targetID != nil {
+		filter = append(filter, primitive.E{Key: "target_id", Value: *targetID})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := logCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadModerationLog
+	}
+	list := make([]models.ModerationAction, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadModerationLog
+	}
+	return list, nil
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrOrderNotFound   = errors.New("order not found")
+	ErrOrderCancelled  = errors.New("the order has already been cancelled")
+	ErrCantCancel      = errors.New("cannot cancel the order")
+	ErrOrderShipped    = errors.New("the order has already shipped; ask for a return instead")
+	ErrOrderHasReturns = errors.New("the order has open returns")
+)
+
+// FindOrder looks up an order by its id across all users and returns it with
+// the user who placed it. Passing a userID restricts the search to that user.
+func FindOrder(ctx context.Context, userCollection *mongo.Collection, orderID primitive.ObjectID, userID string) (models.Order, string, error) {
+	filter := bson.D{primitive.E{Key: "orders._id", Value: orderID}}
+	if userID != "" {
+		id, err := primitive.ObjectIDFromHex(userID)
+		if err != nil {
+			log.Println(err)
+			return models.Order{}, "", ErrUserIdIsNotValid
+		}
+		filter = append(filter, primitive.E{Key: "_id", Value: id})
+	}
+	projection := bson.D{primitive.E{Key: "orders.$", Value: 1}}
+
+	var owner models.Users
+	err := userCollection.FindOne(ctx, filter, options.FindOne().SetProjection(projection)).Decode(&owner)
+	if err == mongo.ErrNoDocuments || (err == nil && len(owner.Order_Status) == 0) {
+		return models.Order{}, "", ErrOrderNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return models.Order{}, "", ErrOrderNotFound
+	}
+	return owner.Order_Status[0], owner.ID.Hex(), nil
+}
+
+// lockOrder bumps the version of an order that isn't cancelled, inside a
+// transaction. Every transaction that checks an order before acting on it
+// writes it this way first, so two of them on the same order can't both
+// commit: the later one hits a write conflict and is retried against what
+// the first committed. It returns ErrOrderCancelled when there is no such
+// order to lock.
+func lockOrder(ctx context.Context, userCollection *mongo.Collection, userID primitive.ObjectID, orderID primitive.ObjectID, set bson.D) error {
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: userID},
+		primitive.E{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			primitive.E{Key: "_id", Value: orderID},
+			primitive.E{Key: "cancelled_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		}}}},
+	}
+	update := bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "orders.$.version", Value: 1}}}}
+	if len(set) > 0 {
+		update = append(update, primitive.E{Key: "$set", Value: set})
+	}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrOrderCancelled
+	}
+	return nil
+}
+
+// CancelOrder marks one of the user's orders as cancelled and publishes
+// OrderCancelled in the same transaction. An order that has shipped, or has
+// returns that weren't rejected, can't be cancelled; both are checked in the
+// transaction, so a shipment or return created at the same time can't slip
+// past.
+func CancelOrder(ctx context.Context, userCollection, shipmentCollection, returnCollection, outboxCollection *mongo.Collection, userID string, orderID primitive.ObjectID, reason string) (models.Order, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return models.Order{}, ErrUserIdIsNotValid
+	}
+	now := time.Now()
+	set := bson.D{
+		primitive.E{Key: "orders.$.cancelled_at", Value: now},
+		primitive.E{Key: "orders.$.cancel_reason", Value: reason},
+	}
+	openReturns := bson.D{
+		primitive.E{Key: "order_id", Value: orderID},
+		primitive.E{Key: "status", Value: bson.D{{Key: "$ne", Value: models.ReturnRejected}}},
+	}
+
+	err = Transaction(ctx, func(ctx context.Context) error {
+		shipped, err := shipmentCollection.CountDocuments(ctx, bson.D{primitive.E{Key: "order_id", Value: orderID}})
+		if err != nil {
+			return err
+		}
+		if shipped > 0 {
+			return ErrOrderShipped
+		}
+		returned, err := returnCollection.CountDocuments(ctx, openReturns)
+		if err != nil {
+			return err
+		}
+		if returned > 0 {
+			return ErrOrderHasReturns
+		}
+		if err = lockOrder(ctx, userCollection, id, orderID, set); err != nil {
+			return err
+		}
+		return Publish(ctx, outboxCollection, events.OrderCancelled{User_ID: userID, Order_ID: orderID, Reason: reason, Cancelled_At: now})
+	})
+	switch err {
+	case nil, ErrOrderCancelled:
+	case ErrOrderShipped, ErrOrderHasReturns:
+		return models.Order{}, err
+	default:
+		log.Println(err)
+		return models.Order{}, ErrCantCancel
+	}
+
+	order, _, findErr := FindOrder(ctx, userCollection, orderID, userID)
+	if findErr != nil {
+		return order, findErr
+	}
+	return order, err
+}
@@ -0,0 +1,222 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrOutboxEmpty           = errors.New("no outbox messages are due")
+	ErrOutboxMessageNotFound = errors.New("outbox message not found")
+	ErrCantLoadOutbox        = errors.New("cannot load the outbox")
+	ErrCantSaveOutbox        = errors.New("cannot update the outbox")
+)
+
+// AllowNoTransactions lets Transaction run fn without a transaction on a
+// standalone server, which can't start one, when MONGO_ALLOW_NO_TRANSACTIONS
+// is true. The writes are then no longer atomic, so this is only meant for
+// local development.
+var AllowNoTransactions = os.Getenv("MONGO_ALLOW_NO_TRANSACTIONS") == "true"
+
+// isTransactionUnsupported reports whether err is a standalone server
+// refusing to start a transaction; they need a replica set.
+func isTransactionUnsupported(err error) bool {
+	var cmdErr mongo.CommandError
+	return errors.As(err, &cmdErr) && cmdErr.Code == 20
+}
+
+// Transaction runs fn in a MongoDB transaction, retrying it on transient
+// errors. fn must do all of its reads and writes with the context it is
+// given, and return driver errors as they are so they can be told apart.
+//
+// Transactions need a replica set; docker-compose.yaml runs mongod as a
+// single node one. A standalone server refuses them, so signing up,
+// checking out and adding products all fail there, unless
+// MONGO_ALLOW_NO_TRANSACTIONS=true sets AllowNoTransactions.
+func Transaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	session, err := Client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(ctx)
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (interface{}, error) {
+		return nil, fn(sc)
+	})
+	if AllowNoTransactions && isTransactionUnsupported(err) {
+		return fn(ctx)
+	}
+	return err
+}
+
+// Publish saves an event in the outbox for the dispatcher. Pass it the
+// context of a Transaction so the event is only saved with the change it
+// reports.
+func Publish(ctx context.Context, outboxCollection *mongo.Collection, event events.Event) error {
+	payload, err := bson.Marshal(event)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	_, err = outboxCollection.InsertOne(ctx, models.OutboxMessage{
+		Message_ID:      primitive.NewObjectID(),
+		Type:            event.Type(),
+		Payload:         payload,
+		Status:          models.OutboxPending,
+		Handled:         make([]string, 0),
+		Next_Attempt_At: now,
+		Created_At:      now,
+	})
+	return err
+}
+
+// ClaimOutboxMessage takes the next message that is due, or whose claim ran
+// out because the process holding it died, and holds it for lease. A message
+// whose claim ran out after its last attempt, because its handlers never
+// finished, is marked failed instead of being claimed again.
+func ClaimOutboxMessage(ctx context.Context, outboxCollection *mongo.Collection, lease time.Duration, maxAttempts int) (models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	now := time.Now()
+	expired := func(attempts bson.D) bson.D {
+		return bson.D{
+			primitive.E{Key: "status", Value: models.OutboxProcessing},
+			primitive.E{Key: "locked_until", Value: bson.D{{Key: "$lt", Value: now}}},
+			primitive.E{Key: "attempts", Value: attempts},
+		}
+	}
+
+	exhausted := expired(bson.D{{Key: "$gte", Value: maxAttempts}})
+	giveUp := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "status", Value: models.OutboxFailed},
+		primitive.E{Key: "locked_until", Value: nil},
+		primitive.E{Key: "last_error", Value: fmt.Sprintf("gave up after %d attempts: the claim ran out before the handlers finished", maxAttempts)},
+	}}}
+	if _, err := outboxCollection.UpdateMany(ctx, exhausted, giveUp); err != nil {
+		log.Println(err)
+		return msg, ErrCantSaveOutbox
+	}
+
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{
+			primitive.E{Key: "status", Value: models.OutboxPending},
+			primitive.E{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		expired(bson.D{{Key: "$lt", Value: maxAttempts}}),
+	}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			primitive.E{Key: "status", Value: models.OutboxProcessing},
+			primitive.E{Key: "locked_until", Value: now.Add(lease)},
+		}},
+		{Key: "$inc", Value: bson.D{primitive.E{Key: "attempts", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetReturnDocument(options.After)
+	err := outboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		return msg, ErrOutboxEmpty
+	}
+	if err != nil {
+		log.Println(err)
+		return msg, ErrCantLoadOutbox
+	}
+	return msg, nil
+}
+
+// MarkOutboxHandled records that one handler of a message has succeeded.
+func MarkOutboxHandled(ctx context.Context, outboxCollection *mongo.Collection, messageID primitive.ObjectID, handler string) error {
+	filter := bson.D{primitive.E{Key: "_id", Value: messageID}}
+	update := bson.D{{Key: "$addToSet", Value: bson.D{primitive.E{Key: "handled", Value: handler}}}}
+	if _, err := outboxCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantSaveOutbox
+	}
+	return nil
+}
+
+func MarkOutboxDispatched(ctx context.Context, outboxCollection *mongo.Collection, messageID primitive.ObjectID) error {
+	filter := bson.D{primitive.E{Key: "_id", Value: messageID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "status", Value: models.OutboxDispatched},
+		primitive.E{Key: "locked_until", Value: nil},
+		primitive.E{Key: "last_error", Value: ""},
+		primitive.E{Key: "dispatched_at", Value: time.Now()},
+	}}}
+	if _, err := outboxCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantSaveOutbox
+	}
+	return nil
+}
+
+// RetryOutboxLater puts a message that failed back in the queue for
+// nextAttempt, or marks it failed for good when nextAttempt is nil.
+func RetryOutboxLater(ctx context.Context, outboxCollection *mongo.Collection, messageID primitive.ObjectID, reason string, nextAttempt *time.Time) error {
+	set := bson.D{
+		primitive.E{Key: "locked_until", Value: nil},
+		primitive.E{Key: "last_error", Value: reason},
+	}
+	if nextAttempt != nil {
+		set = append(set, primitive.E{Key: "status", Value: models.OutboxPending}, primitive.E{Key: "next_attempt_at", Value: *nextAttempt})
+	} else {
+		set = append(set, primitive.E{Key: "status", Value: models.OutboxFailed})
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: messageID}}
+	if _, err := outboxCollection.UpdateOne(ctx, filter, bson.D{{Key: "$set", Value: set}}); err != nil {
+		log.Println(err)
+		return ErrCantSaveOutbox
+	}
+	return nil
+}
+
+// ListOutbox returns the latest messages in a status, newest first.
+func ListOutbox(ctx context.Context, outboxCollection *mongo.Collection, status string, limit int64) ([]models.OutboxMessage, error) {
+	filter := bson.D{}
+	if status != "" {
+		filter = append(filter, primitive.E{Key: "status", Value: status})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := outboxCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadOutbox
+	}
+	list := make([]models.OutboxMessage, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadOutbox
+	}
+	return list, nil
+}
+
+// RequeueOutboxMessage gives a failed message a fresh set of attempts.
+// Handlers that already succeeded are still skipped.
+func RequeueOutboxMessage(ctx context.Context, outboxCollection *mongo.Collection, messageID primitive.ObjectID) (models.OutboxMessage, error) {
+	var msg models.OutboxMessage
+	filter := bson.D{primitive.E{Key: "_id", Value: messageID}, primitive.E{Key: "status", Value: models.OutboxFailed}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "status", Value: models.OutboxPending},
+		primitive.E{Key: "attempts", Value: 0},
+		primitive.E{Key: "next_attempt_at", Value: time.Now()},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := outboxCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&msg)
+	if err == mongo.ErrNoDocuments {
+		return msg, ErrOutboxMessageNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return msg, ErrCantSaveOutbox
+	}
+	return msg, nil
+}
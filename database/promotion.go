@@ -0,0 +1,79 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrPromotionNotFound = errors.New("promotion not found")
+	ErrCantSavePromotion = errors.New("cannot save the promotion")
+	ErrCantLoadPromotion = errors.New("cannot load the promotions")
+)
+
+func CreatePromotion(ctx context.Context, promoCollection *mongo.Collection, promotion models.Promotion) (primitive.ObjectID, error) {
+	promotion.Promotion_ID = primitive.NewObjectID()
+	promotion.Created_At = time.Now()
+	_, err := promoCollection.InsertOne(ctx, promotion)
+	if err != nil {
+		log.Println(err)
+		return primitive.NilObjectID, ErrCantSavePromotion
+	}
+	return promotion.Promotion_ID, nil
+}
+
+func findPromotions(ctx context.Context, promoCollection *mongo.Collection, filter bson.D) ([]models.Promotion, error) {
+	cursor, err := promoCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadPromotion
+	}
+	list := make([]models.Promotion, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadPromotion
+	}
+	return list, nil
+}
+
+func ListPromotions(ctx context.Context, promoCollection *mongo.Collection) ([]models.Promotion, error) {
+	return findPromotions(ctx, promoCollection, bson.D{})
+}
+
+func ActivePromotions(ctx context.Context, promoCollection *mongo.Collection) ([]models.Promotion, error) {
+	return findPromotions(ctx, promoCollection, bson.D{primitive.E{Key: "active", Value: true}})
+}
+
+func SetPromotionActive(ctx context.Context, promoCollection *mongo.Collection, promotionID primitive.ObjectID, active bool) error {
+	filter := bson.D{primitive.E{Key: "_id", Value: promotionID}}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "active", Value: active}}}}
+	result, err := promoCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSavePromotion
+	}
+	if result.MatchedCount == 0 {
+		return ErrPromotionNotFound
+	}
+	return nil
+}
+
+func DeletePromotion(ctx context.Context, promoCollection *mongo.Collection, promotionID primitive.ObjectID) error {
+	result, err := promoCollection.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: promotionID}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantSavePromotion
+	}
+	if result.DeletedCount == 0 {
+		return ErrPromotionNotFound
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrQuestionNotFound    = errors.New("question not found")
+	ErrAnswerNotFound      = errors.New("answer not found")
+	ErrCantSaveQuestion    = errors.New("cannot save the question")
+	ErrCantLoadQuestions   = errors.New("cannot load the questions")
+	ErrAlreadyUpvoted      = errors.New("you have already upvoted this answer")
+	ErrCantUpvoteOwnAnswer = errors.New("you cannot upvote your own answer")
+)
+
+func CreateQuestion(ctx context.Context, questionCollection, prodCollection *mongo.Collection, question models.Question) (models.Question, error) {
+	if err := productExists(ctx, prodCollection, question.Product_ID); err != nil {
+		return question, err
+	}
+	now := time.Now()
+	question.Question_ID = primitive.NewObjectID()
+	question.Answer_Count = 0
+	question.Created_At = now
+	question.Updated_At = now
+	if _, err := questionCollection.InsertOne(ctx, question); err != nil {
+		log.Println(err)
+		return question, ErrCantSaveQuestion
+	}
+	return question, nil
+}
+
+func FindQuestion(ctx context.Context, questionCollection *mongo.Collection, questionID primitive.ObjectID) (models.Question, error) {
+	var question models.Question
+	err := questionCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: questionID}}).Decode(&question)
+	if err == mongo.ErrNoDocuments {
+		return question, ErrQuestionNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return question, ErrCantLoadQuestions
+	}
+	return question, nil
+}
+
+// ProductQuestions returns one page of a product's approved questions, newest
+// first, and how many there are in all.
+func ProductQuestions(ctx context.Context, questionCollection *mongo.Collection, productID primitive.ObjectID, page, perPage int) ([]models.Question, int64, error) {
+	filter := bson.D{
+		primitive.E{Key: "product_id", Value: productID},
+		primitive.E{Key: "status", Value: models.ModerationApproved},
+	}
+	total, err := questionCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, ErrCantLoadQuestions
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetSkip(int64((page - 1) * perPage)).SetLimit(int64(perPage))
+	cursor, err := questionCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, ErrCantLoadQuestions
+	}
+	list := make([]models.Question, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, 0, ErrCantLoadQuestions
+	}
+	return list, total, nil
+}
+
+// UnansweredQuestions lists approved questions nobody has answered yet,
+// oldest first, for staff to pick up.
+func UnansweredQuestions(ctx context.Context, questionCollection *mongo.Collection) ([]models.Question, error) {
+	filter := bson.D{
+		primitive.E{Key: "status", Value: models.ModerationApproved},
+		primitive.E{Key: "answer_count", Value: 0},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+	cursor, err := questionCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadQuestions
+	}
+	list := make([]models.Question, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadQuestions
+	}
+	return list, nil
+}
+
+func CreateAnswer(ctx context.Context, answerCollection *mongo.Collection, answer models.Answer) (models.Answer, error) {
+	now := time.Now()
+	answer.Answer_ID = primitive.NewObjectID()
+	answer.Upvoters = make([]string, 0)
+	answer.Created_At = now
+	answer.Updated_At = now
+	if _, err := answerCollection.InsertOne(ctx, answer); err != nil {
+		log.Println(err)
+		return answer, ErrCantSaveQuestion
+	}
+	return answer, nil
+}
+
+// QuestionAnswers returns the approved answers to the questions, keyed by
+// question. Staff answers come first, then the most upvoted.
+func QuestionAnswers(ctx context.Context, answerCollection *mongo.Collection, questionIDs []primitive.ObjectID) (map[primitive.ObjectID][]models.Answer, error) {
+	filter := bson.D{
+		primitive.E{Key: "question_id", Value: bson.D{{Key: "$in", Value: questionIDs}}},
+		primitive.E{Key: "status", Value: models.ModerationApproved},
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "staff", Value: -1}, {Key: "upvotes", Value: -1}, {Key: "created_at", Value: 1}})
+	cursor, err := answerCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadQuestions
+	}
+	var list []models.Answer
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadQuestions
+	}
+	answers := make(map[primitive.ObjectID][]models.Answer)
+	for _, answer := range list {
+		answers[answer.Question_ID] = append(answers[answer.Question_ID], answer)
+	}
+	return answers, nil
+}
+
+// RefreshAnswerCount recounts a question's approved answers.
+func RefreshAnswerCount(ctx context.Context, answerCollection, questionCollection *mongo.Collection, questionID primitive.ObjectID) error {
+	count, err := answerCollection.CountDocuments(ctx, bson.D{
+		primitive.E{Key: "question_id", Value: questionID},
+		primitive.E{Key: "status", Value: models.ModerationApproved},
+	})
+	if err != nil {
+		log.Println(err)
+		return ErrCantLoadQuestions
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: questionID}}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "answer_count", Value: count}}}}
+	if _, err = questionCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantSaveQuestion
+	}
+	return nil
+}
+
+// UpvoteAnswer counts a user's upvote on an approved answer, once per user.
+func UpvoteAnswer(ctx context.Context, answerCollection *mongo.Collection, answerID primitive.ObjectID, userID string) (models.Answer, error) {
+	var answer models.Answer
+	err := answerCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: answerID}}).Decode(&answer)
+	if err == mongo.ErrNoDocuments || (err == nil && answer.Status != models.ModerationApproved) {
+		return answer, ErrAnswerNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return answer, ErrCantLoadQuestions
+	}
+	if answer.User_ID == userID {
+		return answer, ErrCantUpvoteOwnAnswer
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: answerID}, primitive.E{Key: "upvoters", Value: bson.D{{Key: "$ne", Value: userID}}}}
+	update := bson.D{
+		{Key: "$push", Value: bson.D{primitive.E{Key: "upvoters", Value: userID}}},
+		{Key: "$inc", Value: bson.D{primitive.E{Key: "upvotes", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = answerCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&answer)
+	if err == mongo.ErrNoDocuments {
+		return answer, ErrAlreadyUpvoted
+	}
+	if err != nil {
+		log.Println(err)
+		return answer, ErrCantSaveQuestion
+	}
+	return answer, nil
+}
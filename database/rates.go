@@ -0,0 +1,77 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrCantLoadRates   = errors.New("cannot load the exchange rates")
+	ErrCantSetRate     = errors.New("cannot save the exchange rate")
+	ErrRateNotFound    = errors.New("no exchange rate for this currency")
+	ErrCantSetCurrency = errors.New("cannot update the display currency")
+)
+
+func LoadExchangeRates(ctx context.Context, rateCollection *mongo.Collection) ([]models.ExchangeRate, error) {
+	cursor, err := rateCollection.Find(ctx, bson.D{})
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadRates
+	}
+
+	rates := make([]models.ExchangeRate, 0)
+	if err = cursor.All(ctx, &rates); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadRates
+	}
+	return rates, nil
+}
+
+func SetExchangeRate(ctx context.Context, rateCollection *mongo.Collection, rate models.ExchangeRate) error {
+	rate.Updated_At = time.Now()
+	filter := bson.D{primitive.E{Key: "_id", Value: rate.Currency}}
+	_, err := rateCollection.ReplaceOne(ctx, filter, rate, options.Replace().SetUpsert(true))
+	if err != nil {
+		log.Println(err)
+		return ErrCantSetRate
+	}
+	return nil
+}
+
+func DeleteExchangeRate(ctx context.Context, rateCollection *mongo.Collection, currency string) error {
+	result, err := rateCollection.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: currency}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantSetRate
+	}
+	if result.DeletedCount == 0 {
+		return ErrRateNotFound
+	}
+	return nil
+}
+
+func SetDisplayCurrency(ctx context.Context, userCollection *mongo.Collection, userID string, currency string) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "display_currency", Value: currency}}}}
+	_, err = userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSetCurrency
+	}
+	return nil
+}
@@ -0,0 +1,147 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrCartPricesChanged = errors.New("prices in the cart have changed, accept them before checking out")
+	ErrPricesNotShown    = errors.New("the cart changed since it was shown, review it before accepting")
+)
+
+// RepriceCart rebuilds cart lines from the current catalog and reports every
+// product whose price changed or that is no longer sold. Lines for products
+// that are gone are left out of the result.
+func RepriceCart(ctx context.Context, prodCollection *mongo.Collection, lines []models.ProductUser) ([]models.ProductUser, []models.CartChange, error) {
+	repriced := make([]models.ProductUser, 0, len(lines))
+	changes := make([]models.CartChange, 0)
+	if len(lines) == 0 {
+		return repriced, changes, nil
+	}
+
+	ids := make([]primitive.ObjectID, 0, len(lines))
+	for _, line := range lines {
+		ids = append(ids, line.Product_ID)
+	}
+	cursor, err := prodCollection.Find(ctx, bson.D{primitive.E{Key: "_id", Value: bson.D{{Key: "$in", Value: ids}}}})
+	if err != nil {
+		log.Println(err)
+		return nil, nil, ErrCantDecodeProducts
+	}
+	var products []models.ProductUser
+	if err = cursor.All(ctx, &products); err != nil {
+		log.Println(err)
+		return nil, nil, ErrCantDecodeProducts
+	}
+	current := make(map[primitive.ObjectID]models.ProductUser, len(products))
+	for _, product := range products {
+		current[product.Product_ID] = product
+	}
+
+	reported := make(map[primitive.ObjectID]bool)
+	for _, line := range lines {
+		product, ok := current[line.Product_ID]
+		if ok {
+			repriced = append(repriced, product)
+		}
+		if reported[line.Product_ID] {
+			continue
+		}
+		switch {
+		case !ok:
+			changes = append(changes, models.CartChange{Product_ID: line.Product_ID, Product_Name: line.Product_Name, Change: models.CartChangeUnavailable, Old_Price: line.Price})
+		case product.Price != line.Price:
+			price := product.Price
+			changes = append(changes, models.CartChange{Product_ID: line.Product_ID, Product_Name: product.Product_Name, Change: models.CartChangePrice, Old_Price: line.Price, New_Price: &price})
+		default:
+			continue
+		}
+		reported[line.Product_ID] = true
+	}
+	return repriced, changes, nil
+}
+
+// sameChanges reports whether seen lists exactly the changes in changes, by
+// product, kind of change and new price.
+func sameChanges(changes, seen []models.CartChange) bool {
+	if len(changes) != len(seen) {
+		return false
+	}
+	type shown struct {
+		change string
+		price  *models.Money
+	}
+	byProduct := make(map[primitive.ObjectID]shown, len(seen))
+	for _, s := range seen {
+		byProduct[s.Product_ID] = shown{change: s.Change, price: s.New_Price}
+	}
+	for _, change := range changes {
+		s, ok := byProduct[change.Product_ID]
+		if !ok || s.change != change.Change {
+			return false
+		}
+		if (s.price == nil) != (change.New_Price == nil) || (s.price != nil && *s.price != *change.New_Price) {
+			return false
+		}
+	}
+	return true
+}
+
+// AcceptCartPrices stores the current catalog prices on the user's cart and
+// drops products that are no longer sold, as long as they are the changes
+// the customer was shown, given in seen. It returns the updated cart and the
+// changes that were accepted, or ErrPricesNotShown when the prices or the
+// cart moved on since.
+func AcceptCartPrices(ctx context.Context, prodCollection, userCollection *mongo.Collection, userID string, seen []models.CartChange) ([]models.ProductUser, []models.CartChange, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return nil, nil, ErrUserIdIsNotValid
+	}
+
+	raw, err := userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).DecodeBytes()
+	if err != nil {
+		log.Println(err)
+		return nil, nil, ErrCantGetItem
+	}
+	var user models.Users
+	if err = bson.Unmarshal(raw, &user); err != nil {
+		log.Println(err)
+		return nil, nil, ErrCantGetItem
+	}
+	repriced, changes, err := RepriceCart(ctx, prodCollection, user.UserCart)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !sameChanges(changes, seen) {
+		return nil, nil, ErrPricesNotShown
+	}
+	if len(changes) == 0 {
+		return repriced, changes, nil
+	}
+
+	// only the cart that was repriced; one that changed since isn't what the
+	// customer accepted
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "usercart", Value: raw.Lookup("usercart")},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{primitive.E{Key: "usercart", Value: repriced}}}}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return nil, nil, ErrCantupdateUser
+	}
+	if result.MatchedCount == 0 {
+		return nil, nil, ErrPricesNotShown
+	}
+	return repriced, changes, nil
+}
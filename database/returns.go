@@ -0,0 +1,277 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/returns"
+)
+
+var (
+	ErrReturnNotFound    = errors.New("return not found")
+	ErrReturnStatusMoved = errors.New("the return is no longer in that status")
+	ErrCantSaveReturn    = errors.New("cannot save the return")
+	ErrCantLoadReturns   = errors.New("cannot load the returns")
+	ErrCantSaveRefund    = errors.New("cannot save the refund")
+	ErrCantRestock       = errors.New("cannot restock the returned items")
+)
+
+// ReturnCheck validates a return request against the order's existing
+// returns and gives back the items to return.
+type ReturnCheck func(existing []models.Return) ([]models.ReturnItem, error)
+
+// CreateReturn saves a return on an order that isn't cancelled. The order is
+// locked, its returns read and checked, and the return inserted in one
+// transaction, so two requests at once can't both claim the same units. An
+// error from check is returned as it is.
+func CreateReturn(ctx context.Context, userCollection, returnCollection *mongo.Collection, r models.Return, check ReturnCheck) (models.Return, error) {
+	userID, err := primitive.ObjectIDFromHex(r.User_ID)
+	if err != nil {
+		log.Println(err)
+		return r, ErrUserIdIsNotValid
+	}
+	now := time.Now()
+	r.Return_ID = primitive.NewObjectID()
+	r.Status = models.ReturnRequested
+	r.Created_At = now
+	r.Updated_At = now
+
+	var checkErr error
+	err = Transaction(ctx, func(ctx context.Context) error {
+		if err := lockOrder(ctx, userCollection, userID, r.Order_ID, nil); err != nil {
+			return err
+		}
+		cursor, err := returnCollection.Find(ctx, bson.D{primitive.E{Key: "order_id", Value: r.Order_ID}})
+		if err != nil {
+			return err
+		}
+		existing := make([]models.Return, 0)
+		if err = cursor.All(ctx, &existing); err != nil {
+			return err
+		}
+		if r.Items, checkErr = check(existing); checkErr != nil {
+			return checkErr
+		}
+		_, err = returnCollection.InsertOne(ctx, r)
+		return err
+	})
+	if checkErr != nil {
+		return r, checkErr
+	}
+	if err == ErrOrderCancelled {
+		return r, err
+	}
+	if err != nil {
+		log.Println(err)
+		return r, ErrCantSaveReturn
+	}
+	return r, nil
+}
+
+func findReturns(ctx context.Context, returnCollection *mongo.Collection, filter bson.D) ([]models.Return, error) {
+	cursor, err := returnCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadReturns
+	}
+	list := make([]models.Return, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadReturns
+	}
+	return list, nil
+}
+
+func OrderReturns(ctx context.Context, returnCollection *mongo.Collection, orderID primitive.ObjectID) ([]models.Return, error) {
+	return findReturns(ctx, returnCollection, bson.D{primitive.E{Key: "order_id", Value: orderID}})
+}
+
+func UserReturns(ctx context.Context, returnCollection *mongo.Collection, userID string) ([]models.Return, error) {
+	return findReturns(ctx, returnCollection, bson.D{primitive.E{Key: "user_id", Value: userID}})
+}
+
+// ListReturns is the admin queue, optionally only returns in one status.
+func ListReturns(ctx context.Context, returnCollection *mongo.Collection, status string) ([]models.Return, error) {
+	filter := bson.D{}
+	if status != "" {
+		filter = append(filter, primitive.E{Key: "status", Value: status})
+	}
+	return findReturns(ctx, returnCollection, filter)
+}
+
+func FindReturn(ctx context.Context, returnCollection *mongo.Collection, returnID primitive.ObjectID) (models.Return, error) {
+	var r models.Return
+	err := returnCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: returnID}}).Decode(&r)
+	if err == mongo.ErrNoDocuments {
+		return r, ErrReturnNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return r, ErrCantLoadReturns
+	}
+	return r, nil
+}
+
+// MoveReturn changes the status of a return only if it is still in from, so
+// two admins can't act on the same return at once. extra is set alongside.
+func MoveReturn(ctx context.Context, returnCollection *mongo.Collection, returnID primitive.ObjectID, from, to string, extra bson.D) (models.Return, error) {
+	r, err := moveReturn(ctx, returnCollection, returnID, from, to, extra)
+	if err == mongo.ErrNoDocuments {
+		return r, ErrReturnStatusMoved
+	}
+	if err != nil {
+		log.Println(err)
+		return r, ErrCantSaveReturn
+	}
+	return r, nil
+}
+
+func moveReturn(ctx context.Context, returnCollection *mongo.Collection, returnID primitive.ObjectID, from, to string, extra bson.D) (models.Return, error) {
+	var r models.Return
+	filter := bson.D{primitive.E{Key: "_id", Value: returnID}, primitive.E{Key: "status", Value: from}}
+	set := append(bson.D{
+		primitive.E{Key: "status", Value: to},
+		primitive.E{Key: "updated_at", Value: time.Now()},
+	}, extra...)
+	update := bson.D{{Key: "$set", Value: set}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := returnCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&r)
+	return r, err
+}
+
+// ReceiveReturn marks a return as received and puts its units back into the
+// catalog's stock in one transaction, so a return is never received without
+// being restocked. Each product's new stock is reported as a ProductUpdated
+// event; products that keep no stock or are no longer in the catalog are
+// skipped.
+func ReceiveReturn(ctx context.Context, returnCollection, prodCollection, outboxCollection *mongo.Collection, returnID primitive.ObjectID, from string) (models.Return, error) {
+	var r models.Return
+	err := Transaction(ctx, func(ctx context.Context) error {
+		var err error
+		if r, err = moveReturn(ctx, returnCollection, returnID, from, models.ReturnReceived, nil); err != nil {
+			return err
+		}
+		return restock(ctx, prodCollection, outboxCollection, r.Items)
+	})
+	if err == mongo.ErrNoDocuments {
+		return r, ErrReturnStatusMoved
+	}
+	if err != nil {
+		log.Println(err)
+		return r, ErrCantRestock
+	}
+	return r, nil
+}
+
+// CreateRefund saves a refund, keeping its id when the caller already picked
+// one.
+func CreateRefund(ctx context.Context, refundCollection *mongo.Collection, refund models.Refund) (models.Refund, error) {
+	if refund.Refund_ID.IsZero() {
+		refund.Refund_ID = primitive.NewObjectID()
+	}
+	refund.Created_At = time.Now()
+	if _, err := refundCollection.InsertOne(ctx, refund); err != nil {
+		log.Println(err)
+		return refund, ErrCantSaveRefund
+	}
+	return refund, nil
+}
+
+func OrderRefunds(ctx context.Context, refundCollection *mongo.Collection, orderID primitive.ObjectID) ([]models.Refund, error) {
+	cursor, err := refundCollection.Find(ctx, bson.D{primitive.E{Key: "order_id", Value: orderID}})
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadReturns
+	}
+	list := make([]models.Refund, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadReturns
+	}
+	return list, nil
+}
+
+// ReserveRefund adds amount to what has been refunded on an order, as long
+// as that stays within limit. The check and the increment are one write, so
+// two refunds at once can't both take the last of the balance.
+func ReserveRefund(ctx context.Context, userCollection *mongo.Collection, userID string, orderID primitive.ObjectID, amount, limit models.Money) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+	if amount.Currency != limit.Currency || amount.Amount > limit.Amount {
+		return returns.ErrRefundTooLarge
+	}
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			primitive.E{Key: "_id", Value: orderID},
+			{Key: "$or", Value: bson.A{
+				bson.D{primitive.E{Key: "refunded", Value: bson.D{{Key: "$exists", Value: false}}}},
+				bson.D{primitive.E{Key: "refunded.amount", Value: bson.D{{Key: "$lte", Value: limit.Amount - amount.Amount}}}},
+			}},
+		}}}},
+	}
+	update := bson.D{
+		{Key: "$inc", Value: bson.D{primitive.E{Key: "orders.$.refunded.amount", Value: amount.Amount}}},
+		{Key: "$set", Value: bson.D{primitive.E{Key: "orders.$.refunded.currency", Value: amount.Currency}}},
+	}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantupdateUser
+	}
+	if result.MatchedCount == 0 {
+		return returns.ErrRefundTooLarge
+	}
+	return nil
+}
+
+// ReleaseRefund hands back a reservation from ReserveRefund whose refund
+// couldn't be saved.
+func ReleaseRefund(ctx context.Context, userCollection *mongo.Collection, userID string, orderID primitive.ObjectID, amount models.Money) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: "orders._id", Value: orderID}}
+	update := bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "orders.$.refunded.amount", Value: -amount.Amount}}}}
+	if _, err = userCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantupdateUser
+	}
+	return nil
+}
+
+// SetOrderReturns records on the order how many units came back. What has
+// been refunded is kept by ReserveRefund.
+func SetOrderReturns(ctx context.Context, userCollection *mongo.Collection, userID string, orderID primitive.ObjectID, returned []models.ReturnedQuantity) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: "orders._id", Value: orderID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "orders.$.returned", Value: returned},
+	}}}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantupdateUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrOrderNotFound
+	}
+	return nil
+}
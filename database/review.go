@@ -0,0 +1,282 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/reviews"
+)
+
+var (
+	ErrReviewNotFound    = errors.New("review not found")
+	ErrAlreadyReviewed   = errors.New("you have already reviewed this product")
+	ErrCantSaveReview    = errors.New("cannot save the review")
+	ErrCantLoadReviews   = errors.New("cannot load the reviews")
+	ErrAlreadyVoted      = errors.New("you have already found this review helpful")
+	ErrCantVoteOwnReview = errors.New("you cannot vote on your own review")
+)
+
+// EnsureReviewIndexes makes the database refuse a second review of a product
+// by the same user.
+func EnsureReviewIndexes(ctx context.Context, reviewCollection *mongo.Collection) error {
+	_, err := reviewCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "product_id", Value: 1}, {Key: "user_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// HasPurchased reports whether any of the user's orders that wasn't
+// cancelled contains the product.
+func HasPurchased(ctx context.Context, userCollection *mongo.Collection, userID string, productID primitive.ObjectID) (bool, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return false, ErrUserIdIsNotValid
+	}
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: id},
+		primitive.E{Key: "orders", Value: bson.D{{Key: "$elemMatch", Value: bson.D{
+			primitive.E{Key: "order_list._id", Value: productID},
+			primitive.E{Key: "cancelled_at", Value: bson.D{{Key: "$exists", Value: false}}},
+		}}}},
+	}
+	count, err := userCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return false, ErrCantGetItem
+	}
+	return count > 0, nil
+}
+
+func productExists(ctx context.Context, prodCollection *mongo.Collection, productID primitive.ObjectID) error {
+	found, err := prodCollection.CountDocuments(ctx, bson.D{primitive.E{Key: "_id", Value: productID}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantFindProduct
+	}
+	if found == 0 {
+		return ErrCantFindProduct
+	}
+	return nil
+}
+
+// CreateReview saves a review of a catalog product, allowing one per user
+// and product, keeping its id when the caller already picked one. The unique
+// index from EnsureReviewIndexes catches two reviews posted at once.
+func CreateReview(ctx context.Context, reviewCollection, prodCollection *mongo.Collection, review models.Review) (models.Review, error) {
+	if err := productExists(ctx, prodCollection, review.Product_ID); err != nil {
+		return review, err
+	}
+
+	existing, err := reviewCollection.CountDocuments(ctx, bson.D{
+		primitive.E{Key: "product_id", Value: review.Product_ID},
+		primitive.E{Key: "user_id", Value: review.User_ID},
+	})
+	if err != nil {
+		log.Println(err)
+		return review, ErrCantSaveReview
+	}
+	if existing > 0 {
+		return review, ErrAlreadyReviewed
+	}
+
+	now := time.Now()
+	if review.Review_ID.IsZero() {
+		review.Review_ID = primitive.NewObjectID()
+	}
+	review.Helpful_Voters = make([]string, 0)
+	review.Created_At = now
+	review.Updated_At = now
+	_, err = reviewCollection.InsertOne(ctx, review)
+	if mongo.IsDuplicateKeyError(err) {
+		return review, ErrAlreadyReviewed
+	}
+	if err != nil {
+		log.Println(err)
+		return review, ErrCantSaveReview
+	}
+	return review, nil
+}
+
+func FindReview(ctx context.Context, reviewCollection *mongo.Collection, reviewID primitive.ObjectID) (models.Review, error) {
+	var review models.Review
+	err := reviewCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: reviewID}}).Decode(&review)
+	if err == mongo.ErrNoDocuments {
+		return review, ErrReviewNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return review, ErrCantLoadReviews
+	}
+	return review, nil
+}
+
+// UpdateReview changes the stars and text of the user's own review, along
+// with the moderation status the new text was given.
+func UpdateReview(ctx context.Context, reviewCollection *mongo.Collection, reviewID primitive.ObjectID, userID string, review models.Review) (models.Review, error) {
+	filter := bson.D{primitive.E{Key: "_id", Value: reviewID}, primitive.E{Key: "user_id", Value: userID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "rating", Value: review.Rating},
+		primitive.E{Key: "title", Value: review.Title},
+		primitive.E{Key: "body", Value: review.Body},
+		primitive.E{Key: "status", Value: review.Status},
+		primitive.E{Key: "flags", Value: review.Flags},
+		primitive.E{Key: "fingerprint", Value: review.Fingerprint},
+		primitive.E{Key: "updated_at", Value: time.Now()},
+	}}}
+	var updated models.Review
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := reviewCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&updated)
+	if err == mongo.ErrNoDocuments {
+		return updated, ErrReviewNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return updated, ErrCantSaveReview
+	}
+	return updated, nil
+}
+
+// DeleteReview removes the user's own review and returns it.
+func DeleteReview(ctx context.Context, reviewCollection *mongo.Collection, reviewID primitive.ObjectID, userID string) (models.Review, error) {
+	var review models.Review
+	filter := bson.D{primitive.E{Key: "_id", Value: reviewID}, primitive.E{Key: "user_id", Value: userID}}
+	err := reviewCollection.FindOneAndDelete(ctx, filter).Decode(&review)
+	if err == mongo.ErrNoDocuments {
+		return review, ErrReviewNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return review, ErrCantSaveReview
+	}
+	return review, nil
+}
+
+// VoteHelpful counts a user finding a review helpful, once per user.
+func VoteHelpful(ctx context.Context, reviewCollection *mongo.Collection, reviewID primitive.ObjectID, userID string) error {
+	review, err := FindReview(ctx, reviewCollection, reviewID)
+	if err != nil {
+		return err
+	}
+	if review.Status != models.ModerationApproved {
+		return ErrReviewNotFound
+	}
+	if review.User_ID == userID {
+		return ErrCantVoteOwnReview
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: reviewID}, primitive.E{Key: "helpful_voters", Value: bson.D{{Key: "$ne", Value: userID}}}}
+	update := bson.D{
+		{Key: "$push", Value: bson.D{primitive.E{Key: "helpful_voters", Value: userID}}},
+		{Key: "$inc", Value: bson.D{primitive.E{Key: "helpful_count", Value: 1}}},
+	}
+	result, err := reviewCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveReview
+	}
+	if result.MatchedCount == 0 {
+		return ErrAlreadyVoted
+	}
+	return nil
+}
+
+var reviewSorts = map[string]bson.D{
+	reviews.SortRecent:     {{Key: "created_at", Value: -1}},
+	reviews.SortHelpful:    {{Key: "helpful_count", Value: -1}, {Key: "created_at", Value: -1}},
+	reviews.SortRatingHigh: {{Key: "rating", Value: -1}, {Key: "created_at", Value: -1}},
+	reviews.SortRatingLow:  {{Key: "rating", Value: 1}, {Key: "created_at", Value: -1}},
+}
+
+// ProductReviews returns one page of a product's approved reviews and how
+// many there are in all. Unknown sort orders fall back to the most recent
+// first.
+func ProductReviews(ctx context.Context, reviewCollection *mongo.Collection, productID primitive.ObjectID, verifiedOnly bool, sortBy string, page, perPage int) ([]models.Review, int64, error) {
+	filter := bson.D{
+		primitive.E{Key: "product_id", Value: productID},
+		primitive.E{Key: "status", Value: models.ModerationApproved},
+	}
+	if verifiedOnly {
+		filter = append(filter, primitive.E{Key: "verified_purchase", Value: true})
+	}
+	total, err := reviewCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, ErrCantLoadReviews
+	}
+
+	order, ok := reviewSorts[sortBy]
+	if !ok {
+		order = reviewSorts[reviews.SortRecent]
+	}
+	opts := options.Find().SetSort(order).SetSkip(int64((page - 1) * perPage)).SetLimit(int64(perPage))
+	cursor, err := reviewCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, 0, ErrCantLoadReviews
+	}
+	list := make([]models.Review, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, 0, ErrCantLoadReviews
+	}
+	return list, total, nil
+}
+
+// RefreshRating recounts a product's approved reviews and stores the summary
+// on the product. The old single Rating is kept as the rounded average.
+func RefreshRating(ctx context.Context, reviewCollection, prodCollection *mongo.Collection, productID primitive.ObjectID) (models.RatingSummary, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.D{
+			primitive.E{Key: "product_id", Value: productID},
+			primitive.E{Key: "status", Value: models.ModerationApproved},
+		}}},
+		{{Key: "$group", Value: bson.D{
+			primitive.E{Key: "_id", Value: "$rating"},
+			primitive.E{Key: "count", Value: bson.D{{Key: "$sum", Value: 1}}},
+		}}},
+	}
+	cursor, err := reviewCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		log.Println(err)
+		return models.RatingSummary{}, ErrCantLoadReviews
+	}
+	var groups []struct {
+		Rating int `bson:"_id"`
+		Count  int `bson:"count"`
+	}
+	if err = cursor.All(ctx, &groups); err != nil {
+		log.Println(err)
+		return models.RatingSummary{}, ErrCantLoadReviews
+	}
+	counts := make(map[int]int)
+	for _, g := range groups {
+		counts[g.Rating] = g.Count
+	}
+	summary := reviews.Summarize(counts)
+
+	var rating interface{}
+	if summary.Count > 0 {
+		rating = uint(math.Round(summary.Average))
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: productID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "rating_summary", Value: summary},
+		primitive.E{Key: "rating", Value: rating},
+	}}}
+	if _, err = prodCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return summary, ErrCantSaveReview
+	}
+	return summary, nil
+}
@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrShipmentNotFound = errors.New("shipment not found")
+	ErrCantSaveShipment = errors.New("cannot save the shipment")
+	ErrCantLoadShipment = errors.New("cannot load the shipments")
+)
+
+// CreateShipment saves a shipment of an order that isn't cancelled. The
+// order is locked in the same transaction, so it can't be cancelled while
+// the shipment is being created.
+func CreateShipment(ctx context.Context, userCollection, shipmentCollection *mongo.Collection, shipment models.Shipment) (models.Shipment, error) {
+	userID, err := primitive.ObjectIDFromHex(shipment.User_ID)
+	if err != nil {
+		log.Println(err)
+		return shipment, ErrUserIdIsNotValid
+	}
+
+	now := time.Now()
+	shipment.Shipment_ID = primitive.NewObjectID()
+	shipment.Status = models.ShipmentLabelCreated
+	shipment.Events = []models.ShipmentEvent{{Status: models.ShipmentLabelCreated, Description: "Shipping label created", Occurred_At: now}}
+	shipment.Created_At = now
+	shipment.Updated_At = now
+	if shipment.Items == nil {
+		shipment.Items = make([]primitive.ObjectID, 0)
+	}
+
+	err = Transaction(ctx, func(ctx context.Context) error {
+		if err := lockOrder(ctx, userCollection, userID, shipment.Order_ID, nil); err != nil {
+			return err
+		}
+		_, err := shipmentCollection.InsertOne(ctx, shipment)
+		return err
+	})
+	if err == ErrOrderCancelled {
+		return shipment, err
+	}
+	if err != nil {
+		log.Println(err)
+		return shipment, ErrCantSaveShipment
+	}
+	return shipment, nil
+}
+
+func UpdateShipmentCarrier(ctx context.Context, shipmentCollection *mongo.Collection, shipmentID primitive.ObjectID, carrier string, trackingNumber string) error {
+	filter := bson.D{primitive.E{Key: "_id", Value: shipmentID}}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "carrier", Value: carrier},
+		primitive.E{Key: "tracking_number", Value: trackingNumber},
+		primitive.E{Key: "updated_at", Value: time.Now()},
+	}}}
+	result, err := shipmentCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveShipment
+	}
+	if result.MatchedCount == 0 {
+		return ErrShipmentNotFound
+	}
+	return nil
+}
+
+// AddShipmentEvent records a carrier scan and moves the shipment to its status.
+func AddShipmentEvent(ctx context.Context, shipmentCollection *mongo.Collection, shipmentID primitive.ObjectID, event models.ShipmentEvent) (models.Shipment, error) {
+	var shipment models.Shipment
+	filter := bson.D{primitive.E{Key: "_id", Value: shipmentID}}
+	update := bson.D{
+		{Key: "$push", Value: bson.D{primitive.E{Key: "events", Value: event}}},
+		{Key: "$set", Value: bson.D{
+			primitive.E{Key: "status", Value: event.Status},
+			primitive.E{Key: "updated_at", Value: time.Now()},
+		}},
+	}
+	err := shipmentCollection.FindOneAndUpdate(ctx, filter, update, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&shipment)
+	if err == mongo.ErrNoDocuments {
+		return shipment, ErrShipmentNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return shipment, ErrCantSaveShipment
+	}
+	return shipment, nil
+}
+
+func OrderShipments(ctx context.Context, shipmentCollection *mongo.Collection, orderID primitive.ObjectID) ([]models.Shipment, error) {
+	cursor, err := shipmentCollection.Find(ctx, bson.D{primitive.E{Key: "order_id", Value: orderID}}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadShipment
+	}
+	shipments := make([]models.Shipment, 0)
+	if err = cursor.All(ctx, &shipments); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadShipment
+	}
+	return shipments, nil
+}
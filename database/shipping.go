@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrShippingRateNotFound = errors.New("shipping rate not found")
+	ErrCantSaveShippingRate = errors.New("cannot save the shipping rate")
+	ErrCantLoadShippingRate = errors.New("cannot load the shipping rates")
+)
+
+func CreateShippingRate(ctx context.Context, shippingCollection *mongo.Collection, rate models.ShippingRate) (primitive.ObjectID, error) {
+	rate.Rate_ID = primitive.NewObjectID()
+	_, err := shippingCollection.InsertOne(ctx, rate)
+	if err != nil {
+		log.Println(err)
+		return primitive.NilObjectID, ErrCantSaveShippingRate
+	}
+	return rate.Rate_ID, nil
+}
+
+func ListShippingRates(ctx context.Context, shippingCollection *mongo.Collection) ([]models.ShippingRate, error) {
+	cursor, err := shippingCollection.Find(ctx, bson.D{})
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadShippingRate
+	}
+	rates := make([]models.ShippingRate, 0)
+	if err = cursor.All(ctx, &rates); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadShippingRate
+	}
+	return rates, nil
+}
+
+func DeleteShippingRate(ctx context.Context, shippingCollection *mongo.Collection, rateID primitive.ObjectID) error {
+	result, err := shippingCollection.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: rateID}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveShippingRate
+	}
+	if result.DeletedCount == 0 {
+		return ErrShippingRateNotFound
+	}
+	return nil
+}
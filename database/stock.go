@@ -0,0 +1,88 @@
+package database
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+)
+
+var ErrOutOfStock = errors.New("an item in the order is out of stock")
+
+// takeStock takes the ordered units out of the stock of every product in the
+// order that keeps one, inside the order's transaction. Products without a
+// stock, as the whole catalog was before stock was kept, sell without
+// limit, and products no longer in the catalog are skipped. It returns
+// ErrOutOfStock when a product has fewer units left than were ordered.
+func takeStock(ctx context.Context, prodCollection, outboxCollection *mongo.Collection, cart []models.ProductUser) error {
+	var order []primitive.ObjectID
+	units := make(map[primitive.ObjectID]int)
+	for _, item := range cart {
+		if units[item.Product_ID] == 0 {
+			order = append(order, item.Product_ID)
+		}
+		units[item.Product_ID]++
+	}
+
+	for _, productID := range order {
+		var product models.Product
+		filter := bson.D{
+			primitive.E{Key: "_id", Value: productID},
+			primitive.E{Key: "stock", Value: bson.D{{Key: "$gte", Value: units[productID]}}},
+		}
+		update := bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "stock", Value: -units[productID]}}}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := prodCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&product)
+		if err == mongo.ErrNoDocuments {
+			kept, err := prodCollection.CountDocuments(ctx, bson.D{
+				primitive.E{Key: "_id", Value: productID},
+				primitive.E{Key: "stock", Value: bson.D{{Key: "$exists", Value: true}}},
+			})
+			if err != nil {
+				return err
+			}
+			if kept > 0 {
+				return ErrOutOfStock
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = Publish(ctx, outboxCollection, events.ProductUpdated{Product: product}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// restock puts returned units back into the stock of the products that keep
+// one, the other way round from takeStock.
+func restock(ctx context.Context, prodCollection, outboxCollection *mongo.Collection, items []models.ReturnItem) error {
+	for _, item := range items {
+		var product models.Product
+		filter := bson.D{
+			primitive.E{Key: "_id", Value: item.Product_ID},
+			primitive.E{Key: "stock", Value: bson.D{{Key: "$exists", Value: true}}},
+		}
+		update := bson.D{{Key: "$inc", Value: bson.D{primitive.E{Key: "stock", Value: item.Quantity}}}}
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err := prodCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&product)
+		if err == mongo.ErrNoDocuments {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err = Publish(ctx, outboxCollection, events.ProductUpdated{Product: product}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
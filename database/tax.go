@@ -0,0 +1,55 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrTaxRateNotFound = errors.New("tax rate not found")
+	ErrCantSaveTaxRate = errors.New("cannot save the tax rate")
+	ErrCantLoadTaxRate = errors.New("cannot load the tax rates")
+)
+
+func CreateTaxRate(ctx context.Context, taxCollection *mongo.Collection, rate models.TaxRate) (primitive.ObjectID, error) {
+	rate.Rate_ID = primitive.NewObjectID()
+	_, err := taxCollection.InsertOne(ctx, rate)
+	if err != nil {
+		log.Println(err)
+		return primitive.NilObjectID, ErrCantSaveTaxRate
+	}
+	return rate.Rate_ID, nil
+}
+
+func ListTaxRates(ctx context.Context, taxCollection *mongo.Collection) ([]models.TaxRate, error) {
+	cursor, err := taxCollection.Find(ctx, bson.D{})
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadTaxRate
+	}
+	rates := make([]models.TaxRate, 0)
+	if err = cursor.All(ctx, &rates); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadTaxRate
+	}
+	return rates, nil
+}
+
+func DeleteTaxRate(ctx context.Context, taxCollection *mongo.Collection, rateID primitive.ObjectID) error {
+	result, err := taxCollection.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: rateID}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveTaxRate
+	}
+	if result.DeletedCount == 0 {
+		return ErrTaxRateNotFound
+	}
+	return nil
+}
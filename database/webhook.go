@@ -0,0 +1,268 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrWebhookNotFound    = errors.New("webhook not found")
+	ErrCantSaveWebhook    = errors.New("cannot save the webhook")
+	ErrCantLoadWebhooks   = errors.New("cannot load the webhooks")
+	ErrDeliveryNotFound   = errors.New("webhook delivery not found")
+	ErrDeliveryInProgress = errors.New("the webhook delivery is being sent")
+	ErrNoDeliveriesDue    = errors.New("no webhook deliveries are due")
+	ErrCantSaveDelivery   = errors.New("cannot save the webhook delivery")
+	ErrCantLoadDeliveries = errors.New("cannot load the webhook deliveries")
+)
+
+func CreateWebhook(ctx context.Context, webhookCollection *mongo.Collection, hook models.Webhook) (models.Webhook, error) {
+	hook.Webhook_ID = primitive.NewObjectID()
+	hook.Created_At = time.Now()
+	if _, err := webhookCollection.InsertOne(ctx, hook); err != nil {
+		log.Println(err)
+		return hook, ErrCantSaveWebhook
+	}
+	return hook, nil
+}
+
+func ListWebhooks(ctx context.Context, webhookCollection *mongo.Collection) ([]models.Webhook, error) {
+	cursor, err := webhookCollection.Find(ctx, bson.D{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}))
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadWebhooks
+	}
+	list := make([]models.Webhook, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadWebhooks
+	}
+	return list, nil
+}
+
+func FindWebhook(ctx context.Context, webhookCollection *mongo.Collection, webhookID primitive.ObjectID) (models.Webhook, error) {
+	var hook models.Webhook
+	err := webhookCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: webhookID}}).Decode(&hook)
+	if err == mongo.ErrNoDocuments {
+		return hook, ErrWebhookNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return hook, ErrCantLoadWebhooks
+	}
+	return hook, nil
+}
+
+// UpdateWebhook sets the given fields of a webhook and returns it as saved.
+func UpdateWebhook(ctx context.Context, webhookCollection *mongo.Collection, webhookID primitive.ObjectID, set bson.D) (models.Webhook, error) {
+	var hook models.Webhook
+	filter := bson.D{primitive.E{Key: "_id", Value: webhookID}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := webhookCollection.FindOneAndUpdate(ctx, filter, bson.D{{Key: "$set", Value: set}}, opts).Decode(&hook)
+	if err == mongo.ErrNoDocuments {
+		return hook, ErrWebhookNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return hook, ErrCantSaveWebhook
+	}
+	return hook, nil
+}
+
+// DeleteWebhook removes a webhook. Its deliveries are kept for the record
+// but no longer sent.
+func DeleteWebhook(ctx context.Context, webhookCollection *mongo.Collection, webhookID primitive.ObjectID) error {
+	result, err := webhookCollection.DeleteOne(ctx, bson.D{primitive.E{Key: "_id", Value: webhookID}})
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveWebhook
+	}
+	if result.DeletedCount == 0 {
+		return ErrWebhookNotFound
+	}
+	return nil
+}
+
+// SubscribedWebhooks returns the active webhooks subscribed to an event type.
+func SubscribedWebhooks(ctx context.Context, webhookCollection *mongo.Collection, eventType string) ([]models.Webhook, error) {
+	filter := bson.D{
+		primitive.E{Key: "active", Value: true},
+		primitive.E{Key: "events", Value: eventType},
+	}
+	cursor, err := webhookCollection.Find(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadWebhooks
+	}
+	list := make([]models.Webhook, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadWebhooks
+	}
+	return list, nil
+}
+
+// EnsureWebhookIndexes makes a delivery unique per webhook and outbox
+// message, which QueueWebhookDelivery's upsert relies on.
+func EnsureWebhookIndexes(ctx context.Context, deliveryCollection *mongo.Collection) error {
+	_, err := deliveryCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "webhook_id", Value: 1}, {Key: "message_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	return err
+}
+
+// QueueWebhookDelivery adds the delivery of an event to a webhook. An event
+// is only queued once per webhook, however often it is handed over.
+func QueueWebhookDelivery(ctx context.Context, deliveryCollection *mongo.Collection, delivery models.WebhookDelivery) error {
+	now := time.Now()
+	delivery.Delivery_ID = primitive.NewObjectID()
+	delivery.Status = models.WebhookPending
+	delivery.History = make([]models.WebhookAttempt, 0)
+	delivery.Next_Attempt_At = now
+	delivery.Created_At = now
+
+	filter := bson.D{
+		primitive.E{Key: "webhook_id", Value: delivery.Webhook_ID},
+		primitive.E{Key: "message_id", Value: delivery.Message_ID},
+	}
+	update := bson.D{{Key: "$setOnInsert", Value: delivery}}
+	_, err := deliveryCollection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+	if mongo.IsDuplicateKeyError(err) {
+		// queued by a concurrent handover
+		return nil
+	}
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveDelivery
+	}
+	return nil
+}
+
+// ClaimWebhookDelivery takes the next delivery that is due, or whose claim
+// ran out, and holds it for lease.
+func ClaimWebhookDelivery(ctx context.Context, deliveryCollection *mongo.Collection, lease time.Duration) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	now := time.Now()
+	filter := bson.D{{Key: "$or", Value: bson.A{
+		bson.D{
+			primitive.E{Key: "status", Value: models.WebhookPending},
+			primitive.E{Key: "next_attempt_at", Value: bson.D{{Key: "$lte", Value: now}}},
+		},
+		bson.D{
+			primitive.E{Key: "status", Value: models.WebhookSending},
+			primitive.E{Key: "locked_until", Value: bson.D{{Key: "$lt", Value: now}}},
+		},
+	}}}
+	update := bson.D{
+		{Key: "$set", Value: bson.D{
+			primitive.E{Key: "status", Value: models.WebhookSending},
+			primitive.E{Key: "locked_until", Value: now.Add(lease)},
+		}},
+		{Key: "$inc", Value: bson.D{primitive.E{Key: "attempts", Value: 1}}},
+	}
+	opts := options.FindOneAndUpdate().SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).SetReturnDocument(options.After)
+	err := deliveryCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return delivery, ErrNoDeliveriesDue
+	}
+	if err != nil {
+		log.Println(err)
+		return delivery, ErrCantLoadDeliveries
+	}
+	return delivery, nil
+}
+
+// RecordWebhookAttempt adds an attempt to a delivery's history and moves it
+// to status. A pending delivery is tried again at nextAttempt.
+func RecordWebhookAttempt(ctx context.Context, deliveryCollection *mongo.Collection, deliveryID primitive.ObjectID, attempt models.WebhookAttempt, status string, nextAttempt time.Time) error {
+	set := bson.D{
+		primitive.E{Key: "status", Value: status},
+		primitive.E{Key: "locked_until", Value: nil},
+		primitive.E{Key: "next_attempt_at", Value: nextAttempt},
+	}
+	if status == models.WebhookDelivered {
+		set = append(set, primitive.E{Key: "delivered_at", Value: attempt.At})
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: deliveryID}}
+	update := bson.D{
+		{Key: "$set", Value: set},
+		{Key: "$push", Value: bson.D{primitive.E{Key: "history", Value: attempt}}},
+	}
+	if _, err := deliveryCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantSaveDelivery
+	}
+	return nil
+}
+
+func FindWebhookDelivery(ctx context.Context, deliveryCollection *mongo.Collection, deliveryID primitive.ObjectID) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	err := deliveryCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: deliveryID}}).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return delivery, ErrDeliveryNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return delivery, ErrCantLoadDeliveries
+	}
+	return delivery, nil
+}
+
+// WebhookDeliveries returns a webhook's latest deliveries, newest first,
+// optionally only those in status.
+func WebhookDeliveries(ctx context.Context, deliveryCollection *mongo.Collection, webhookID primitive.ObjectID, status string, limit int64) ([]models.WebhookDelivery, error) {
+	filter := bson.D{primitive.E{Key: "webhook_id", Value: webhookID}}
+	if status != "" {
+		filter = append(filter, primitive.E{Key: "status", Value: status})
+	}
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(limit)
+	cursor, err := deliveryCollection.Find(ctx, filter, opts)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadDeliveries
+	}
+	list := make([]models.WebhookDelivery, 0)
+	if err = cursor.All(ctx, &list); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadDeliveries
+	}
+	return list, nil
+}
+
+// RedeliverWebhook queues a delivery to be sent again straight away with a
+// fresh set of attempts, whether it was delivered or failed.
+func RedeliverWebhook(ctx context.Context, deliveryCollection *mongo.Collection, deliveryID primitive.ObjectID) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+	filter := bson.D{
+		primitive.E{Key: "_id", Value: deliveryID},
+		primitive.E{Key: "status", Value: bson.D{{Key: "$ne", Value: models.WebhookSending}}},
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "status", Value: models.WebhookPending},
+		primitive.E{Key: "attempts", Value: 0},
+		primitive.E{Key: "next_attempt_at", Value: time.Now()},
+	}}}
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := deliveryCollection.FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		if _, err = FindWebhookDelivery(ctx, deliveryCollection, deliveryID); err != nil {
+			return delivery, err
+		}
+		return delivery, ErrDeliveryInProgress
+	}
+	if err != nil {
+		log.Println(err)
+		return delivery, ErrCantSaveDelivery
+	}
+	return delivery, nil
+}
@@ -0,0 +1,325 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/models"
+)
+
+const MaxWishlists = 20
+
+var (
+	ErrWishlistNotFound  = errors.New("wishlist not found")
+	ErrCantSaveWishlist  = errors.New("cannot save the wishlist")
+	ErrCantLoadWishlist  = errors.New("cannot load the wishlists")
+	ErrTooManyWishlists  = errors.New("too many wishlists")
+	ErrItemNotInWishlist = errors.New("the product is not on the wishlist")
+	ErrItemNotInCart     = errors.New("the product is not in the cart")
+	ErrItemNotSaved      = errors.New("the product is not saved for later")
+)
+
+func newShareToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func ownerFilter(wishlistID primitive.ObjectID, userID string) (bson.D, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIdIsNotValid
+	}
+	return bson.D{primitive.E{Key: "_id", Value: wishlistID}, primitive.E{Key: "user_id", Value: id}}, nil
+}
+
+func CreateWishlist(ctx context.Context, wishlistCollection *mongo.Collection, userID string, name string, public bool) (models.Wishlist, error) {
+	var wishlist models.Wishlist
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return wishlist, ErrUserIdIsNotValid
+	}
+	count, err := wishlistCollection.CountDocuments(ctx, bson.D{primitive.E{Key: "user_id", Value: id}})
+	if err != nil {
+		log.Println(err)
+		return wishlist, ErrCantSaveWishlist
+	}
+	if count >= MaxWishlists {
+		return wishlist, ErrTooManyWishlists
+	}
+
+	token, err := newShareToken()
+	if err != nil {
+		log.Println(err)
+		return wishlist, ErrCantSaveWishlist
+	}
+	now := time.Now()
+	wishlist = models.Wishlist{
+		Wishlist_ID: primitive.NewObjectID(),
+		User_ID:     id,
+		Name:        name,
+		Public:      public,
+		Share_Token: token,
+		Items:       make([]models.ProductUser, 0),
+		Created_At:  now,
+		Updated_At:  now,
+	}
+	if _, err = wishlistCollection.InsertOne(ctx, wishlist); err != nil {
+		log.Println(err)
+		return wishlist, ErrCantSaveWishlist
+	}
+	return wishlist, nil
+}
+
+func ListWishlists(ctx context.Context, wishlistCollection *mongo.Collection, userID string) ([]models.Wishlist, error) {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return nil, ErrUserIdIsNotValid
+	}
+	cursor, err := wishlistCollection.Find(ctx, bson.D{primitive.E{Key: "user_id", Value: id}})
+	if err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadWishlist
+	}
+	wishlists := make([]models.Wishlist, 0)
+	if err = cursor.All(ctx, &wishlists); err != nil {
+		log.Println(err)
+		return nil, ErrCantLoadWishlist
+	}
+	return wishlists, nil
+}
+
+func FindWishlist(ctx context.Context, wishlistCollection *mongo.Collection, wishlistID primitive.ObjectID, userID string) (models.Wishlist, error) {
+	var wishlist models.Wishlist
+	filter, err := ownerFilter(wishlistID, userID)
+	if err != nil {
+		return wishlist, err
+	}
+	err = wishlistCollection.FindOne(ctx, filter).Decode(&wishlist)
+	if err == mongo.ErrNoDocuments {
+		return wishlist, ErrWishlistNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return wishlist, ErrCantLoadWishlist
+	}
+	return wishlist, nil
+}
+
+// SharedWishlist finds a public wishlist by its share token. Private lists
+// are reported as not found so the token doesn't reveal they exist.
+func SharedWishlist(ctx context.Context, wishlistCollection *mongo.Collection, token string) (models.Wishlist, error) {
+	var wishlist models.Wishlist
+	filter := bson.D{primitive.E{Key: "share_token", Value: token}, primitive.E{Key: "public", Value: true}}
+	err := wishlistCollection.FindOne(ctx, filter).Decode(&wishlist)
+	if err == mongo.ErrNoDocuments {
+		return wishlist, ErrWishlistNotFound
+	}
+	if err != nil {
+		log.Println(err)
+		return wishlist, ErrCantLoadWishlist
+	}
+	return wishlist, nil
+}
+
+func UpdateWishlist(ctx context.Context, wishlistCollection *mongo.Collection, wishlistID primitive.ObjectID, userID string, name string, public bool) error {
+	filter, err := ownerFilter(wishlistID, userID)
+	if err != nil {
+		return err
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "name", Value: name},
+		primitive.E{Key: "public", Value: public},
+		primitive.E{Key: "updated_at", Value: time.Now()},
+	}}}
+	result, err := wishlistCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveWishlist
+	}
+	if result.MatchedCount == 0 {
+		return ErrWishlistNotFound
+	}
+	return nil
+}
+
+// RotateShareToken replaces the share token so links handed out before stop
+// working.
+func RotateShareToken(ctx context.Context, wishlistCollection *mongo.Collection, wishlistID primitive.ObjectID, userID string) (string, error) {
+	filter, err := ownerFilter(wishlistID, userID)
+	if err != nil {
+		return "", err
+	}
+	token, err := newShareToken()
+	if err != nil {
+		log.Println(err)
+		return "", ErrCantSaveWishlist
+	}
+	update := bson.D{{Key: "$set", Value: bson.D{
+		primitive.E{Key: "share_token", Value: token},
+		primitive.E{Key: "updated_at", Value: time.Now()},
+	}}}
+	result, err := wishlistCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return "", ErrCantSaveWishlist
+	}
+	if result.MatchedCount == 0 {
+		return "", ErrWishlistNotFound
+	}
+	return token, nil
+}
+
+func DeleteWishlist(ctx context.Context, wishlistCollection *mongo.Collection, wishlistID primitive.ObjectID, userID string) error {
+	filter, err := ownerFilter(wishlistID, userID)
+	if err != nil {
+		return err
+	}
+	result, err := wishlistCollection.DeleteOne(ctx, filter)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveWishlist
+	}
+	if result.DeletedCount == 0 {
+		return ErrWishlistNotFound
+	}
+	return nil
+}
+
+// AddWishlistItem puts a product on the wishlist. A product already on the
+// list is left as it is.
+func AddWishlistItem(ctx context.Context, prodCollection, wishlistCollection *mongo.Collection, wishlistID primitive.ObjectID, userID string, productID primitive.ObjectID) error {
+	filter, err := ownerFilter(wishlistID, userID)
+	if err != nil {
+		return err
+	}
+
+	var product models.ProductUser
+	err = prodCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: productID}}).Decode(&product)
+	if err != nil {
+		log.Println(err)
+		return ErrCantFindProduct
+	}
+
+	if _, err = FindWishlist(ctx, wishlistCollection, wishlistID, userID); err != nil {
+		return err
+	}
+	filter = append(filter, primitive.E{Key: "items._id", Value: bson.D{{Key: "$ne", Value: productID}}})
+	update := bson.D{
+		{Key: "$push", Value: bson.D{primitive.E{Key: "items", Value: product}}},
+		{Key: "$set", Value: bson.D{primitive.E{Key: "updated_at", Value: time.Now()}}},
+	}
+	if _, err = wishlistCollection.UpdateOne(ctx, filter, update); err != nil {
+		log.Println(err)
+		return ErrCantSaveWishlist
+	}
+	return nil
+}
+
+func RemoveWishlistItem(ctx context.Context, wishlistCollection *mongo.Collection, wishlistID primitive.ObjectID, userID string, productID primitive.ObjectID) error {
+	filter, err := ownerFilter(wishlistID, userID)
+	if err != nil {
+		return err
+	}
+	filter = append(filter, primitive.E{Key: "items._id", Value: productID})
+	update := bson.D{
+		{Key: "$pull", Value: bson.D{primitive.E{Key: "items", Value: bson.D{primitive.E{Key: "_id", Value: productID}}}}},
+		{Key: "$set", Value: bson.D{primitive.E{Key: "updated_at", Value: time.Now()}}},
+	}
+	result, err := wishlistCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantSaveWishlist
+	}
+	if result.MatchedCount == 0 {
+		return ErrItemNotInWishlist
+	}
+	return nil
+}
+
+// moveLines moves every line for productID from one list on the user to
+// another in a single write, so a line is never lost or duplicated.
+func moveLines(ctx context.Context, userCollection *mongo.Collection, userID string, productID primitive.ObjectID, from, to string, notFound error) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+
+	var user models.Users
+	err = userCollection.FindOne(ctx, bson.D{primitive.E{Key: "_id", Value: id}}).Decode(&user)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+	source := user.UserCart
+	if from == "saved_for_later" {
+		source = user.Saved_For_Later
+	}
+	var moved []models.ProductUser
+	for _, line := range source {
+		if line.Product_ID == productID {
+			moved = append(moved, line)
+		}
+	}
+	if len(moved) == 0 {
+		return notFound
+	}
+
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: from + "._id", Value: productID}}
+	update := bson.D{
+		{Key: "$pull", Value: bson.D{primitive.E{Key: from, Value: bson.D{primitive.E{Key: "_id", Value: productID}}}}},
+		{Key: "$push", Value: bson.D{primitive.E{Key: to, Value: bson.D{{Key: "$each", Value: moved}}}}},
+	}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantupdateUser
+	}
+	if result.MatchedCount == 0 {
+		return notFound
+	}
+	return nil
+}
+
+// SaveForLater moves a product's cart lines to the saved for later list.
+func SaveForLater(ctx context.Context, userCollection *mongo.Collection, userID string, productID primitive.ObjectID) error {
+	return moveLines(ctx, userCollection, userID, productID, "usercart", "saved_for_later", ErrItemNotInCart)
+}
+
+// MoveToCart puts saved for later lines back in the cart.
+func MoveToCart(ctx context.Context, userCollection *mongo.Collection, userID string, productID primitive.ObjectID) error {
+	return moveLines(ctx, userCollection, userID, productID, "saved_for_later", "usercart", ErrItemNotSaved)
+}
+
+func RemoveSavedItem(ctx context.Context, userCollection *mongo.Collection, userID string, productID primitive.ObjectID) error {
+	id, err := primitive.ObjectIDFromHex(userID)
+	if err != nil {
+		log.Println(err)
+		return ErrUserIdIsNotValid
+	}
+	filter := bson.D{primitive.E{Key: "_id", Value: id}, primitive.E{Key: "saved_for_later._id", Value: productID}}
+	update := bson.D{{Key: "$pull", Value: bson.D{primitive.E{Key: "saved_for_later", Value: bson.D{primitive.E{Key: "_id", Value: productID}}}}}}
+	result, err := userCollection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		log.Println(err)
+		return ErrCantupdateUser
+	}
+	if result.MatchedCount == 0 {
+		return ErrItemNotSaved
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+package events
+
+import (
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+// Event types, as stored in the outbox and sent to subscribers.
+const (
+	TypeOrderPlaced    = "order.placed"
+	TypeOrderCancelled = "order.cancelled"
+	TypeProductUpdated = "product.updated"
+	TypeUserSignedUp   = "user.signed_up"
+)
+
+// Event is something that happened in the shop that other parts of the
+// system react to after it has been saved.
+type Event interface {
+	Type() string
+}
+
+type OrderPlaced struct {
+	User_ID string       `json:"user_id" bson:"user_id"`
+	Order   models.Order `json:"order" bson:"order"`
+}
+
+type OrderCancelled struct {
+	User_ID      string             `json:"user_id" bson:"user_id"`
+	Order_ID     primitive.ObjectID `json:"order_id" bson:"order_id"`
+	Reason       string             `json:"reason" bson:"reason"`
+	Cancelled_At time.Time          `json:"cancelled_at" bson:"cancelled_at"`
+}
+
+// ProductUpdated carries the product as it was after the change.
+type ProductUpdated struct {
+	Product models.Product `json:"product" bson:"product"`
+}
+
+type UserSignedUp struct {
+	User_ID    string `json:"user_id" bson:"user_id"`
+	Email      string `json:"email" bson:"email"`
+	First_Name string `json:"first_name" bson:"first_name"`
+	Locale     string `json:"locale" bson:"locale"`
+}
+
+func (OrderPlaced) Type() string    { return TypeOrderPlaced }
+func (OrderCancelled) Type() string { return TypeOrderCancelled }
+func (ProductUpdated) Type() string { return TypeProductUpdated }
+func (UserSignedUp) Type() string   { return TypeUserSignedUp }
+
+// Decode turns an outbox payload back into its typed event.
+func Decode(eventType string, payload bson.Raw) (Event, error) {
+	switch eventType {
+	case TypeOrderPlaced:
+		var e OrderPlaced
+		if err := bson.Unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case TypeOrderCancelled:
+		var e OrderCancelled
+		if err := bson.Unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case TypeProductUpdated:
+		var e ProductUpdated
+		if err := bson.Unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	case TypeUserSignedUp:
+		var e UserSignedUp
+		if err := bson.Unmarshal(payload, &e); err != nil {
+			return nil, err
+		}
+		return e, nil
+	}
+	return nil, fmt.Errorf("events: unknown event type %q", eventType)
+}
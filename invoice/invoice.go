@@ -0,0 +1,202 @@
+package invoice
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+// Number formats the n-th number of a kind, e.g. INV-000042 or CN-000007.
+func Number(kind string, n int64) string {
+	prefix := "INV"
+	if kind == models.InvoiceKindCreditNote {
+		prefix = "CN"
+	}
+	return fmt.Sprintf("%s-%06d", prefix, n)
+}
+
+func describe(name *string, id primitive.ObjectID) string {
+	if name != nil && *name != "" {
+		return *name
+	}
+	return "Product " + id.Hex()
+}
+
+// lines groups the order's one-line-per-unit cart into one invoice line per
+// product, with the tax charged on it.
+func lines(order models.Order) ([]models.InvoiceLine, error) {
+	currency := order.Price.Currency
+	taxes := make(map[primitive.ObjectID]models.Money)
+	for _, tl := range order.Tax_Lines {
+		sum, ok := taxes[tl.Product_ID]
+		if !ok {
+			sum = models.ZeroMoney(tl.Tax.Currency)
+		}
+		sum, err := sum.Add(tl.Tax)
+		if err != nil {
+			return nil, err
+		}
+		taxes[tl.Product_ID] = sum
+	}
+
+	result := make([]models.InvoiceLine, 0)
+	index := make(map[primitive.ObjectID]int)
+	for _, item := range order.Order_Cart {
+		if i, seen := index[item.Product_ID]; seen {
+			line := &result[i]
+			line.Quantity++
+			amount, err := line.Amount.Add(item.Price)
+			if err != nil {
+				return nil, err
+			}
+			line.Amount = amount
+			continue
+		}
+		tax, ok := taxes[item.Product_ID]
+		if !ok {
+			tax = models.ZeroMoney(currency)
+		}
+		index[item.Product_ID] = len(result)
+		result = append(result, models.InvoiceLine{
+			Product_ID:  item.Product_ID,
+			Description: describe(item.Product_Name, item.Product_ID),
+			Quantity:    1,
+			Unit_Price:  item.Price,
+			Tax:         tax,
+			Amount:      item.Price,
+		})
+	}
+	return result, nil
+}
+
+func orZero(m *models.Money, currency string) models.Money {
+	if m == nil {
+		return models.ZeroMoney(currency)
+	}
+	return *m
+}
+
+// Build makes the invoice of an order. It is given its number when saved.
+func Build(order models.Order, userID string, seller string, now time.Time) (models.Invoice, error) {
+	items, err := lines(order)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	prices := make([]models.Money, 0, len(items))
+	for _, line := range items {
+		prices = append(prices, line.Amount)
+	}
+	subtotal, err := models.SumMoney(order.Price.Currency, prices...)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+
+	return models.Invoice{
+		Kind:             models.InvoiceKindInvoice,
+		Order_ID:         order.Order_ID,
+		User_ID:          userID,
+		Seller:           seller,
+		Issued_At:        now,
+		Ordered_At:       order.Ordered_At,
+		Billing_Address:  order.Billing_Address,
+		Shipping_Address: order.Shipping_Address,
+		Lines:            items,
+		Subtotal:         subtotal,
+		Discount:         orZero(order.Discount, order.Price.Currency),
+		Coupon_Code:      order.Coupon_Code,
+		Tax:              orZero(&order.Tax, order.Price.Currency),
+		Tax_Inclusive:    order.Tax_Inclusive,
+		Shipping:         orZero(&order.Shipping, order.Price.Currency),
+		Total:            order.Price,
+	}, nil
+}
+
+// Cancellation makes the credit note for a cancelled order. It credits the
+// whole invoice, so its lines and totals are the invoice's own.
+func Cancellation(inv models.Invoice, now time.Time) models.Invoice {
+	note := inv
+	note.Invoice_ID = primitive.ObjectID{}
+	note.Number = ""
+	note.Kind = models.InvoiceKindCreditNote
+	note.Refund_ID = nil
+	note.Invoice_Number = inv.Number
+	note.Issued_At = now
+	return note
+}
+
+// CreditNote makes the credit note for a refund on an order. Its lines are
+// the returned items at their invoiced price; the tax credited is the
+// refund's share of the order's tax, and whatever else the refund held back
+// shows as the discount.
+func CreditNote(order models.Order, invoiceNumber string, r models.Return, refund models.Refund, seller string, now time.Time) (models.Invoice, error) {
+	currency := refund.Amount.Currency
+	items := make([]models.InvoiceLine, 0, len(r.Items))
+	subtotal := models.ZeroMoney(currency)
+	for _, item := range r.Items {
+		amount, err := item.Unit_Price.Mul(int64(item.Quantity))
+		if err != nil {
+			return models.Invoice{}, err
+		}
+		if subtotal, err = subtotal.Add(amount); err != nil {
+			return models.Invoice{}, err
+		}
+		items = append(items, models.InvoiceLine{
+			Product_ID:  item.Product_ID,
+			Description: describe(item.Product_Name, item.Product_ID),
+			Quantity:    item.Quantity,
+			Unit_Price:  item.Unit_Price,
+			Tax:         models.ZeroMoney(currency),
+			Amount:      amount,
+		})
+	}
+
+	tax := models.ZeroMoney(currency)
+	goods, err := order.Price.Sub(order.Shipping)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if !goods.IsZero() {
+		if tax, err = refund.Amount.MulRat(new(big.Rat).SetFrac64(order.Tax.Amount, goods.Amount)); err != nil {
+			return models.Invoice{}, err
+		}
+	}
+
+	net := refund.Amount
+	if !order.Tax_Inclusive {
+		if net, err = net.Sub(tax); err != nil {
+			return models.Invoice{}, err
+		}
+	}
+	discount, err := subtotal.Sub(net)
+	if err != nil {
+		return models.Invoice{}, err
+	}
+	if discount.IsNegative() {
+		discount = models.ZeroMoney(currency)
+	}
+
+	refundID := refund.Refund_ID
+	return models.Invoice{
+		Kind:             models.InvoiceKindCreditNote,
+		Order_ID:         order.Order_ID,
+		User_ID:          refund.User_ID,
+		Refund_ID:        &refundID,
+		Invoice_Number:   invoiceNumber,
+		Seller:           seller,
+		Issued_At:        now,
+		Ordered_At:       order.Ordered_At,
+		Billing_Address:  order.Billing_Address,
+		Shipping_Address: order.Shipping_Address,
+		Lines:            items,
+		Subtotal:         subtotal,
+		Discount:         discount,
+		Tax:              tax,
+		Tax_Inclusive:    order.Tax_Inclusive,
+		Shipping:         models.ZeroMoney(currency),
+		Total:            refund.Amount,
+	}, nil
+}
@@ -0,0 +1,200 @@
+package invoice
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/mreym/shopping/models"
+)
+
+// The PDF is drawn in Courier, one of the standard fonts every reader has, so
+// nothing needs embedding and columns line up by counting characters.
+const (
+	pageWidth  = 595.0 // A4 in points
+	pageHeight = 842.0
+	margin     = 50.0
+	fontSize   = 9.0
+	lineHeight = 12.0
+	// columns is how many Courier characters (0.6 em wide) fit between the
+	// margins
+	columns = 91
+)
+
+type pdfWriter struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (w *pdfWriter) newPage() {
+	w.pages = append(w.pages, new(bytes.Buffer))
+	w.y = pageHeight - margin
+}
+
+// winAnsi encodes s for the standard fonts, which only know Latin-1 here.
+func winAnsi(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
+
+func (w *pdfWriter) line(text string, bold bool) {
+	if w.y < margin {
+		w.newPage()
+	}
+	font := "F1"
+	if bold {
+		font = "F2"
+	}
+	fmt.Fprintf(w.pages[len(w.pages)-1], "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, fontSize, margin, w.y, winAnsi(text))
+	w.y -= lineHeight
+}
+
+func (w *pdfWriter) gap() {
+	w.y -= lineHeight / 2
+}
+
+func fit(s string, width int) string {
+	r := []rune(s)
+	if len(r) > width {
+		return string(r[:width-1]) + "~"
+	}
+	return s + strings.Repeat(" ", width-len(r))
+}
+
+func right(s string, width int) string {
+	r := []rune(s)
+	if len(r) >= width {
+		return s
+	}
+	return strings.Repeat(" ", width-len(r)) + s
+}
+
+func addressLines(title string, address *models.Address) []string {
+	if address == nil {
+		return nil
+	}
+	out := []string{title}
+	for _, part := range []*string{address.House, address.Street} {
+		if part != nil && *part != "" {
+			out = append(out, "  "+*part)
+		}
+	}
+	cityLine := strings.TrimSpace(strings.Join([]string{value(address.City), value(address.Pincode), value(address.Country)}, " "))
+	if cityLine != "" {
+		out = append(out, "  "+cityLine)
+	}
+	return out
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// PDF renders an invoice or credit note as a PDF document.
+func PDF(inv models.Invoice) []byte {
+	w := &pdfWriter{}
+	w.newPage()
+
+	title := "INVOICE"
+	if inv.Kind == models.InvoiceKindCreditNote {
+		title = "CREDIT NOTE"
+	}
+	w.line(inv.Seller, true)
+	w.line(title+" "+inv.Number, true)
+	w.gap()
+	w.line("Issued:     "+inv.Issued_At.Format("2006-01-02"), false)
+	w.line("Order:      "+inv.Order_ID.Hex(), false)
+	w.line("Ordered:    "+inv.Ordered_At.Format("2006-01-02"), false)
+	if inv.Invoice_Number != "" {
+		w.line("Credits:    invoice "+inv.Invoice_Number, false)
+	}
+	w.gap()
+	for _, text := range addressLines("Bill to:", inv.Billing_Address) {
+		w.line(text, false)
+	}
+	for _, text := range addressLines("Ship to:", inv.Shipping_Address) {
+		w.line(text, false)
+	}
+	w.gap()
+
+	const qtyW, priceW, taxW, amountW = 5, 14, 12, 14
+	descW := columns - qtyW - priceW - taxW - amountW
+	w.line(fit("Description", descW)+right("Qty", qtyW)+right("Unit price", priceW)+right("Tax", taxW)+right("Amount", amountW), true)
+	w.line(strings.Repeat("-", columns), false)
+	for _, l := range inv.Lines {
+		w.line(fit(l.Description, descW)+right(fmt.Sprint(l.Quantity), qtyW)+right(l.Unit_Price.Decimal(), priceW)+right(l.Tax.Decimal(), taxW)+right(l.Amount.Decimal(), amountW), false)
+	}
+	w.line(strings.Repeat("-", columns), false)
+
+	label := columns - amountW
+	total := func(name string, amount string, bold bool) {
+		w.line(right(name, label)+right(amount, amountW), bold)
+	}
+	total("Subtotal", inv.Subtotal.Decimal(), false)
+	if !inv.Discount.IsZero() {
+		name := "Discount"
+		if inv.Coupon_Code != nil {
+			name += " (" + *inv.Coupon_Code + ")"
+		}
+		total(name, "-"+inv.Discount.Decimal(), false)
+	}
+	if inv.Tax_Inclusive {
+		total("Tax included", inv.Tax.Decimal(), false)
+	} else {
+		total("Tax", inv.Tax.Decimal(), false)
+	}
+	if !inv.Shipping.IsZero() {
+		total("Shipping", inv.Shipping.Decimal(), false)
+	}
+	total("Total "+inv.Total.Currency, inv.Total.Decimal(), true)
+
+	return assemble(w.pages)
+}
+
+// assemble writes the page contents out as a PDF file with its cross
+// reference table.
+func assemble(pages []*bytes.Buffer) []byte {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	// objects 1-4 are fixed; each page then takes a page and a content object
+	kids := make([]string, 0, len(pages))
+	for i := range pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", 5+2*i))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>")
+	for i, content := range pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>", pageWidth, pageHeight, 6+2*i))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
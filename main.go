@@ -1,14 +1,21 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 
+	"github.com/mreym/shopping/cartmerge"
 	"github.com/mreym/shopping/controllers"
 	"github.com/mreym/shopping/database"
 	"github.com/mreym/shopping/middleware"
+	"github.com/mreym/shopping/moderation"
+	"github.com/mreym/shopping/postal"
 	"github.com/mreym/shopping/routes"
 )
 
@@ -25,18 +32,115 @@ func main() {
 	// Create an instance of your application
 	app := controllers.NewApplication(prodCollection, userCollection)
 
+	// Check postal codes against the offline dataset when one is provided
+	if path := os.Getenv("POSTAL_DATASET_FILE"); path != "" {
+		dataset, err := postal.LoadDataset(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		controllers.AddressValidator = postal.Chain{postal.FormatValidator{}, dataset}
+	}
+
+	// Screen customer text with the configured word lists instead of the
+	// built-in one
+	if paths := os.Getenv("MODERATION_WORDLISTS"); paths != "" {
+		filters := moderation.Pipeline{}
+		for _, path := range strings.Split(paths, ",") {
+			list, err := moderation.LoadWordList(strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)), path)
+			if err != nil {
+				log.Fatal(err)
+			}
+			filters = append(filters, list)
+		}
+		controllers.ContentFilter = append(filters, moderation.Links{}, controllers.DuplicateFilter)
+	}
+
+	if err := cartmerge.Check(controllers.CartMergeRule); err != nil {
+		log.Fatal("CART_MERGE_RULE: ", err)
+	}
+
+	// Create the unique indexes and migrate old documents before serving
+	// anything that relies on them
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	if err := controllers.EnsureIndexes(ctx); err != nil {
+		log.Fatal("creating indexes: ", err)
+	}
+	if err := controllers.Migrate(ctx); err != nil {
+		log.Fatal("migrating: ", err)
+	}
+	cancel()
+
+	// Warm up the search suggestion index
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+	if err := controllers.RefreshSearchIndex(ctx); err != nil {
+		log.Println(err)
+	}
+	cancel()
+
+	// Deliver the events written to the outbox, and send them on to webhooks
+	go controllers.NewDispatcher().Run(context.Background())
+	go controllers.DeliverWebhooks(context.Background())
+
 	// Create a Gin router
 	router := gin.New()
 	router.Use(gin.Logger())
 
+	// Only take the client address from X-Forwarded-For when the request
+	// came through one of our own proxies, as sign-in lockouts rely on it
+	if err := router.SetTrustedProxies(controllers.TrustedProxies); err != nil {
+		log.Fatal("TRUSTED_PROXIES: ", err)
+	}
+
 	// Register your routes
 	routes.UserRoutes(router)
+	routes.AdminRoutes(router)
 	router.Use(middleware.Authentication())
 
 	router.GET("/addtocart", app.AddToCart())
 	router.GET("/removeitem", app.RemoveItem())
 	router.GET("/cartcheckout", app.BuyFromCart())
+	router.POST("/cartcheckout", app.BuyFromCart())
 	router.GET("/instantbuy", app.InstantBuy())
+	router.POST("/instantbuy", app.InstantBuy())
+	router.GET("/listcart", app.GetItemFromCart())
+	router.GET("/orders", app.ListOrders())
+	router.GET("/orders/:id/tracking", app.OrderTracking())
+	router.POST("/orders/:id/cancel", app.CancelOrder())
+	router.POST("/orders/:id/returns", app.RequestReturn())
+	router.GET("/orders/:id/invoice", controllers.OrderInvoice())
+	router.GET("/orders/:id/credit-notes/:number", controllers.OrderCreditNote())
+	router.GET("/returns", controllers.ListMyReturns())
+	router.PUT("/users/currency", controllers.SetDisplayCurrency())
+	router.POST("/users/verify/resend", controllers.ResendVerification())
+	router.POST("/cart/coupon", app.ApplyCoupon())
+	router.DELETE("/cart/coupon", app.RemoveCoupon())
+	router.GET("/cart/shipping-options", app.ShippingOptions())
+	router.POST("/cart/prices/accept", app.AcceptCartPrices())
+	router.GET("/addresses", controllers.ListAddresses())
+	router.POST("/addresses", controllers.AddAddress())
+	router.PUT("/addresses/:id", controllers.EditAddress())
+	router.DELETE("/addresses/:id", controllers.DeleteAddress())
+	router.PUT("/addresses/:id/default", controllers.SetDefaultAddress())
+	router.GET("/wishlists", controllers.ListWishlists())
+	router.POST("/wishlists", controllers.CreateWishlist())
+	router.GET("/wishlists/:id", controllers.GetWishlist())
+	router.PUT("/wishlists/:id", controllers.UpdateWishlist())
+	router.DELETE("/wishlists/:id", controllers.DeleteWishlist())
+	router.POST("/wishlists/:id/share", controllers.ShareWishlist())
+	router.POST("/wishlists/:id/items/:product", app.AddWishlistItem())
+	router.DELETE("/wishlists/:id/items/:product", controllers.RemoveWishlistItem())
+	router.POST("/wishlists/:id/items/:product/cart", app.WishlistItemToCart())
+	router.GET("/cart/saved", app.ListSavedForLater())
+	router.POST("/cart/saved/:product", app.SaveForLater())
+	router.POST("/cart/saved/:product/cart", app.MoveSavedToCart())
+	router.DELETE("/cart/saved/:product", app.RemoveSavedItem())
+	router.POST("/products/:id/reviews", app.PostReview())
+	router.PUT("/reviews/:id", controllers.UpdateReview())
+	router.DELETE("/reviews/:id", controllers.DeleteReview())
+	router.POST("/reviews/:id/helpful", controllers.VoteReviewHelpful())
+	router.POST("/products/:id/questions", app.AskQuestion())
+	router.POST("/questions/:id/answers", app.AnswerQuestion())
+	router.POST("/answers/:id/upvote", controllers.UpvoteAnswer())
 
 	// Start the server
 	log.Fatal(router.Run(":" + port))
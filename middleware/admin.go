@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"os"
+
+	"github.com/gin-gonic/gin"
+)
+
+var ADMIN_KEY = os.Getenv("ADMIN_KEY")
+
+// AdminAuthentication guards the /admin routes with the shared ADMIN_KEY.
+// When the key is not configured every admin request is refused.
+func AdminAuthentication() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		adminKey := c.Request.Header.Get("admin_key")
+		if ADMIN_KEY == "" || subtle.ConstantTimeCompare([]byte(adminKey), []byte(ADMIN_KEY)) != 1 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "admin access required"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -25,6 +25,12 @@ func Authentication() gin.HandlerFunc {
 			return
 		}
 
+		if msg := token.CheckSession(c.Request.Context(), claims); msg != "" {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": msg})
+			c.Abort()
+			return
+		}
+
 		c.Set("emails", claims.Email)
 		c.Set("uid", claims.Uid)
 		c.Next()
@@ -3,60 +3,593 @@ package models
 import (
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Users struct {
-	ID              primitive.ObjectID `json:"_id" bson:"_id"`
-	First_Name      *string            `json:"first_name"          validate: "required,min=2,max=30"`
-	Last_Name       *string            `json:"last_name"           validate: "required,min=2,max=30"`
-	Password        *string            `json:"password"            validate: "required,min=6"`
-	Email           *string            `json:"gmail"               validate: "gmail, required"`
-	Phone           *string            `json:"phone"               validate: "required"`
-	Token           *string            `json:"token"`
-	Refresh_Token   *string            `json:"refresh_token"`
-	Created_At      time.Time          `json:"create_at"`
-	Updated_At      time.Time          `json:"update_at"`
-	User_ID         string             `json:"user_id"`
-	UserCart        []ProductUser      `json:"usercart" bson:"usercart"`
-	Address_Details []Address          `json:"address" bson:"address"`
-	Order_Status    []Order            `json:"order" bson:"order"`
+	ID               primitive.ObjectID `json:"_id" bson:"_id"`
+	First_Name       *string            `json:"first_name" validate:"required,min=2,max=30"`
+	Last_Name        *string            `json:"last_name" validate:"required,min=2,max=30"`
+	Password         *string            `json:"password" validate:"required,min=6"`
+	Email            *string            `json:"gmail" validate:"required,email"`
+	Phone            *string            `json:"phone" validate:"required"`
+	Token            *string            `json:"token"`
+	Refresh_Token    *string            `json:"refresh_token"`
+	Created_At       time.Time          `json:"create_at"`
+	Updated_At       time.Time          `json:"update_at"`
+	User_ID          string             `json:"user_id"`
+	UserCart         []ProductUser      `json:"usercart" bson:"usercart"`
+	Saved_For_Later  []ProductUser      `json:"saved_for_later" bson:"saved_for_later"`
+	Address_Details  []Address          `json:"address" bson:"address"`
+	Order_Status     []Order            `json:"order" bson:"orders"`
+	Display_Currency *string            `json:"display_currency" bson:"display_currency"`
+	Locale           *string            `json:"locale" bson:"locale"`
+	Applied_Coupon   *string            `json:"applied_coupon" bson:"applied_coupon"`
+	Email_Verified   bool               `json:"email_verified" bson:"email_verified"`
+	Verification     *EmailVerification `json:"-" bson:"verification"`
+	Password_Reset   *PasswordReset     `json:"-" bson:"password_reset"`
+	Session_Version  int                `json:"-" bson:"session_version"`
+}
+
+// EmailVerification is the outstanding verification email of a user. Sends
+// counts the emails sent since Window_Start, for throttling resends.
+type EmailVerification struct {
+	Token_Hash   string    `bson:"token_hash"`
+	Expires_At   time.Time `bson:"expires_at"`
+	Sent_At      time.Time `bson:"sent_at"`
+	Sends        int       `bson:"sends"`
+	Window_Start time.Time `bson:"window_start"`
+}
+
+// PasswordReset is the outstanding password reset link of a user.
+type PasswordReset struct {
+	Token_Hash   string    `bson:"token_hash"`
+	Expires_At   time.Time `bson:"expires_at"`
+	Requested_At time.Time `bson:"requested_at"`
 }
 
 type Product struct {
-	Product_ID   primitive.ObjectID `bson:"_id"`
-	Product_Name *string            `json:"product_name"`
-	Price        int                `json:"price"`
-	Rating       *uint              `json:"rating"`
-	Image        *string            `json:"image"`
+	Product_ID     primitive.ObjectID `bson:"_id"`
+	Product_Name   *string            `json:"product_name"`
+	Category       *string            `json:"category"`
+	Tax_Class      *string            `json:"tax_class"`
+	Weight_Grams   int                `json:"weight_grams"`
+	Price          Money              `json:"price"`
+	Display_Price  *Money             `json:"display_price,omitempty" bson:"-"`
+	Rating         *uint              `json:"rating"`
+	Image          *string            `json:"image"`
+	Stock          *int               `json:"stock,omitempty" bson:"stock,omitempty"`
+	Rating_Summary *RatingSummary     `json:"rating_summary"`
 }
 
 type ProductUser struct {
-	Product_ID   primitive.ObjectID `bson:"_id"`
-	Product_Name *string            `json:"product_name" bson:"product_id"`
-	Price        int                `json:"price" bson:"price"`
-	Rating       *uint              `json:"rating" bson:"rating"`
-	Image        *string            `json:"image" bson:"image"`
+	Product_ID    primitive.ObjectID `bson:"_id"`
+	Product_Name  *string            `json:"product_name" bson:"product_name"`
+	Category      *string            `json:"category" bson:"category"`
+	Tax_Class     *string            `json:"tax_class" bson:"tax_class"`
+	Weight_Grams  int                `json:"weight_grams" bson:"weight_grams"`
+	Price         Money              `json:"price" bson:"price"`
+	Display_Price *Money             `json:"display_price,omitempty" bson:"-"`
+	Rating        *uint              `json:"rating" bson:"rating"`
+	Image         *string            `json:"image" bson:"image"`
 }
 
+const (
+	AddressHome = "home"
+	AddressWork = "work"
+)
+
+// Address is an entry in the user's address book. Label is home, work or any
+// name the user picks.
 type Address struct {
-	Address_ID primitive.ObjectID `bson:"_id"`
-	House      *string            `json:"house_name" bson: "house_name"`
-	Street     *string            `json:"street_name" bson: "house_name"`
-	City       *string            `json:"city_name" bson: "city_name"`
-	Pincode    *string            `json:"pin_code" bson: "pin_code"`
+	Address_ID       primitive.ObjectID `json:"_id" bson:"_id"`
+	Label            string             `json:"label" bson:"label"`
+	House            *string            `json:"house_name" bson:"house_name"`
+	Street           *string            `json:"street_name" bson:"street_name"`
+	City             *string            `json:"city_name" bson:"city_name"`
+	Pincode          *string            `json:"pin_code" bson:"pin_code"`
+	Country          *string            `json:"country" bson:"country"`
+	Default_Shipping bool               `json:"default_shipping" bson:"default_shipping"`
+	Default_Billing  bool               `json:"default_billing" bson:"default_billing"`
 }
 
 type Order struct {
-	Order_ID       primitive.ObjectID `bson:"_id"`
-	Order_Cart     []ProductUser      `json:"order_list" bson:"order_list"`
-	Ordered_At     time.Time          `json:"ordered_at" bson:"ordered_at"`
-	Price          int                `json:"total_price" bson:"total_price"`
-	Discount       *int               `json:"discount" bson:"discount"`
-	Payment_Method Payment            `json:"payment_method" bson:"payment_method"`
+	Order_ID         primitive.ObjectID `bson:"_id"`
+	Order_Cart       []ProductUser      `json:"order_list" bson:"order_list"`
+	Ordered_At       time.Time          `json:"ordered_at" bson:"ordered_at"`
+	Price            Money              `json:"total_price" bson:"total_price"`
+	Discount         *Money             `json:"discount" bson:"discount"`
+	Coupon_Code      *string            `json:"coupon_code,omitempty" bson:"coupon_code,omitempty"`
+	Promotions       []AppliedPromotion `json:"promotions" bson:"promotions"`
+	Tax              Money              `json:"tax" bson:"tax"`
+	Tax_Inclusive    bool               `json:"tax_inclusive" bson:"tax_inclusive"`
+	Tax_Lines        []TaxLine          `json:"tax_lines" bson:"tax_lines"`
+	Shipping_Method  string             `json:"shipping_method" bson:"shipping_method"`
+	Shipping         Money              `json:"shipping" bson:"shipping"`
+	Shipping_Address *Address           `json:"shipping_address" bson:"shipping_address"`
+	Billing_Address  *Address           `json:"billing_address" bson:"billing_address"`
+	Free_Shipping    bool               `json:"free_shipping" bson:"free_shipping"`
+	Payment_Method   Payment            `json:"payment_method" bson:"payment_method"`
+	Display_Price    *Money             `json:"display_price,omitempty" bson:"display_price,omitempty"`
+	Exchange_Rate    *ExchangeRate      `json:"exchange_rate,omitempty" bson:"exchange_rate,omitempty"`
+	Returned         []ReturnedQuantity `json:"returned" bson:"returned"`
+	Refunded         *Money             `json:"refunded,omitempty" bson:"refunded,omitempty"`
+	Cancelled_At     *time.Time         `json:"cancelled_at,omitempty" bson:"cancelled_at,omitempty"`
+	Cancel_Reason    string             `json:"cancel_reason,omitempty" bson:"cancel_reason,omitempty"`
+	Version          int64              `json:"-" bson:"version,omitempty"`
 }
 
 type Payment struct {
 	Digital bool
 	COD     bool
 }
+
+// ExchangeRate is how many units of Currency one unit of DefaultCurrency buys,
+// kept as a decimal string so it converts exactly.
+type ExchangeRate struct {
+	Currency   string    `json:"currency" bson:"_id"`
+	Rate       string    `json:"rate" bson:"rate"`
+	Updated_At time.Time `json:"updated_at" bson:"updated_at"`
+}
+
+const (
+	CouponPercentage   = "percentage"
+	CouponFixed        = "fixed"
+	CouponFreeShipping = "free_shipping"
+)
+
+// Coupon is a code a customer can apply to their cart. Percent is in basis
+// points (1000 is 10%) and only used by percentage coupons, Amount only by
+// fixed ones. Empty Product_IDs and Categories mean the whole cart qualifies.
+// Limits of zero are unlimited.
+type Coupon struct {
+	Code           string               `json:"code" bson:"_id"`
+	Type           string               `json:"type" bson:"type"`
+	Percent        int64                `json:"percent" bson:"percent"`
+	Amount         *Money               `json:"amount" bson:"amount"`
+	Min_Cart_Value *Money               `json:"min_cart_value" bson:"min_cart_value"`
+	Per_User_Limit int                  `json:"per_user_limit" bson:"per_user_limit"`
+	Global_Limit   int                  `json:"global_limit" bson:"global_limit"`
+	Used_Count     int                  `json:"used_count" bson:"used_count"`
+	Used_By        map[string]int       `json:"-" bson:"used_by"`
+	Valid_From     *time.Time           `json:"valid_from" bson:"valid_from"`
+	Valid_Until    *time.Time           `json:"valid_until" bson:"valid_until"`
+	Product_IDs    []primitive.ObjectID `json:"product_ids" bson:"product_ids"`
+	Categories     []string             `json:"categories" bson:"categories"`
+	Created_At     time.Time            `json:"created_at" bson:"created_at"`
+}
+
+const (
+	PromotionBuyXGetY   = "buy_x_get_y"
+	PromotionPercentOff = "percent_off"
+	PromotionTiered     = "tiered"
+)
+
+// Promotion is a rule evaluated against every cart. Buy_Quantity and
+// Free_Quantity drive buy_x_get_y, Percent (basis points) and Min_Spend drive
+// percent_off, and Tiers drive tiered. Higher Priority is evaluated first; a
+// promotion that is not Stackable only applies when nothing else has.
+type Promotion struct {
+	Promotion_ID  primitive.ObjectID   `json:"_id" bson:"_id"`
+	Name          string               `json:"name" bson:"name"`
+	Type          string               `json:"type" bson:"type"`
+	Priority      int                  `json:"priority" bson:"priority"`
+	Stackable     bool                 `json:"stackable" bson:"stackable"`
+	Active        bool                 `json:"active" bson:"active"`
+	Valid_From    *time.Time           `json:"valid_from" bson:"valid_from"`
+	Valid_Until   *time.Time           `json:"valid_until" bson:"valid_until"`
+	Product_IDs   []primitive.ObjectID `json:"product_ids" bson:"product_ids"`
+	Categories    []string             `json:"categories" bson:"categories"`
+	Buy_Quantity  int                  `json:"buy_quantity" bson:"buy_quantity"`
+	Free_Quantity int                  `json:"free_quantity" bson:"free_quantity"`
+	Percent       int64                `json:"percent" bson:"percent"`
+	Min_Spend     *Money               `json:"min_spend" bson:"min_spend"`
+	Tiers         []PromotionTier      `json:"tiers" bson:"tiers"`
+	Created_At    time.Time            `json:"created_at" bson:"created_at"`
+}
+
+type PromotionTier struct {
+	Min_Spend Money `json:"min_spend" bson:"min_spend"`
+	Percent   int64 `json:"percent" bson:"percent"`
+}
+
+// AppliedPromotion explains a promotion that took money off a cart or order.
+type AppliedPromotion struct {
+	Promotion_ID primitive.ObjectID `json:"promotion_id" bson:"promotion_id"`
+	Name         string             `json:"name" bson:"name"`
+	Description  string             `json:"description" bson:"description"`
+	Discount     Money              `json:"discount" bson:"discount"`
+}
+
+// TaxRate is the rate (in basis points) charged on products of Tax_Class in a
+// region. A rate with neither Pincode_Prefix nor City applies everywhere, and
+// an empty Tax_Class is used for products without one.
+type TaxRate struct {
+	Rate_ID        primitive.ObjectID `json:"_id" bson:"_id"`
+	Name           string             `json:"name" bson:"name"`
+	Tax_Class      string             `json:"tax_class" bson:"tax_class"`
+	Pincode_Prefix string             `json:"pincode_prefix" bson:"pincode_prefix"`
+	City           string             `json:"city" bson:"city"`
+	Rate           int64              `json:"rate" bson:"rate"`
+}
+
+// TaxLine is the tax charged on one order line. Taxable is the line price
+// after its share of the order discount, excluding tax.
+type TaxLine struct {
+	Product_ID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Tax_Class  string             `json:"tax_class" bson:"tax_class"`
+	Rate_Name  string             `json:"rate_name" bson:"rate_name"`
+	Rate       int64              `json:"rate" bson:"rate"`
+	Taxable    Money              `json:"taxable" bson:"taxable"`
+	Tax        Money              `json:"tax" bson:"tax"`
+}
+
+const (
+	ShippingStandard = "standard"
+	ShippingExpress  = "express"
+	ShippingPickup   = "pickup"
+)
+
+// ShippingRate is one row of a method's rate table: the price for parcels up
+// to Max_Weight_Grams (0 for no upper limit) going to pincodes starting with
+// any of Pincode_Prefixes (none means every pincode).
+type ShippingRate struct {
+	Rate_ID          primitive.ObjectID `json:"_id" bson:"_id"`
+	Method           string             `json:"method" bson:"method"`
+	Zone             string             `json:"zone" bson:"zone"`
+	Pincode_Prefixes []string           `json:"pincode_prefixes" bson:"pincode_prefixes"`
+	Max_Weight_Grams int                `json:"max_weight_grams" bson:"max_weight_grams"`
+	Price            Money              `json:"price" bson:"price"`
+	Delivery_Days    int                `json:"delivery_days" bson:"delivery_days"`
+}
+
+const (
+	ShipmentLabelCreated   = "label_created"
+	ShipmentInTransit      = "in_transit"
+	ShipmentOutForDelivery = "out_for_delivery"
+	ShipmentDelivered      = "delivered"
+	ShipmentException      = "exception"
+)
+
+// Shipment is a parcel sent for an order. Items lists the products of the
+// order it carries; an empty list means the whole order.
+type Shipment struct {
+	Shipment_ID     primitive.ObjectID   `json:"_id" bson:"_id"`
+	Order_ID        primitive.ObjectID   `json:"order_id" bson:"order_id"`
+	User_ID         string               `json:"user_id" bson:"user_id"`
+	Carrier         string               `json:"carrier" bson:"carrier"`
+	Tracking_Number string               `json:"tracking_number" bson:"tracking_number"`
+	Items           []primitive.ObjectID `json:"items" bson:"items"`
+	Status          string               `json:"status" bson:"status"`
+	Events          []ShipmentEvent      `json:"events" bson:"events"`
+	Created_At      time.Time            `json:"created_at" bson:"created_at"`
+	Updated_At      time.Time            `json:"updated_at" bson:"updated_at"`
+}
+
+type ShipmentEvent struct {
+	Status      string    `json:"status" bson:"status"`
+	Location    string    `json:"location" bson:"location"`
+	Description string    `json:"description" bson:"description"`
+	Occurred_At time.Time `json:"occurred_at" bson:"occurred_at"`
+}
+
+// Wishlist is a named list of products kept outside the cart. Public lists can
+// be read by anyone holding the share token.
+type Wishlist struct {
+	Wishlist_ID primitive.ObjectID `json:"_id" bson:"_id"`
+	User_ID     primitive.ObjectID `json:"-" bson:"user_id"`
+	Name        string             `json:"name" bson:"name"`
+	Public      bool               `json:"public" bson:"public"`
+	Share_Token string             `json:"share_token" bson:"share_token"`
+	Items       []ProductUser      `json:"items" bson:"items"`
+	Created_At  time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At  time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// GuestCart holds the cart of a shopper who hasn't signed in. It is found by
+// the id inside a signed cart token and merged into the user's cart on login.
+type GuestCart struct {
+	Cart_ID    primitive.ObjectID `json:"_id" bson:"_id"`
+	Items      []ProductUser      `json:"items" bson:"items"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At time.Time          `json:"updated_at" bson:"updated_at"`
+	Expires_At time.Time          `json:"expires_at" bson:"expires_at"`
+}
+
+const (
+	CartChangePrice       = "price_changed"
+	CartChangeUnavailable = "unavailable"
+)
+
+// CartChange tells the customer a product in their cart no longer matches the
+// catalog. New_Price is empty for products that can't be bought any more.
+type CartChange struct {
+	Product_ID   primitive.ObjectID `json:"product_id"`
+	Product_Name *string            `json:"product_name"`
+	Change       string             `json:"change"`
+	Old_Price    Money              `json:"old_price"`
+	New_Price    *Money             `json:"new_price,omitempty"`
+}
+
+const (
+	ReturnRequested = "requested"
+	ReturnApproved  = "approved"
+	ReturnRejected  = "rejected"
+	ReturnReceived  = "received"
+	ReturnRefunded  = "refunded"
+)
+
+// Return is a customer's request to send back some units of an order.
+type Return struct {
+	Return_ID  primitive.ObjectID  `json:"_id" bson:"_id"`
+	Order_ID   primitive.ObjectID  `json:"order_id" bson:"order_id"`
+	User_ID    string              `json:"user_id" bson:"user_id"`
+	Items      []ReturnItem        `json:"items" bson:"items"`
+	Status     string              `json:"status" bson:"status"`
+	Admin_Note string              `json:"admin_note,omitempty" bson:"admin_note,omitempty"`
+	Refund_ID  *primitive.ObjectID `json:"refund_id,omitempty" bson:"refund_id,omitempty"`
+	Created_At time.Time           `json:"created_at" bson:"created_at"`
+	Updated_At time.Time           `json:"updated_at" bson:"updated_at"`
+}
+
+type ReturnItem struct {
+	Product_ID   primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Product_Name *string            `json:"product_name" bson:"product_name"`
+	Quantity     int                `json:"quantity" bson:"quantity"`
+	Unit_Price   Money              `json:"unit_price" bson:"unit_price"`
+	Reason       string             `json:"reason" bson:"reason"`
+}
+
+// ReturnedQuantity is how many units of a product came back from an order.
+type ReturnedQuantity struct {
+	Product_ID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Quantity   int                `json:"quantity" bson:"quantity"`
+}
+
+// Refund records money paid back for a return.
+type Refund struct {
+	Refund_ID  primitive.ObjectID `json:"_id" bson:"_id"`
+	Return_ID  primitive.ObjectID `json:"return_id" bson:"return_id"`
+	Order_ID   primitive.ObjectID `json:"order_id" bson:"order_id"`
+	User_ID    string             `json:"user_id" bson:"user_id"`
+	Amount     Money              `json:"amount" bson:"amount"`
+	Note       string             `json:"note,omitempty" bson:"note,omitempty"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+}
+
+const (
+	InvoiceKindInvoice    = "invoice"
+	InvoiceKindCreditNote = "credit_note"
+)
+
+// Invoice is the accounting record of an order, or with Kind credit_note of a
+// refund against it. Numbers are sequential per kind and never reused.
+type Invoice struct {
+	Invoice_ID       primitive.ObjectID  `json:"_id" bson:"_id"`
+	Number           string              `json:"number" bson:"number"`
+	Kind             string              `json:"kind" bson:"kind"`
+	Order_ID         primitive.ObjectID  `json:"order_id" bson:"order_id"`
+	User_ID          string              `json:"user_id" bson:"user_id"`
+	Refund_ID        *primitive.ObjectID `json:"refund_id,omitempty" bson:"refund_id"`
+	Invoice_Number   string              `json:"invoice_number,omitempty" bson:"invoice_number,omitempty"`
+	Seller           string              `json:"seller" bson:"seller"`
+	Issued_At        time.Time           `json:"issued_at" bson:"issued_at"`
+	Ordered_At       time.Time           `json:"ordered_at" bson:"ordered_at"`
+	Billing_Address  *Address            `json:"billing_address" bson:"billing_address"`
+	Shipping_Address *Address            `json:"shipping_address" bson:"shipping_address"`
+	Lines            []InvoiceLine       `json:"lines" bson:"lines"`
+	Subtotal         Money               `json:"subtotal" bson:"subtotal"`
+	Discount         Money               `json:"discount" bson:"discount"`
+	Coupon_Code      *string             `json:"coupon_code,omitempty" bson:"coupon_code,omitempty"`
+	Tax              Money               `json:"tax" bson:"tax"`
+	Tax_Inclusive    bool                `json:"tax_inclusive" bson:"tax_inclusive"`
+	Shipping         Money               `json:"shipping" bson:"shipping"`
+	Total            Money               `json:"total" bson:"total"`
+}
+
+type InvoiceLine struct {
+	Product_ID  primitive.ObjectID `json:"product_id" bson:"product_id"`
+	Description string             `json:"description" bson:"description"`
+	Quantity    int                `json:"quantity" bson:"quantity"`
+	Unit_Price  Money              `json:"unit_price" bson:"unit_price"`
+	Tax         Money              `json:"tax" bson:"tax"`
+	Amount      Money              `json:"amount" bson:"amount"`
+}
+
+// Review is a customer's star rating and write-up of a product. Verified
+// purchase reviews come from customers who have ordered the product.
+type Review struct {
+	Review_ID         primitive.ObjectID `json:"_id" bson:"_id"`
+	Product_ID        primitive.ObjectID `json:"product_id" bson:"product_id"`
+	User_ID           string             `json:"user_id" bson:"user_id"`
+	Author            string             `json:"author" bson:"author"`
+	Rating            int                `json:"rating" bson:"rating"`
+	Title             string             `json:"title" bson:"title"`
+	Body              string             `json:"body" bson:"body"`
+	Verified_Purchase bool               `json:"verified_purchase" bson:"verified_purchase"`
+	Helpful_Count     int                `json:"helpful_count" bson:"helpful_count"`
+	Helpful_Voters    []string           `json:"-" bson:"helpful_voters"`
+	Status            string             `json:"status" bson:"status"`
+	Flags             []ModerationFlag   `json:"flags,omitempty" bson:"flags"`
+	Fingerprint       string             `json:"-" bson:"fingerprint"`
+	Created_At        time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At        time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// RatingSummary is the average of a product's reviews and how many gave each
+// number of stars; Distribution[0] counts one star reviews.
+type RatingSummary struct {
+	Average      float64 `json:"average" bson:"average"`
+	Count        int     `json:"count" bson:"count"`
+	Distribution [5]int  `json:"distribution" bson:"distribution"`
+}
+
+// Question is a shopper's question about a product. Answer_Count counts its
+// approved answers; Answers is filled in when questions are listed.
+type Question struct {
+	Question_ID  primitive.ObjectID `json:"_id" bson:"_id"`
+	Product_ID   primitive.ObjectID `json:"product_id" bson:"product_id"`
+	User_ID      string             `json:"user_id" bson:"user_id"`
+	Author       string             `json:"author" bson:"author"`
+	Text         string             `json:"text" bson:"text"`
+	Status       string             `json:"status" bson:"status"`
+	Flags        []ModerationFlag   `json:"flags,omitempty" bson:"flags"`
+	Fingerprint  string             `json:"-" bson:"fingerprint"`
+	Answer_Count int                `json:"answer_count" bson:"answer_count"`
+	Answers      []Answer           `json:"answers,omitempty" bson:"-"`
+	Created_At   time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At   time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Answer is a reply to a question, from staff or from a customer who bought
+// the product.
+type Answer struct {
+	Answer_ID         primitive.ObjectID `json:"_id" bson:"_id"`
+	Question_ID       primitive.ObjectID `json:"question_id" bson:"question_id"`
+	Product_ID        primitive.ObjectID `json:"product_id" bson:"product_id"`
+	User_ID           string             `json:"user_id,omitempty" bson:"user_id"`
+	Author            string             `json:"author" bson:"author"`
+	Text              string             `json:"text" bson:"text"`
+	Staff             bool               `json:"staff" bson:"staff"`
+	Verified_Purchase bool               `json:"verified_purchase" bson:"verified_purchase"`
+	Status            string             `json:"status" bson:"status"`
+	Flags             []ModerationFlag   `json:"flags,omitempty" bson:"flags"`
+	Fingerprint       string             `json:"-" bson:"fingerprint"`
+	Upvotes           int                `json:"upvotes" bson:"upvotes"`
+	Upvoters          []string           `json:"-" bson:"upvoters"`
+	Created_At        time.Time          `json:"created_at" bson:"created_at"`
+	Updated_At        time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+// Customer text is only shown once it has been approved. Approved text can be
+// hidden again later.
+const (
+	ModerationPending  = "pending"
+	ModerationApproved = "approved"
+	ModerationRejected = "rejected"
+	ModerationHidden   = "hidden"
+)
+
+// ModerationFlag is a content filter's reason to hold text for a moderator.
+type ModerationFlag struct {
+	Filter string `json:"filter" bson:"filter"`
+	Reason string `json:"reason" bson:"reason"`
+}
+
+// ModerationAction is one entry in the moderation audit trail.
+type ModerationAction struct {
+	Action_ID  primitive.ObjectID `json:"_id" bson:"_id"`
+	Kind       string             `json:"kind" bson:"kind"`
+	Target_ID  primitive.ObjectID `json:"target_id" bson:"target_id"`
+	Product_ID primitive.ObjectID `json:"product_id" bson:"product_id"`
+	From       string             `json:"from" bson:"from"`
+	To         string             `json:"to" bson:"to"`
+	Moderator  string             `json:"moderator" bson:"moderator"`
+	Note       string             `json:"note,omitempty" bson:"note"`
+	Flags      []ModerationFlag   `json:"flags,omitempty" bson:"flags"`
+	Created_At time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Outbox messages wait as pending until the dispatcher claims them; they end
+// up dispatched, or failed once every attempt is used up.
+const (
+	OutboxPending    = "pending"
+	OutboxProcessing = "processing"
+	OutboxDispatched = "dispatched"
+	OutboxFailed     = "failed"
+)
+
+// OutboxMessage is a domain event saved with the change that caused it, so
+// its side effects happen even if the process dies straight after. Handled
+// lists the handlers that have already succeeded, which retries skip.
+type OutboxMessage struct {
+	Message_ID      primitive.ObjectID `json:"_id" bson:"_id"`
+	Type            string             `json:"type" bson:"type"`
+	Payload         bson.Raw           `json:"-" bson:"payload"`
+	Status          string             `json:"status" bson:"status"`
+	Attempts        int                `json:"attempts" bson:"attempts"`
+	Handled         []string           `json:"handled" bson:"handled"`
+	Last_Error      string             `json:"last_error,omitempty" bson:"last_error"`
+	Next_Attempt_At time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	Locked_Until    *time.Time         `json:"locked_until,omitempty" bson:"locked_until"`
+	Created_At      time.Time          `json:"created_at" bson:"created_at"`
+	Dispatched_At   *time.Time         `json:"dispatched_at,omitempty" bson:"dispatched_at"`
+}
+
+// Webhook is an endpoint outside the shop, such as an ERP, that is sent the
+// events it subscribed to. Every delivery is signed with its Secret.
+type Webhook struct {
+	Webhook_ID  primitive.ObjectID `json:"_id" bson:"_id"`
+	URL         string             `json:"url" bson:"url"`
+	Events      []string           `json:"events" bson:"events"`
+	Description string             `json:"description" bson:"description"`
+	Active      bool               `json:"active" bson:"active"`
+	Secret      string             `json:"-" bson:"secret"`
+	Created_At  time.Time          `json:"created_at" bson:"created_at"`
+}
+
+// Webhook deliveries wait as pending until they are sent, and end up
+// delivered, or failed once every attempt is used up.
+const (
+	WebhookPending   = "pending"
+	WebhookSending   = "sending"
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookAttempt is one try at sending a delivery. Status_Code is 0 when no
+// response came back.
+type WebhookAttempt struct {
+	At          time.Time `json:"at" bson:"at"`
+	Status_Code int       `json:"status_code" bson:"status_code"`
+	Error       string    `json:"error,omitempty" bson:"error"`
+	Response    string    `json:"response,omitempty" bson:"response"`
+	Duration_MS int64     `json:"duration_ms" bson:"duration_ms"`
+}
+
+// WebhookDelivery is one event sent to one webhook. Payload is the exact
+// body, so every attempt and redelivery carries the same bytes. Attempts
+// counts the tries since it was last queued; History keeps all of them.
+type WebhookDelivery struct {
+	Delivery_ID     primitive.ObjectID `json:"_id" bson:"_id"`
+	Webhook_ID      primitive.ObjectID `json:"webhook_id" bson:"webhook_id"`
+	Message_ID      primitive.ObjectID `json:"message_id" bson:"message_id"`
+	Event_Type      string             `json:"event_type" bson:"event_type"`
+	Payload         string             `json:"payload" bson:"payload"`
+	Status          string             `json:"status" bson:"status"`
+	Attempts        int                `json:"attempts" bson:"attempts"`
+	History         []WebhookAttempt   `json:"history" bson:"history"`
+	Next_Attempt_At time.Time          `json:"next_attempt_at" bson:"next_attempt_at"`
+	Locked_Until    *time.Time         `json:"locked_until,omitempty" bson:"locked_until"`
+	Created_At      time.Time          `json:"created_at" bson:"created_at"`
+	Delivered_At    *time.Time         `json:"delivered_at,omitempty" bson:"delivered_at"`
+}
+
+// LoginThrottle counts the recent failed sign-ins under one key, an account's
+// email or an IP address.
+type LoginThrottle struct {
+	Key          string     `json:"key" bson:"_id"`
+	Failures     int        `json:"failures" bson:"failures"`
+	Last_Failure time.Time  `json:"last_failure" bson:"last_failure"`
+	Locked_Until *time.Time `json:"locked_until,omitempty" bson:"locked_until"`
+}
+
+// Outcomes of a sign-in attempt.
+const (
+	LoginSucceeded   = "succeeded"
+	LoginBadPassword = "bad_password"
+	LoginUnknownUser = "unknown_user"
+	LoginRefused     = "refused"
+)
+
+// LoginAttempt records one sign-in for the audit trail.
+type LoginAttempt struct {
+	Attempt_ID primitive.ObjectID `json:"_id" bson:"_id"`
+	Email      string             `json:"email" bson:"email"`
+	User_ID    string             `json:"user_id,omitempty" bson:"user_id"`
+	IP         string             `json:"ip" bson:"ip"`
+	User_Agent string             `json:"user_agent" bson:"user_agent"`
+	Outcome    string             `json:"outcome" bson:"outcome"`
+	At         time.Time          `json:"at" bson:"at"`
+}
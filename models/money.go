@@ -0,0 +1,287 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+// DefaultCurrency is the store currency. Prices stored before Money existed
+// were bare integers in this currency's major units.
+const DefaultCurrency = "INR"
+
+var (
+	ErrCurrencyMismatch = errors.New("cannot combine amounts in different currencies")
+	ErrMoneyOverflow    = errors.New("amount is out of range")
+)
+
+// minorUnits is the number of decimal places of each ISO 4217 currency we
+// know about. Anything not listed uses two.
+var minorUnits = map[string]int{
+	"BHD": 3,
+	"CLP": 0,
+	"EUR": 2,
+	"GBP": 2,
+	"INR": 2,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"OMR": 3,
+	"USD": 2,
+}
+
+func MinorUnits(currency string) int {
+	if n, ok := minorUnits[currency]; ok {
+		return n
+	}
+	return 2
+}
+
+// Money is an amount in the minor units of its currency (paise, cents), so
+// 499.99 INR is Money{Amount: 49999, Currency: "INR"}.
+type Money struct {
+	Amount   int64  `json:"amount" bson:"amount"`
+	Currency string `json:"currency" bson:"currency"`
+}
+
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: strings.ToUpper(currency)}
+}
+
+func ZeroMoney(currency string) Money {
+	return NewMoney(0, currency)
+}
+
+// FromMajor converts a whole number of major units (rupees, dollars) to Money.
+func FromMajor(major int64, currency string) (Money, error) {
+	m := NewMoney(major, currency)
+	for i := 0; i < MinorUnits(m.Currency); i++ {
+		if m.Amount > math.MaxInt64/10 || m.Amount < math.MinInt64/10 {
+			return Money{}, ErrMoneyOverflow
+		}
+		m.Amount *= 10
+	}
+	return m, nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// sameCurrency treats an empty currency on a zero amount as compatible with
+// anything, so the zero value of Money can be used as an accumulator.
+func (m Money) sameCurrency(o Money) (string, error) {
+	switch {
+	case m.Currency == o.Currency:
+		return m.Currency, nil
+	case m.Currency == "" && m.Amount == 0:
+		return o.Currency, nil
+	case o.Currency == "" && o.Amount == 0:
+		return m.Currency, nil
+	}
+	return "", ErrCurrencyMismatch
+}
+
+func (m Money) Add(o Money) (Money, error) {
+	currency, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	if (o.Amount > 0 && m.Amount > math.MaxInt64-o.Amount) || (o.Amount < 0 && m.Amount < math.MinInt64-o.Amount) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: m.Amount + o.Amount, Currency: currency}, nil
+}
+
+func (m Money) Sub(o Money) (Money, error) {
+	if o.Amount == math.MinInt64 {
+		return Money{}, ErrMoneyOverflow
+	}
+	return m.Add(Money{Amount: -o.Amount, Currency: o.Currency})
+}
+
+func (m Money) Mul(n int64) (Money, error) {
+	if m.Amount == 0 || n == 0 {
+		return Money{Amount: 0, Currency: m.Currency}, nil
+	}
+	product := m.Amount * n
+	if product/n != m.Amount || (m.Amount == -1 && n == math.MinInt64) || (n == -1 && m.Amount == math.MinInt64) {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// MulRat multiplies by an exact ratio and rounds the result to the nearest
+// minor unit, with halves rounded away from zero (commercial rounding).
+func (m Money) MulRat(r *big.Rat) (Money, error) {
+	num := new(big.Int).Mul(big.NewInt(m.Amount), r.Num())
+	den := r.Denom()
+
+	quo, rem := new(big.Int).QuoRem(num, den, new(big.Int))
+	twice := new(big.Int).Mul(new(big.Int).Abs(rem), big.NewInt(2))
+	if twice.Cmp(den) >= 0 {
+		if num.Sign() < 0 {
+			quo.Sub(quo, big.NewInt(1))
+		} else {
+			quo.Add(quo, big.NewInt(1))
+		}
+	}
+
+	if !quo.IsInt64() {
+		return Money{}, ErrMoneyOverflow
+	}
+	return Money{Amount: quo.Int64(), Currency: m.Currency}, nil
+}
+
+// Percent returns the given share of m, expressed in basis points
+// (1250 is 12.5%), rounded the same way as MulRat.
+func (m Money) Percent(basisPoints int64) (Money, error) {
+	return m.MulRat(big.NewRat(basisPoints, 10000))
+}
+
+// Min returns the smaller of two amounts in the same currency.
+func (m Money) Min(o Money) (Money, error) {
+	currency, err := m.sameCurrency(o)
+	if err != nil {
+		return Money{}, err
+	}
+	if o.Amount < m.Amount {
+		return Money{Amount: o.Amount, Currency: currency}, nil
+	}
+	return Money{Amount: m.Amount, Currency: currency}, nil
+}
+
+// SumMoney adds up amounts that must all share the given currency.
+func SumMoney(currency string, amounts ...Money) (Money, error) {
+	total := ZeroMoney(currency)
+	for _, a := range amounts {
+		var err error
+		if total, err = total.Add(a); err != nil {
+			return Money{}, err
+		}
+	}
+	return total, nil
+}
+
+// Decimal formats the amount in major units, e.g. "499.99".
+func (m Money) Decimal() string {
+	units := MinorUnits(m.Currency)
+	sign := ""
+	amount := new(big.Int).SetInt64(m.Amount)
+	if amount.Sign() < 0 {
+		sign = "-"
+		amount.Neg(amount)
+	}
+	digits := amount.String()
+	if units == 0 {
+		return sign + digits
+	}
+	if len(digits) <= units {
+		digits = strings.Repeat("0", units-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-units] + "." + digits[len(digits)-units:]
+}
+
+func (m Money) String() string {
+	return fmt.Sprintf("%s %s", m.Currency, m.Decimal())
+}
+
+// MarshalJSON adds a preformatted decimal next to the raw minor units so
+// clients don't need to know each currency's exponent.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount    int64  `json:"amount"`
+		Currency  string `json:"currency"`
+		Formatted string `json:"formatted"`
+	}{m.Amount, m.Currency, m.Decimal()})
+}
+
+// UnmarshalJSON reads {"amount": minor units, "currency": ...}, where a
+// missing currency means DefaultCurrency, and also a bare number of major
+// units of DefaultCurrency, as prices were sent before Money existed.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "null" {
+		return nil
+	}
+	if trimmed != "" && (trimmed[0] == '-' || (trimmed[0] >= '0' && trimmed[0] <= '9')) {
+		var n json.Number
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		major, ok := new(big.Rat).SetString(n.String())
+		if !ok {
+			return fmt.Errorf("invalid amount %s", n)
+		}
+		unit, err := FromMajor(1, DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		legacy, err := unit.MulRat(major)
+		if err != nil {
+			return err
+		}
+		*m = legacy
+		return nil
+	}
+
+	type plain Money
+	var p plain
+	if err := json.Unmarshal(data, &p); err != nil {
+		return err
+	}
+	if p.Currency == "" {
+		p.Currency = DefaultCurrency
+	}
+	*m = NewMoney(p.Amount, p.Currency)
+	return nil
+}
+
+// UnmarshalBSONValue reads both Money documents and the bare integer prices
+// written before Money existed, which are major units of DefaultCurrency.
+func (m *Money) UnmarshalBSONValue(t bsontype.Type, data []byte) error {
+	raw := bson.RawValue{Type: t, Value: data}
+	switch t {
+	case bsontype.Null, bsontype.Undefined:
+		*m = Money{}
+		return nil
+	case bsontype.Int32:
+		legacy, err := FromMajor(int64(raw.Int32()), DefaultCurrency)
+		*m = legacy
+		return err
+	case bsontype.Int64:
+		legacy, err := FromMajor(raw.Int64(), DefaultCurrency)
+		*m = legacy
+		return err
+	case bsontype.Double:
+		major := new(big.Rat).SetFloat64(raw.Double())
+		if major == nil {
+			return ErrMoneyOverflow
+		}
+		unit, err := FromMajor(1, DefaultCurrency)
+		if err != nil {
+			return err
+		}
+		legacy, err := unit.MulRat(major)
+		*m = legacy
+		return err
+	}
+
+	type plain Money
+	var p plain
+	if err := raw.Unmarshal(&p); err != nil {
+		return err
+	}
+	*m = Money(p)
+	return nil
+}
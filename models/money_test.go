@@ -0,0 +1,136 @@
+package models
+
+import (
+	"encoding/json"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestMoneyAdd(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Money
+		want Money
+		err  error
+	}{
+		{"sums", NewMoney(150, "INR"), NewMoney(250, "INR"), NewMoney(400, "INR"), nil},
+		{"negative", NewMoney(150, "INR"), NewMoney(-250, "INR"), NewMoney(-100, "INR"), nil},
+		{"zero value takes the other currency", Money{}, NewMoney(99, "USD"), NewMoney(99, "USD"), nil},
+		{"currency mismatch", NewMoney(1, "INR"), NewMoney(1, "USD"), Money{}, ErrCurrencyMismatch},
+		{"max", NewMoney(math.MaxInt64-1, "INR"), NewMoney(1, "INR"), NewMoney(math.MaxInt64, "INR"), nil},
+		{"overflow", NewMoney(math.MaxInt64, "INR"), NewMoney(1, "INR"), Money{}, ErrMoneyOverflow},
+		{"underflow", NewMoney(math.MinInt64, "INR"), NewMoney(-1, "INR"), Money{}, ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Add(tt.b)
+			if err != tt.err || got != tt.want {
+				t.Errorf("Add() = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestMoneySub(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b Money
+		want Money
+		err  error
+	}{
+		{"differs", NewMoney(400, "INR"), NewMoney(150, "INR"), NewMoney(250, "INR"), nil},
+		{"below zero", NewMoney(150, "INR"), NewMoney(400, "INR"), NewMoney(-250, "INR"), nil},
+		{"min", NewMoney(math.MinInt64+1, "INR"), NewMoney(1, "INR"), NewMoney(math.MinInt64, "INR"), nil},
+		{"underflow", NewMoney(math.MinInt64, "INR"), NewMoney(1, "INR"), Money{}, ErrMoneyOverflow},
+		{"negating min overflows", NewMoney(0, "INR"), NewMoney(math.MinInt64, "INR"), Money{}, ErrMoneyOverflow},
+		{"overflow", NewMoney(math.MaxInt64, "INR"), NewMoney(-1, "INR"), Money{}, ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.a.Sub(tt.b)
+			if err != tt.err || got != tt.want {
+				t.Errorf("Sub() = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestMoneyMul(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Money
+		n    int64
+		want Money
+		err  error
+	}{
+		{"multiplies", NewMoney(4999, "INR"), 3, NewMoney(14997, "INR"), nil},
+		{"by zero", NewMoney(math.MaxInt64, "INR"), 0, NewMoney(0, "INR"), nil},
+		{"negative", NewMoney(250, "INR"), -2, NewMoney(-500, "INR"), nil},
+		{"overflow", NewMoney(math.MaxInt64/2+1, "INR"), 2, Money{}, ErrMoneyOverflow},
+		{"min by minus one", NewMoney(math.MinInt64, "INR"), -1, Money{}, ErrMoneyOverflow},
+		{"minus one by min", NewMoney(-1, "INR"), math.MinInt64, Money{}, ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.Mul(tt.n)
+			if err != tt.err || got != tt.want {
+				t.Errorf("Mul() = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestMoneyMulRat(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Money
+		r    *big.Rat
+		want Money
+		err  error
+	}{
+		{"exact", NewMoney(1000, "INR"), big.NewRat(1, 4), NewMoney(250, "INR"), nil},
+		{"rounds down below half", NewMoney(1001, "INR"), big.NewRat(1, 4), NewMoney(250, "INR"), nil},
+		{"rounds half up", NewMoney(1002, "INR"), big.NewRat(1, 4), NewMoney(251, "INR"), nil},
+		{"rounds half away from zero", NewMoney(-1002, "INR"), big.NewRat(1, 4), NewMoney(-251, "INR"), nil},
+		{"rounds negative below half towards zero", NewMoney(-1001, "INR"), big.NewRat(1, 4), NewMoney(-250, "INR"), nil},
+		{"thirds", NewMoney(100, "INR"), big.NewRat(2, 3), NewMoney(67, "INR"), nil},
+		{"large intermediate", NewMoney(math.MaxInt64, "INR"), big.NewRat(1, 2), NewMoney(math.MaxInt64/2+1, "INR"), nil},
+		{"overflow", NewMoney(math.MaxInt64, "INR"), big.NewRat(3, 2), Money{}, ErrMoneyOverflow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.MulRat(tt.r)
+			if err != tt.err || got != tt.want {
+				t.Errorf("MulRat() = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestMoneyUnmarshalJSON(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want Money
+	}{
+		{"document", `{"amount": 49999, "currency": "usd"}`, NewMoney(49999, "USD")},
+		{"missing currency", `{"amount": 49999}`, NewMoney(49999, DefaultCurrency)},
+		{"empty currency", `{"amount": 49999, "currency": ""}`, NewMoney(49999, DefaultCurrency)},
+		{"legacy integer", `499`, NewMoney(49900, DefaultCurrency)},
+		{"legacy decimal", `499.995`, NewMoney(50000, DefaultCurrency)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got Money
+			if err := json.Unmarshal([]byte(tt.data), &got); err != nil || got != tt.want {
+				t.Errorf("Unmarshal(%s) = %v, %v, want %v", tt.data, got, err, tt.want)
+			}
+		})
+	}
+
+	var bad Money
+	if err := json.Unmarshal([]byte(`"499"`), &bad); err == nil {
+		t.Errorf("Unmarshal of a string = %v, want an error", bad)
+	}
+}
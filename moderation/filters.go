@@ -0,0 +1,104 @@
+package moderation
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/mreym/shopping/models"
+)
+
+// DefaultWords is a short built-in profanity list, used when no word list
+// files are configured.
+var DefaultWords = []string{"fuck", "fucking", "shit", "bitch", "asshole", "bastard", "cunt", "dickhead", "motherfucker", "wanker"}
+
+// WordList flags text containing any of its words. Words match whole and
+// regardless of case.
+type WordList struct {
+	Name  string
+	words map[string]bool
+}
+
+func NewWordList(name string, words []string) WordList {
+	list := WordList{Name: name, words: make(map[string]bool)}
+	for _, w := range words {
+		if w = normalize(w); w != "" {
+			list.words[w] = true
+		}
+	}
+	return list
+}
+
+// LoadWordList reads a word list file with one word per line. Blank lines
+// and lines starting with # are skipped.
+func LoadWordList(name, path string) (WordList, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return WordList{}, err
+	}
+	defer file.Close()
+
+	var words []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			words = append(words, line)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return WordList{}, err
+	}
+	return NewWordList(name, words), nil
+}
+
+func (l WordList) Check(ctx context.Context, content Content) ([]models.ModerationFlag, error) {
+	var flags []models.ModerationFlag
+	seen := make(map[string]bool)
+	for _, w := range strings.Fields(normalize(content.Text)) {
+		if l.words[w] && !seen[w] {
+			seen[w] = true
+			flags = append(flags, models.ModerationFlag{Filter: l.Name, Reason: "contains \"" + w + "\""})
+		}
+	}
+	return flags, nil
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(?:https?://|www\.)\S+|\b[a-z0-9][a-z0-9-]*\.(?:com|net|org|info|biz|io|co|ru|xyz|top|shop|ly)\b(?:/\S*)?`)
+
+// Links flags text with web addresses in it, which in reviews are nearly
+// always spam.
+type Links struct{}
+
+func (Links) Check(ctx context.Context, content Content) ([]models.ModerationFlag, error) {
+	var flags []models.ModerationFlag
+	for _, link := range linkPattern.FindAllString(content.Text, 3) {
+		flags = append(flags, models.ModerationFlag{Filter: "links", Reason: "links to " + link})
+	}
+	return flags, nil
+}
+
+// MinDuplicateLength is how long text must be, in normalized characters,
+// before it is checked for duplicates; short praise like "great product" is
+// expected to repeat.
+const MinDuplicateLength = 40
+
+// Duplicate flags text that has already been posted. Exists reports whether
+// other content with the fingerprint is stored; it must not count the
+// content itself.
+type Duplicate struct {
+	Exists func(ctx context.Context, content Content, fingerprint string) (bool, error)
+}
+
+func (d Duplicate) Check(ctx context.Context, content Content) ([]models.ModerationFlag, error) {
+	if len([]rune(normalize(content.Text))) < MinDuplicateLength {
+		return nil, nil
+	}
+	found, err := d.Exists(ctx, content, Fingerprint(content.Text))
+	if err != nil || !found {
+		return nil, err
+	}
+	return []models.ModerationFlag{{Filter: "duplicate", Reason: "the same text has been posted before"}}, nil
+}
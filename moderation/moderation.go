@@ -0,0 +1,92 @@
+package moderation
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+// Kinds of customer text that go through moderation.
+const (
+	KindReview   = "review"
+	KindQuestion = "question"
+	KindAnswer   = "answer"
+)
+
+// Content is a piece of customer text to check. ID is empty for text that
+// hasn't been saved yet.
+type Content struct {
+	Kind   string
+	ID     primitive.ObjectID
+	Author string
+	Text   string
+}
+
+// Filter looks for reasons to hold content back for a moderator.
+type Filter interface {
+	Check(ctx context.Context, content Content) ([]models.ModerationFlag, error)
+}
+
+// Pipeline runs every filter and collects all of their flags, so moderators
+// see each reason text was held.
+type Pipeline []Filter
+
+func (p Pipeline) Check(ctx context.Context, content Content) ([]models.ModerationFlag, error) {
+	flags := make([]models.ModerationFlag, 0)
+	for _, f := range p {
+		found, err := f.Check(ctx, content)
+		if err != nil {
+			return nil, err
+		}
+		flags = append(flags, found...)
+	}
+	return flags, nil
+}
+
+// Status is where new or edited content starts: flagged content always
+// waits for a moderator, clean content too unless autoApprove is set.
+func Status(flags []models.ModerationFlag, autoApprove bool) string {
+	if len(flags) == 0 && autoApprove {
+		return models.ModerationApproved
+	}
+	return models.ModerationPending
+}
+
+var transitions = map[string][]string{
+	models.ModerationPending:  {models.ModerationApproved, models.ModerationRejected},
+	models.ModerationApproved: {models.ModerationHidden},
+	models.ModerationHidden:   {models.ModerationApproved},
+	models.ModerationRejected: {models.ModerationApproved},
+}
+
+// CanMove reports whether a moderator may move content from one status to
+// another.
+func CanMove(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// normalize lower-cases text and keeps only its words, so trivial edits in
+// case, spacing or punctuation don't change it.
+func normalize(text string) string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	return strings.Join(words, " ")
+}
+
+// Fingerprint identifies text for duplicate detection.
+func Fingerprint(text string) string {
+	sum := sha256.Sum256([]byte(normalize(text)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,133 @@
+package notify
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+// Template names.
+const (
+	EmailWelcome        = "welcome"
+	EmailOrderPlaced    = "order_placed"
+	EmailShipmentUpdate = "shipment_update"
+	EmailOrderCancelled = "order_cancelled"
+	EmailVerify         = "verify_email"
+	EmailPasswordReset  = "password_reset"
+)
+
+// Welcome is the data for the welcome email sent on signup.
+type Welcome struct {
+	Shop string
+	Name string
+}
+
+type OrderItem struct {
+	Name     string
+	Quantity int
+	Amount   string
+}
+
+// OrderPlaced is the data for the order confirmation. Amounts are already
+// formatted; Discount is empty when there was none.
+type OrderPlaced struct {
+	Shop       string
+	Name       string
+	Order_ID   string
+	Ordered_At time.Time
+	Items      []OrderItem
+	Discount   string
+	Shipping   string
+	Tax        string
+	Total      string
+	Ship_To    []string
+}
+
+// ShipmentUpdate is the data for the email sent as a shipment moves.
+type ShipmentUpdate struct {
+	Shop            string
+	Name            string
+	Order_ID        string
+	Carrier         string
+	Tracking_Number string
+	Status          string
+	Location        string
+}
+
+// OrderCancelled is the data for the email confirming a cancellation.
+type OrderCancelled struct {
+	Shop     string
+	Name     string
+	Order_ID string
+	Reason   string
+}
+
+// VerifyEmail is the data for the email with the verification link. Hours
+// is how long the link works.
+type VerifyEmail struct {
+	Shop  string
+	Name  string
+	Link  string
+	Hours int
+}
+
+// PasswordReset is the data for the email with the password reset link.
+// Minutes is how long the link works.
+type PasswordReset struct {
+	Shop    string
+	Name    string
+	Link    string
+	Minutes int
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// NewOrderPlaced describes an order for its confirmation email, with one
+// line per product rather than per unit.
+func NewOrderPlaced(shop, name string, order models.Order) OrderPlaced {
+	email := OrderPlaced{
+		Shop:       shop,
+		Name:       name,
+		Order_ID:   order.Order_ID.Hex(),
+		Ordered_At: order.Ordered_At,
+		Shipping:   order.Shipping.String(),
+		Tax:        order.Tax.String(),
+		Total:      order.Price.String(),
+	}
+	if order.Discount != nil && !order.Discount.IsZero() {
+		email.Discount = order.Discount.String()
+	}
+
+	amounts := make([]models.Money, 0)
+	index := make(map[primitive.ObjectID]int)
+	for _, item := range order.Order_Cart {
+		if i, seen := index[item.Product_ID]; seen {
+			email.Items[i].Quantity++
+			if sum, err := amounts[i].Add(item.Price); err == nil {
+				amounts[i] = sum
+			}
+			email.Items[i].Amount = amounts[i].String()
+			continue
+		}
+		index[item.Product_ID] = len(email.Items)
+		amounts = append(amounts, item.Price)
+		email.Items = append(email.Items, OrderItem{Name: value(item.Product_Name), Quantity: 1, Amount: item.Price.String()})
+	}
+
+	if address := order.Shipping_Address; address != nil {
+		for _, line := range []string{value(address.House), value(address.Street), strings.TrimSpace(value(address.City) + " " + value(address.Pincode)), value(address.Country)} {
+			if line != "" {
+				email.Ship_To = append(email.Ship_To, line)
+			}
+		}
+	}
+	return email
+}
@@ -0,0 +1,105 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"mime"
+	"mime/quotedprintable"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Message is an HTML email to one recipient.
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+}
+
+// Notifier delivers messages to customers.
+type Notifier interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// encode writes the message out in RFC 5322 form, ready for SMTP or an .eml
+// file.
+func encode(from string, msg Message, now time.Time) ([]byte, error) {
+	if _, err := mail.ParseAddress(msg.To); err != nil {
+		return nil, fmt.Errorf("notify: bad recipient %q: %w", msg.To, err)
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	domain := "localhost"
+	if at := strings.LastIndex(from, "@"); at >= 0 {
+		domain = strings.Trim(from[at+1:], "> ")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%s@%s>\r\n", hex.EncodeToString(id), domain)
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+	qp := quotedprintable.NewWriter(&b)
+	if _, err := qp.Write([]byte(msg.HTML)); err != nil {
+		return nil, err
+	}
+	if err := qp.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// FileNotifier is the local stand-in for a mail server: it writes each
+// message as an .eml file in Dir that any mail client can open.
+type FileNotifier struct {
+	Dir  string
+	From string
+}
+
+func (f FileNotifier) Send(ctx context.Context, msg Message) error {
+	now := time.Now()
+	raw, err := encode(f.From, msg, now)
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(f.Dir, 0o755); err != nil {
+		return err
+	}
+	to, err := parseAddress(msg.To)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%s.eml", now.Format("20060102T150405.000000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(to))
+	return os.WriteFile(filepath.Join(f.Dir, name), raw, 0o644)
+}
+
+// LogNotifier only logs who would have been sent what. It is used when no
+// mail server or directory is configured.
+type LogNotifier struct{}
+
+func (LogNotifier) Send(ctx context.Context, msg Message) error {
+	log.Printf("notify: mail to %s: %s", msg.To, msg.Subject)
+	return nil
+}
+
+// parseAddress returns the bare address of "Name <addr>" or "addr".
+func parseAddress(s string) (string, error) {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return "", err
+	}
+	return addr.Address, nil
+}
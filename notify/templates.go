@@ -0,0 +1,106 @@
+package notify
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html"
+	"html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultLocale is used for customers whose language has no templates.
+const DefaultLocale = "en"
+
+//go:embed templates
+var files embed.FS
+
+// Templates holds every email in every language. Each template file defines
+// a "subject" and a "body", and the body is wrapped in layout.html.
+type Templates struct {
+	locales map[string]map[string]*template.Template
+}
+
+var funcs = template.FuncMap{
+	"date": func(t time.Time) string { return t.Format("2 Jan 2006") },
+}
+
+// LoadTemplates parses the templates built into the binary, one directory
+// per locale.
+func LoadTemplates() (*Templates, error) {
+	t := &Templates{locales: make(map[string]map[string]*template.Template)}
+	dirs, err := fs.ReadDir(files, "templates")
+	if err != nil {
+		return nil, err
+	}
+	for _, dir := range dirs {
+		if !dir.IsDir() {
+			continue
+		}
+		locale := dir.Name()
+		names, err := fs.Glob(files, path.Join("templates", locale, "*.html"))
+		if err != nil {
+			return nil, err
+		}
+		t.locales[locale] = make(map[string]*template.Template)
+		for _, name := range names {
+			tmpl, err := template.New("layout.html").Funcs(funcs).ParseFS(files, "templates/layout.html", name)
+			if err != nil {
+				return nil, err
+			}
+			t.locales[locale][strings.TrimSuffix(path.Base(name), ".html")] = tmpl
+		}
+	}
+	if _, ok := t.locales[DefaultLocale]; !ok {
+		return nil, fmt.Errorf("notify: no templates for the default locale %q", DefaultLocale)
+	}
+	return t, nil
+}
+
+// Locales lists the languages there are templates for.
+func (t *Templates) Locales() []string {
+	locales := make([]string, 0, len(t.locales))
+	for locale := range t.locales {
+		locales = append(locales, locale)
+	}
+	sort.Strings(locales)
+	return locales
+}
+
+// Match picks the best supported locale from an Accept-Language header,
+// ignoring quality weights beyond their order.
+func (t *Templates) Match(acceptLanguage string) string {
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		tag := strings.ToLower(strings.TrimSpace(strings.SplitN(part, ";", 2)[0]))
+		for _, candidate := range []string{tag, strings.SplitN(tag, "-", 2)[0]} {
+			if _, ok := t.locales[candidate]; ok {
+				return candidate
+			}
+		}
+	}
+	return DefaultLocale
+}
+
+// Render fills in the named email in the locale, falling back to the
+// default locale when it has no translation.
+func (t *Templates) Render(name, locale string, data interface{}) (Message, error) {
+	tmpl, ok := t.locales[locale][name]
+	if !ok {
+		if tmpl, ok = t.locales[DefaultLocale][name]; !ok {
+			return Message{}, fmt.Errorf("notify: no template %q", name)
+		}
+	}
+	var subject, body bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := tmpl.Execute(&body, data); err != nil {
+		return Message{}, err
+	}
+	// the subject is plain text, so undo html/template's escaping
+	return Message{Subject: strings.TrimSpace(html.UnescapeString(subject.String())), HTML: body.String()}, nil
+}
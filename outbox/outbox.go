@@ -0,0 +1,145 @@
+package outbox
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"github.com/mreym/shopping/database"
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+)
+
+// HandlerFunc reacts to one event. It may run more than once for the same
+// event if the process dies part way, so it should be safe to repeat.
+type HandlerFunc func(ctx context.Context, event events.Event) error
+
+type messageKey struct{}
+
+// Message returns the outbox message a handler is running for, for handlers
+// that need its id or time.
+func Message(ctx context.Context) (models.OutboxMessage, bool) {
+	msg, ok := ctx.Value(messageKey{}).(models.OutboxMessage)
+	return msg, ok
+}
+
+type handler struct {
+	name string
+	fn   HandlerFunc
+}
+
+// Dispatcher delivers outbox messages to the handlers subscribed to their
+// type. A message whose handler fails is retried with exponential backoff;
+// handlers that already succeeded are not run again.
+type Dispatcher struct {
+	collection *mongo.Collection
+	handlers   map[string][]handler
+
+	// Interval is how long to wait when the outbox is empty.
+	Interval time.Duration
+	// Lease is how long a claimed message is held, and so how long its
+	// handlers may take, before another dispatcher may claim it.
+	Lease time.Duration
+	// MaxAttempts is how many times a message is tried before it is marked
+	// failed, counting claims whose lease ran out.
+	MaxAttempts int
+	MinBackoff  time.Duration
+	MaxBackoff  time.Duration
+}
+
+func NewDispatcher(collection *mongo.Collection) *Dispatcher {
+	return &Dispatcher{
+		collection:  collection,
+		handlers:    make(map[string][]handler),
+		Interval:    2 * time.Second,
+		Lease:       time.Minute,
+		MaxAttempts: 10,
+		MinBackoff:  5 * time.Second,
+		MaxBackoff:  time.Hour,
+	}
+}
+
+// Handle subscribes a handler to an event type. The name identifies it in
+// the message's record of handled work, so it must stay the same across
+// releases.
+func (d *Dispatcher) Handle(eventType, name string, fn HandlerFunc) {
+	d.handlers[eventType] = append(d.handlers[eventType], handler{name: name, fn: fn})
+}
+
+// Backoff is how long to wait before the next attempt after the given
+// number of failed ones: min doubling each time, up to max.
+func Backoff(attempts int, min, max time.Duration) time.Duration {
+	wait := min
+	for i := 1; i < attempts && wait < max; i++ {
+		wait *= 2
+	}
+	if wait > max {
+		wait = max
+	}
+	return wait
+}
+
+// Run dispatches messages until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		msg, err := database.ClaimOutboxMessage(ctx, d.collection, d.Lease, d.MaxAttempts)
+		if err == nil {
+			d.dispatch(ctx, msg)
+			continue
+		}
+		if err != database.ErrOutboxEmpty {
+			log.Println(err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.Interval):
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, msg models.OutboxMessage) {
+	event, err := events.Decode(msg.Type, msg.Payload)
+	if err != nil {
+		// retrying won't make the message readable
+		d.retry(ctx, msg, err, false)
+		return
+	}
+
+	done := make(map[string]bool, len(msg.Handled))
+	for _, name := range msg.Handled {
+		done[name] = true
+	}
+	for _, h := range d.handlers[msg.Type] {
+		if done[h.name] {
+			continue
+		}
+		hctx, cancel := context.WithTimeout(context.WithValue(ctx, messageKey{}, msg), d.Lease)
+		err := h.fn(hctx, event)
+		cancel()
+		if err != nil {
+			log.Printf("outbox: %s %s: %s: %v", msg.Type, msg.Message_ID.Hex(), h.name, err)
+			d.retry(ctx, msg, err, true)
+			return
+		}
+		if err = database.MarkOutboxHandled(ctx, d.collection, msg.Message_ID, h.name); err != nil {
+			log.Println(err)
+		}
+	}
+	if err = database.MarkOutboxDispatched(ctx, d.collection, msg.Message_ID); err != nil {
+		log.Println(err)
+	}
+}
+
+func (d *Dispatcher) retry(ctx context.Context, msg models.OutboxMessage, cause error, retryable bool) {
+	var next *time.Time
+	if retryable && msg.Attempts < d.MaxAttempts {
+		at := time.Now().Add(Backoff(msg.Attempts, d.MinBackoff, d.MaxBackoff))
+		next = &at
+	}
+	if err := database.RetryOutboxLater(ctx, d.collection, msg.Message_ID, cause.Error(), next); err != nil {
+		log.Println(err)
+	}
+}
@@ -0,0 +1,76 @@
+package postal
+
+import (
+	"encoding/csv"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mreym/shopping/models"
+)
+
+// DatasetValidator checks postal codes against an offline list of the codes
+// that exist. Countries missing from the list are not checked.
+type DatasetValidator struct {
+	codes map[string]map[string]string
+}
+
+// LoadDataset reads a CSV file of country,postal_code[,city] rows. A header
+// row starting with "country" is skipped. When a city is given, addresses
+// with that code must be in that city.
+func LoadDataset(path string) (*DatasetValidator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	d := &DatasetValidator{codes: make(map[string]map[string]string)}
+	for line := 0; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 {
+			return nil, errors.New("postal dataset rows need a country and a postal code")
+		}
+		if line == 0 && strings.EqualFold(record[0], "country") {
+			continue
+		}
+
+		country := strings.ToUpper(strings.TrimSpace(record[0]))
+		entry := Normalize(models.Address{Country: &country, Pincode: &record[1]})
+		if d.codes[country] == nil {
+			d.codes[country] = make(map[string]string)
+		}
+		city := ""
+		if len(record) > 2 {
+			city = titleCase(record[2])
+		}
+		d.codes[country][value(entry.Pincode)] = city
+	}
+	return d, nil
+}
+
+func (d *DatasetValidator) Validate(address models.Address) error {
+	known, ok := d.codes[value(address.Country)]
+	if !ok || address.Pincode == nil {
+		return nil
+	}
+	city, ok := known[*address.Pincode]
+	if !ok {
+		return ValidationError{{Field: "pin_code", Message: "does not exist"}}
+	}
+	if city != "" && address.City != nil && !strings.EqualFold(city, *address.City) {
+		return ValidationError{{Field: "city_name", Message: "does not match the postal code, expected " + city}}
+	}
+	return nil
+}
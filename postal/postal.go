@@ -0,0 +1,163 @@
+package postal
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/mreym/shopping/models"
+)
+
+// DefaultCountry is assumed for addresses that don't name a country.
+const DefaultCountry = "IN"
+
+// Validator checks an address that has already been through Normalize.
+type Validator interface {
+	Validate(address models.Address) error
+}
+
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem found with an address.
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fe := range e {
+		messages = append(messages, fe.Field+": "+fe.Message)
+	}
+	return "invalid address: " + strings.Join(messages, "; ")
+}
+
+// Chain runs validators in order and stops at the first that fails.
+type Chain []Validator
+
+func (c Chain) Validate(address models.Address) error {
+	for _, v := range c {
+		if err := v.Validate(address); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func value(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+func collapse(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func titleCase(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, w := range words {
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
+
+func set(target **string, v string) {
+	if v == "" {
+		*target = nil
+		return
+	}
+	*target = &v
+}
+
+// Normalize trims and collapses whitespace in every field, title-cases the
+// city, upper-cases the country and formats the postal code the way the
+// country writes it.
+func Normalize(address models.Address) models.Address {
+	country := strings.ToUpper(strings.TrimSpace(value(address.Country)))
+	if country == "" {
+		country = DefaultCountry
+	}
+	set(&address.Country, country)
+	set(&address.House, collapse(value(address.House)))
+	set(&address.Street, collapse(value(address.Street)))
+	set(&address.City, titleCase(value(address.City)))
+
+	code := strings.ToUpper(collapse(value(address.Pincode)))
+	if rule, ok := rules[country]; ok && rule.format != nil {
+		code = rule.format(code)
+	}
+	set(&address.Pincode, code)
+	return address
+}
+
+type rule struct {
+	required []string
+	postcode *regexp.Regexp
+	format   func(string) string
+}
+
+func compact(code string) string {
+	return strings.ReplaceAll(code, " ", "")
+}
+
+// spaceBeforeLast3 writes UK and Canadian style codes as "SW1A 1AA".
+func spaceBeforeLast3(code string) string {
+	code = compact(code)
+	if len(code) <= 3 {
+		return code
+	}
+	return code[:len(code)-3] + " " + code[len(code)-3:]
+}
+
+var rules = map[string]rule{
+	"IN": {required: []string{"house_name", "street_name", "city_name", "pin_code"}, postcode: regexp.MustCompile(`^[1-9][0-9]{5}$`), format: compact},
+	"US": {required: []string{"street_name", "city_name", "pin_code"}, postcode: regexp.MustCompile(`^[0-9]{5}(-[0-9]{4})?$`), format: compact},
+	"GB": {required: []string{"street_name", "city_name", "pin_code"}, postcode: regexp.MustCompile(`^[A-Z]{1,2}[0-9][A-Z0-9]? [0-9][A-Z]{2}$`), format: spaceBeforeLast3},
+	"CA": {required: []string{"street_name", "city_name", "pin_code"}, postcode: regexp.MustCompile(`^[A-Z][0-9][A-Z] [0-9][A-Z][0-9]$`), format: spaceBeforeLast3},
+	"DE": {required: []string{"street_name", "city_name", "pin_code"}, postcode: regexp.MustCompile(`^[0-9]{5}$`), format: compact},
+	"JP": {required: []string{"street_name", "city_name", "pin_code"}, postcode: regexp.MustCompile(`^[0-9]{3}-[0-9]{4}$`)},
+	"AE": {required: []string{"street_name", "city_name"}},
+}
+
+// defaultRule applies to countries without their own rule.
+var defaultRule = rule{required: []string{"street_name", "city_name"}}
+
+// FormatValidator checks the required fields and postal code format of the
+// address's country.
+type FormatValidator struct{}
+
+func (FormatValidator) Validate(address models.Address) error {
+	country := value(address.Country)
+	r, ok := rules[country]
+	if !ok {
+		r = defaultRule
+	}
+
+	fields := map[string]string{
+		"house_name":  value(address.House),
+		"street_name": value(address.Street),
+		"city_name":   value(address.City),
+		"pin_code":    value(address.Pincode),
+	}
+
+	var problems ValidationError
+	if len(country) != 2 {
+		problems = append(problems, FieldError{Field: "country", Message: "must be a two letter country code"})
+	}
+	for _, field := range r.required {
+		if fields[field] == "" {
+			problems = append(problems, FieldError{Field: field, Message: "is required"})
+		}
+	}
+	if code := fields["pin_code"]; code != "" && r.postcode != nil && !r.postcode.MatchString(code) {
+		problems = append(problems, FieldError{Field: "pin_code", Message: "is not a valid postal code for " + country})
+	}
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package promotions
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mreym/shopping/models"
+)
+
+// Check validates a promotion definition, for admins creating one.
+func Check(p models.Promotion) error {
+	if strings.TrimSpace(p.Name) == "" {
+		return errors.New("promotion needs a name")
+	}
+	switch p.Type {
+	case models.PromotionBuyXGetY:
+		if p.Buy_Quantity <= 0 || p.Free_Quantity <= 0 {
+			return errors.New("buy_quantity and free_quantity must be positive")
+		}
+	case models.PromotionPercentOff:
+		if p.Percent <= 0 || p.Percent > 10000 {
+			return errors.New("percent must be between 1 and 10000 basis points")
+		}
+	case models.PromotionTiered:
+		if len(p.Tiers) == 0 {
+			return errors.New("tiered promotions need at least one tier")
+		}
+		for _, tier := range p.Tiers {
+			if tier.Percent <= 0 || tier.Percent > 10000 {
+				return errors.New("tier percent must be between 1 and 10000 basis points")
+			}
+			if tier.Min_Spend.Currency != models.DefaultCurrency {
+				return errors.New("tier min_spend must be in " + models.DefaultCurrency)
+			}
+		}
+	default:
+		return errors.New("unknown promotion type")
+	}
+	// carts are priced in the store currency, so spends compared with them
+	// must be too
+	if p.Min_Spend != nil && p.Min_Spend.Currency != models.DefaultCurrency {
+		return errors.New("min_spend must be in " + models.DefaultCurrency)
+	}
+	if p.Valid_From != nil && p.Valid_Until != nil && p.Valid_Until.Before(*p.Valid_From) {
+		return errors.New("valid_until is before valid_from")
+	}
+	return nil
+}
+
+func running(p models.Promotion, now time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.Valid_From != nil && now.Before(*p.Valid_From) {
+		return false
+	}
+	if p.Valid_Until != nil && now.After(*p.Valid_Until) {
+		return false
+	}
+	return true
+}
+
+func inScope(p models.Promotion, item models.ProductUser) bool {
+	if len(p.Product_IDs) == 0 && len(p.Categories) == 0 {
+		return true
+	}
+	for _, id := range p.Product_IDs {
+		if id == item.Product_ID {
+			return true
+		}
+	}
+	if item.Category != nil {
+		for _, category := range p.Categories {
+			if strings.EqualFold(category, *item.Category) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func scopeLabel(p models.Promotion) string {
+	if len(p.Categories) > 0 {
+		return strings.Join(p.Categories, ", ")
+	}
+	if len(p.Product_IDs) > 0 {
+		return "selected products"
+	}
+	return "everything"
+}
+
+func percentLabel(basisPoints int64) string {
+	if basisPoints%100 == 0 {
+		return fmt.Sprintf("%d%%", basisPoints/100)
+	}
+	return fmt.Sprintf("%d.%02d%%", basisPoints/100, basisPoints%100)
+}
+
+// evaluate works out what a single promotion takes off the lines in its
+// scope. Each cart line is one unit, as the cart stores a line per item added.
+func evaluate(p models.Promotion, cart []models.ProductUser, currency string) (models.Money, string, error) {
+	zero := models.ZeroMoney(currency)
+
+	var scoped []models.Money
+	for _, item := range cart {
+		if inScope(p, item) {
+			scoped = append(scoped, item.Price)
+		}
+	}
+	if len(scoped) == 0 {
+		return zero, "", nil
+	}
+	scopedTotal, err := models.SumMoney(currency, scoped...)
+	if err != nil {
+		return zero, "", err
+	}
+
+	switch p.Type {
+	case models.PromotionBuyXGetY:
+		// the cheapest items of every full group of buy+free are the free ones
+		group := p.Buy_Quantity + p.Free_Quantity
+		freeItems := len(scoped) / group * p.Free_Quantity
+		if freeItems == 0 {
+			return zero, "", nil
+		}
+		sort.Slice(scoped, func(i, j int) bool { return scoped[i].Amount < scoped[j].Amount })
+		discount, err := models.SumMoney(currency, scoped[:freeItems]...)
+		if err != nil {
+			return zero, "", err
+		}
+		return discount, fmt.Sprintf("Buy %d get %d free on %s: %d item(s) free", p.Buy_Quantity, p.Free_Quantity, scopeLabel(p), freeItems), nil
+
+	case models.PromotionPercentOff:
+		if p.Min_Spend != nil {
+			short, err := scopedTotal.Sub(*p.Min_Spend)
+			if err != nil {
+				return zero, "", err
+			}
+			if short.IsNegative() {
+				return zero, "", nil
+			}
+		}
+		discount, err := scopedTotal.Percent(p.Percent)
+		if err != nil {
+			return zero, "", err
+		}
+		description := fmt.Sprintf("%s off %s", percentLabel(p.Percent), scopeLabel(p))
+		if p.Min_Spend != nil {
+			description += " over " + p.Min_Spend.String()
+		}
+		return discount, description, nil
+
+	case models.PromotionTiered:
+		var best *models.PromotionTier
+		for i, tier := range p.Tiers {
+			short, err := scopedTotal.Sub(tier.Min_Spend)
+			if err != nil {
+				return zero, "", err
+			}
+			if !short.IsNegative() && (best == nil || tier.Min_Spend.Amount > best.Min_Spend.Amount) {
+				best = &p.Tiers[i]
+			}
+		}
+		if best == nil {
+			return zero, "", nil
+		}
+		discount, err := scopedTotal.Percent(best.Percent)
+		if err != nil {
+			return zero, "", err
+		}
+		return discount, fmt.Sprintf("%s off %s for spending over %s", percentLabel(best.Percent), scopeLabel(p), best.Min_Spend.String()), nil
+	}
+	return zero, "", nil
+}
+
+// Evaluate runs the promotions against the cart in priority order and returns
+// the ones that applied with the total they take off. Stackable promotions
+// add up; a non stackable one only applies when it is the first to match,
+// and then nothing after it does. The total never exceeds the subtotal.
+func Evaluate(list []models.Promotion, cart []models.ProductUser, subtotal models.Money, now time.Time) ([]models.AppliedPromotion, models.Money, error) {
+	applied := make([]models.AppliedPromotion, 0)
+	total := models.ZeroMoney(subtotal.Currency)
+
+	ordered := append([]models.Promotion(nil), list...)
+	sort.SliceStable(ordered, func(i, j int) bool { return ordered[i].Priority > ordered[j].Priority })
+
+	for _, p := range ordered {
+		if !running(p, now) {
+			continue
+		}
+		if !p.Stackable && len(applied) > 0 {
+			continue
+		}
+
+		discount, description, err := evaluate(p, cart, subtotal.Currency)
+		if err != nil {
+			return nil, total, err
+		}
+		if discount.Amount <= 0 {
+			continue
+		}
+
+		remaining, err := subtotal.Sub(total)
+		if err != nil {
+			return nil, total, err
+		}
+		if discount, err = discount.Min(remaining); err != nil {
+			return nil, total, err
+		}
+		if discount.Amount <= 0 {
+			break
+		}
+		if total, err = total.Add(discount); err != nil {
+			return nil, total, err
+		}
+		applied = append(applied, models.AppliedPromotion{
+			Promotion_ID: p.Promotion_ID,
+			Name:         p.Name,
+			Description:  description,
+			Discount:     discount,
+		})
+
+		if !p.Stackable {
+			break
+		}
+	}
+	return applied, total, nil
+}
@@ -0,0 +1,111 @@
+package promotions
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+func inr(amount int64) models.Money {
+	return models.NewMoney(amount, "INR")
+}
+
+func TestEvaluate(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	yesterday := now.Add(-24 * time.Hour)
+	shirts, shoes := "Shirts", "Shoes"
+	cart := []models.ProductUser{
+		{Product_ID: primitive.NewObjectID(), Category: &shirts, Price: inr(100)},
+		{Product_ID: primitive.NewObjectID(), Category: &shirts, Price: inr(200)},
+		{Product_ID: primitive.NewObjectID(), Category: &shoes, Price: inr(300)},
+		{Product_ID: primitive.NewObjectID(), Category: &shoes, Price: inr(400)},
+	}
+	spend := func(m models.Money) *models.Money { return &m }
+
+	percent := func(name string, bp int64, priority int, stackable bool) models.Promotion {
+		return models.Promotion{Name: name, Type: models.PromotionPercentOff, Percent: bp, Priority: priority, Stackable: stackable, Active: true}
+	}
+	tests := []struct {
+		name  string
+		list  []models.Promotion
+		names []string
+		total models.Money
+	}{
+		{"buy one get one frees the cheapest", []models.Promotion{
+			{Name: "B1G1", Type: models.PromotionBuyXGetY, Buy_Quantity: 1, Free_Quantity: 1, Active: true},
+		}, []string{"B1G1"}, inr(300)},
+		{"buy three get one needs a full group in scope", []models.Promotion{
+			{Name: "B3G1", Type: models.PromotionBuyXGetY, Buy_Quantity: 3, Free_Quantity: 1, Categories: []string{"shoes"}, Active: true},
+		}, nil, inr(0)},
+		{"percent off a category", []models.Promotion{
+			{Name: "Shoes", Type: models.PromotionPercentOff, Percent: 1000, Categories: []string{"shoes"}, Active: true},
+		}, []string{"Shoes"}, inr(70)},
+		{"percent off below minimum spend", []models.Promotion{
+			{Name: "Big", Type: models.PromotionPercentOff, Percent: 1000, Min_Spend: spend(inr(1001)), Active: true},
+		}, nil, inr(0)},
+		{"tiered takes the highest tier reached", []models.Promotion{
+			{Name: "Tiers", Type: models.PromotionTiered, Tiers: []models.PromotionTier{
+				{Min_Spend: inr(500), Percent: 500}, {Min_Spend: inr(900), Percent: 1000}, {Min_Spend: inr(2000), Percent: 2000},
+			}, Active: true},
+		}, []string{"Tiers"}, inr(100)},
+		{"inactive", []models.Promotion{
+			{Name: "Off", Type: models.PromotionPercentOff, Percent: 1000},
+		}, nil, inr(0)},
+		{"expired", []models.Promotion{
+			{Name: "Old", Type: models.PromotionPercentOff, Percent: 1000, Valid_Until: &yesterday, Active: true},
+		}, nil, inr(0)},
+		{"non stackable first match stops the rest", []models.Promotion{
+			percent("Low", 2000, 1, true), percent("High", 1000, 2, false),
+		}, []string{"High"}, inr(100)},
+		{"stackable add up in priority order", []models.Promotion{
+			percent("Second", 2000, 1, true), percent("First", 1000, 2, true),
+		}, []string{"First", "Second"}, inr(300)},
+		{"non stackable after a match is skipped", []models.Promotion{
+			percent("First", 1000, 2, true), percent("Alone", 5000, 1, false),
+		}, []string{"First"}, inr(100)},
+		{"total capped at the subtotal", []models.Promotion{
+			percent("A", 6000, 2, true), percent("B", 6000, 1, true),
+		}, []string{"A", "B"}, inr(1000)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			applied, total, err := Evaluate(tt.list, cart, inr(1000), now)
+			var names []string
+			for _, a := range applied {
+				names = append(names, a.Name)
+			}
+			if err != nil || !reflect.DeepEqual(names, tt.names) || total != tt.total {
+				t.Errorf("Evaluate() = %v, %v, %v, want %v, %v", names, total, err, tt.names, tt.total)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name      string
+		promotion models.Promotion
+		wantErr   bool
+	}{
+		{"buy x get y", models.Promotion{Name: "B2G1", Type: models.PromotionBuyXGetY, Buy_Quantity: 2, Free_Quantity: 1}, false},
+		{"percent off", models.Promotion{Name: "Ten", Type: models.PromotionPercentOff, Percent: 1000}, false},
+		{"tiered", models.Promotion{Name: "Tiers", Type: models.PromotionTiered, Tiers: []models.PromotionTier{{Min_Spend: inr(100), Percent: 500}}}, false},
+		{"no name", models.Promotion{Type: models.PromotionPercentOff, Percent: 1000}, true},
+		{"unknown type", models.Promotion{Name: "X", Type: "bogus"}, true},
+		{"nothing free", models.Promotion{Name: "X", Type: models.PromotionBuyXGetY, Buy_Quantity: 2}, true},
+		{"percent over 100%", models.Promotion{Name: "X", Type: models.PromotionPercentOff, Percent: 10001}, true},
+		{"no tiers", models.Promotion{Name: "X", Type: models.PromotionTiered}, true},
+		{"tier in other currency", models.Promotion{Name: "X", Type: models.PromotionTiered, Tiers: []models.PromotionTier{{Min_Spend: models.NewMoney(100, "USD"), Percent: 500}}}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check(tt.promotion); (err != nil) != tt.wantErr {
+				t.Errorf("Check() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
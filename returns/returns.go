@@ -0,0 +1,173 @@
+package returns
+
+import (
+	"errors"
+	"math/big"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrWindowClosed    = errors.New("the return window for this order has closed")
+	ErrNoItems         = errors.New("choose at least one item to return")
+	ErrNotInOrder      = errors.New("the product is not part of the order")
+	ErrTooMany         = errors.New("more units than were bought, or already being returned")
+	ErrBadTransition   = errors.New("the return cannot move to that status")
+	ErrRefundTooLarge  = errors.New("the refund is more than is left to refund on the order")
+	ErrInvalidQuantity = errors.New("quantity must be at least 1")
+)
+
+// next lists where a return can go from each status.
+var next = map[string][]string{
+	models.ReturnRequested: {models.ReturnApproved, models.ReturnRejected},
+	models.ReturnApproved:  {models.ReturnReceived, models.ReturnRejected},
+	models.ReturnReceived:  {models.ReturnRefunded},
+}
+
+func CanMove(from, to string) bool {
+	for _, status := range next[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Ordered counts the units of each product in an order; the order holds one
+// line per unit.
+func Ordered(order models.Order) map[primitive.ObjectID]int {
+	counts := make(map[primitive.ObjectID]int)
+	for _, line := range order.Order_Cart {
+		counts[line.Product_ID]++
+	}
+	return counts
+}
+
+// Claimed counts the units already covered by returns that weren't rejected.
+func Claimed(existing []models.Return) map[primitive.ObjectID]int {
+	counts := make(map[primitive.ObjectID]int)
+	for _, r := range existing {
+		if r.Status == models.ReturnRejected {
+			continue
+		}
+		for _, item := range r.Items {
+			counts[item.Product_ID] += item.Quantity
+		}
+	}
+	return counts
+}
+
+// Check validates what a customer asked to return against the order and the
+// returns already made on it. It returns the items with product names and
+// unit prices filled in from the order, one item per product.
+func Check(order models.Order, existing []models.Return, items []models.ReturnItem, now time.Time, window time.Duration) ([]models.ReturnItem, error) {
+	if now.After(order.Ordered_At.Add(window)) {
+		return nil, ErrWindowClosed
+	}
+	if len(items) == 0 {
+		return nil, ErrNoItems
+	}
+
+	lines := make(map[primitive.ObjectID]models.ProductUser)
+	for _, line := range order.Order_Cart {
+		lines[line.Product_ID] = line
+	}
+	ordered, claimed := Ordered(order), Claimed(existing)
+
+	checked := make([]models.ReturnItem, 0, len(items))
+	index := make(map[primitive.ObjectID]int)
+	for _, item := range items {
+		if item.Quantity < 1 {
+			return nil, ErrInvalidQuantity
+		}
+		line, ok := lines[item.Product_ID]
+		if !ok {
+			return nil, ErrNotInOrder
+		}
+		claimed[item.Product_ID] += item.Quantity
+		if claimed[item.Product_ID] > ordered[item.Product_ID] {
+			return nil, ErrTooMany
+		}
+		if i, seen := index[item.Product_ID]; seen {
+			checked[i].Quantity += item.Quantity
+			continue
+		}
+		index[item.Product_ID] = len(checked)
+		checked = append(checked, models.ReturnItem{
+			Product_ID:   item.Product_ID,
+			Product_Name: line.Product_Name,
+			Quantity:     item.Quantity,
+			Unit_Price:   line.Price,
+			Reason:       item.Reason,
+		})
+	}
+	return checked, nil
+}
+
+// Refundable is what the customer paid for the goods of an order, which is
+// the most that can be refunded on it. Shipping is not refunded.
+func Refundable(order models.Order) (models.Money, error) {
+	return order.Price.Sub(order.Shipping)
+}
+
+// RefundAmount is what the returned items cost the customer. Each unit gets
+// its share of the order's discounts and tax, in proportion to its price.
+func RefundAmount(order models.Order, items []models.ReturnItem) (models.Money, error) {
+	goods, err := Refundable(order)
+	if err != nil {
+		return goods, err
+	}
+	prices := make([]models.Money, 0, len(order.Order_Cart))
+	for _, line := range order.Order_Cart {
+		prices = append(prices, line.Price)
+	}
+	subtotal, err := models.SumMoney(goods.Currency, prices...)
+	if err != nil {
+		return goods, err
+	}
+
+	returned := models.ZeroMoney(goods.Currency)
+	for _, item := range items {
+		value, err := item.Unit_Price.Mul(int64(item.Quantity))
+		if err != nil {
+			return returned, err
+		}
+		if returned, err = returned.Add(value); err != nil {
+			return returned, err
+		}
+	}
+	if subtotal.IsZero() {
+		return models.ZeroMoney(goods.Currency), nil
+	}
+	refund, err := returned.MulRat(new(big.Rat).SetFrac64(goods.Amount, subtotal.Amount))
+	if err != nil {
+		return refund, err
+	}
+	return refund.Min(goods)
+}
+
+// Summarize totals what has come back from an order, counting only returns
+// that were received.
+func Summarize(existing []models.Return) []models.ReturnedQuantity {
+	counts := make(map[primitive.ObjectID]int)
+	var order []primitive.ObjectID
+	for _, r := range existing {
+		if r.Status != models.ReturnReceived && r.Status != models.ReturnRefunded {
+			continue
+		}
+		for _, item := range r.Items {
+			if _, seen := counts[item.Product_ID]; !seen {
+				order = append(order, item.Product_ID)
+			}
+			counts[item.Product_ID] += item.Quantity
+		}
+	}
+	summary := make([]models.ReturnedQuantity, 0, len(order))
+	for _, id := range order {
+		summary = append(summary, models.ReturnedQuantity{Product_ID: id, Quantity: counts[id]})
+	}
+	return summary
+}
@@ -0,0 +1,129 @@
+package returns
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+func inr(amount int64) models.Money {
+	return models.NewMoney(amount, "INR")
+}
+
+// order is two units of a at 1000 and one of b at 2000, with 400 off and 500
+// shipping, so 3600 paid for the goods.
+func order(a, b primitive.ObjectID, orderedAt time.Time) models.Order {
+	return models.Order{
+		Ordered_At: orderedAt,
+		Order_Cart: []models.ProductUser{
+			{Product_ID: a, Price: inr(1000)},
+			{Product_ID: a, Price: inr(1000)},
+			{Product_ID: b, Price: inr(2000)},
+		},
+		Price:    inr(4100),
+		Shipping: inr(500),
+	}
+}
+
+func TestCheck(t *testing.T) {
+	a, b, other := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	now := time.Date(2024, 6, 10, 0, 0, 0, 0, time.UTC)
+	o := order(a, b, now.Add(-5*24*time.Hour))
+	prices := map[primitive.ObjectID]models.Money{a: inr(1000), b: inr(2000)}
+	returned := func(status string, id primitive.ObjectID, quantity int) []models.Return {
+		return []models.Return{{Status: status, Items: []models.ReturnItem{{Product_ID: id, Quantity: quantity}}}}
+	}
+	tests := []struct {
+		name     string
+		existing []models.Return
+		items    []models.ReturnItem
+		window   time.Duration
+		want     map[primitive.ObjectID]int
+		err      error
+	}{
+		{"one unit", nil, []models.ReturnItem{{Product_ID: a, Quantity: 1}}, 30 * 24 * time.Hour, map[primitive.ObjectID]int{a: 1}, nil},
+		{"every unit", nil, []models.ReturnItem{{Product_ID: a, Quantity: 2}, {Product_ID: b, Quantity: 1}}, 30 * 24 * time.Hour, map[primitive.ObjectID]int{a: 2, b: 1}, nil},
+		{"same product twice is merged", nil, []models.ReturnItem{{Product_ID: a, Quantity: 1}, {Product_ID: a, Quantity: 1}}, 30 * 24 * time.Hour, map[primitive.ObjectID]int{a: 2}, nil},
+		{"more than bought", nil, []models.ReturnItem{{Product_ID: a, Quantity: 3}}, 30 * 24 * time.Hour, nil, ErrTooMany},
+		{"already being returned", returned(models.ReturnRequested, a, 2), []models.ReturnItem{{Product_ID: a, Quantity: 1}}, 30 * 24 * time.Hour, nil, ErrTooMany},
+		{"rejected returns don't count", returned(models.ReturnRejected, a, 2), []models.ReturnItem{{Product_ID: a, Quantity: 2}}, 30 * 24 * time.Hour, map[primitive.ObjectID]int{a: 2}, nil},
+		{"not in the order", nil, []models.ReturnItem{{Product_ID: other, Quantity: 1}}, 30 * 24 * time.Hour, nil, ErrNotInOrder},
+		{"zero quantity", nil, []models.ReturnItem{{Product_ID: a}}, 30 * 24 * time.Hour, nil, ErrInvalidQuantity},
+		{"nothing asked for", nil, nil, 30 * 24 * time.Hour, nil, ErrNoItems},
+		{"window closed", nil, []models.ReturnItem{{Product_ID: a, Quantity: 1}}, 4 * 24 * time.Hour, nil, ErrWindowClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := Check(o, tt.existing, tt.items, now, tt.window)
+			var got map[primitive.ObjectID]int
+			for _, item := range items {
+				if got == nil {
+					got = make(map[primitive.ObjectID]int)
+				}
+				got[item.Product_ID] = item.Quantity
+				if item.Unit_Price != prices[item.Product_ID] {
+					t.Errorf("Check() priced %v at %v, want %v", item.Product_ID, item.Unit_Price, prices[item.Product_ID])
+				}
+			}
+			if err != tt.err || !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Check() = %v, %v, want %v, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestRefundAmount(t *testing.T) {
+	a, b := primitive.NewObjectID(), primitive.NewObjectID()
+	o := order(a, b, time.Now())
+	odd := o
+	odd.Price = inr(3833)
+	tests := []struct {
+		name  string
+		order models.Order
+		items []models.ReturnItem
+		want  models.Money
+	}{
+		{"one unit takes its share of the discount", o, []models.ReturnItem{{Product_ID: a, Quantity: 1, Unit_Price: inr(1000)}}, inr(900)},
+		{"dearer unit", o, []models.ReturnItem{{Product_ID: b, Quantity: 1, Unit_Price: inr(2000)}}, inr(1800)},
+		{"everything is what was paid for the goods", o, []models.ReturnItem{
+			{Product_ID: a, Quantity: 2, Unit_Price: inr(1000)}, {Product_ID: b, Quantity: 1, Unit_Price: inr(2000)},
+		}, inr(3600)},
+		{"rounds to the nearest paisa", odd, []models.ReturnItem{{Product_ID: a, Quantity: 1, Unit_Price: inr(1000)}}, inr(833)},
+		{"nothing", o, nil, inr(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := RefundAmount(tt.order, tt.items)
+			if err != nil || got != tt.want {
+				t.Errorf("RefundAmount() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanMove(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{models.ReturnRequested, models.ReturnApproved, true},
+		{models.ReturnRequested, models.ReturnRejected, true},
+		{models.ReturnApproved, models.ReturnReceived, true},
+		{models.ReturnReceived, models.ReturnRefunded, true},
+		{models.ReturnRequested, models.ReturnReceived, false},
+		{models.ReturnReceived, models.ReturnRejected, false},
+		{models.ReturnRefunded, models.ReturnRequested, false},
+		{models.ReturnRejected, models.ReturnApproved, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			if got := CanMove(tt.from, tt.to); got != tt.want {
+				t.Errorf("CanMove() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package reviews
+
+import (
+	"errors"
+	"math"
+	"strings"
+
+	"github.com/mreym/shopping/models"
+)
+
+const (
+	MaxTitle = 120
+	MaxBody  = 5000
+)
+
+var (
+	ErrInvalidRating = errors.New("rating must be from 1 to 5 stars")
+	ErrTooLong       = errors.New("the title or text of the review is too long")
+)
+
+// Sort orders for listing reviews.
+const (
+	SortRecent     = "recent"
+	SortHelpful    = "helpful"
+	SortRatingHigh = "rating_high"
+	SortRatingLow  = "rating_low"
+)
+
+// Clean trims the review text and checks it can be posted.
+func Clean(review *models.Review) error {
+	if review.Rating < 1 || review.Rating > 5 {
+		return ErrInvalidRating
+	}
+	review.Title = strings.TrimSpace(review.Title)
+	review.Body = strings.TrimSpace(review.Body)
+	if len([]rune(review.Title)) > MaxTitle || len([]rune(review.Body)) > MaxBody {
+		return ErrTooLong
+	}
+	return nil
+}
+
+// Summarize turns the number of reviews per star rating into a product's
+// rating summary. The average is rounded to one decimal place.
+func Summarize(counts map[int]int) models.RatingSummary {
+	var summary models.RatingSummary
+	total := 0
+	for stars := 1; stars <= 5; stars++ {
+		n := counts[stars]
+		summary.Distribution[stars-1] = n
+		summary.Count += n
+		total += stars * n
+	}
+	if summary.Count > 0 {
+		summary.Average = math.Round(float64(total)*10/float64(summary.Count)) / 10
+	}
+	return summary
+}
@@ -4,13 +4,86 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/mreym/shopping/controllers"
+	"github.com/mreym/shopping/middleware"
+	"github.com/mreym/shopping/models"
+	"github.com/mreym/shopping/moderation"
 )
 
 func UserRoutes(incomingRoutes *gin.Engine) {
 	incomingRoutes.POST("/users/signup", controllers.Signup())
 	// incomingRoutes.POST("/users/signup", controllers.Signup())
 	incomingRoutes.POST("/users/login", controllers.Login())
-	incomingRoutes.POST("/admin/addproduct", controllers.ProductViewerAdmin())
+	incomingRoutes.GET("/users/verify", controllers.VerifyEmail())
+	incomingRoutes.POST("/users/password/forgot", controllers.ForgotPassword())
+	incomingRoutes.POST("/users/password/reset", controllers.ResetPassword())
 	incomingRoutes.GET("/users/productview", controllers.SearchProduct())
 	incomingRoutes.GET("/users/search", controllers.SearchProductByQuery())
+	incomingRoutes.GET("/search/suggest", controllers.SearchSuggest())
+	incomingRoutes.GET("/currencies", controllers.ListCurrencies())
+	incomingRoutes.GET("/wishlists/shared/:token", controllers.SharedWishlist())
+	incomingRoutes.GET("/products/:id/reviews", controllers.ProductReviews())
+	incomingRoutes.GET("/products/:id/questions", controllers.ProductQuestions())
+	incomingRoutes.GET("/guest/cart", controllers.GetGuestCart())
+	incomingRoutes.POST("/guest/cart/items/:product", controllers.AddGuestCartItem())
+	incomingRoutes.DELETE("/guest/cart/items/:product", controllers.RemoveGuestCartItem())
+}
+
+func AdminRoutes(incomingRoutes *gin.Engine) {
+	admin := incomingRoutes.Group("/admin", middleware.AdminAuthentication())
+	admin.POST("/addproduct", controllers.ProductViewerAdmin())
+	admin.GET("/rates", controllers.ListExchangeRates())
+	admin.PUT("/rates", controllers.SetExchangeRate())
+	admin.DELETE("/rates/:currency", controllers.DeleteExchangeRate())
+	admin.GET("/coupons", controllers.ListCoupons())
+	admin.POST("/coupons", controllers.CreateCoupon())
+	admin.DELETE("/coupons/:code", controllers.DeleteCoupon())
+	admin.GET("/promotions", controllers.ListPromotions())
+	admin.POST("/promotions", controllers.CreatePromotion())
+	admin.PUT("/promotions/:id", controllers.SetPromotionActive())
+	admin.DELETE("/promotions/:id", controllers.DeletePromotion())
+	admin.GET("/taxrates", controllers.ListTaxRates())
+	admin.POST("/taxrates", controllers.CreateTaxRate())
+	admin.DELETE("/taxrates/:id", controllers.DeleteTaxRate())
+	admin.GET("/shippingrates", controllers.ListShippingRates())
+	admin.POST("/shippingrates", controllers.CreateShippingRate())
+	admin.DELETE("/shippingrates/:id", controllers.DeleteShippingRate())
+	admin.POST("/shipments", controllers.CreateShipment())
+	admin.PUT("/shipments/:id", controllers.UpdateShipment())
+	admin.POST("/shipments/:id/events", controllers.AddShipmentEvent())
+	admin.GET("/orders/:id/shipments", controllers.ListOrderShipments())
+	admin.GET("/returns", controllers.ListReturns())
+	admin.PUT("/returns/:id/approve", controllers.ApproveReturn())
+	admin.PUT("/returns/:id/reject", controllers.RejectReturn())
+	admin.PUT("/returns/:id/receive", controllers.ReceiveReturn())
+	admin.POST("/returns/:id/refund", controllers.RefundReturn())
+	admin.GET("/orders/:id/invoice", controllers.AdminOrderInvoice())
+	admin.GET("/invoices/:number", controllers.GetInvoice())
+	admin.GET("/moderation/reviews", controllers.ModerationQueue(moderation.KindReview))
+	admin.PUT("/moderation/reviews/:id/approve", controllers.Moderate(moderation.KindReview, models.ModerationApproved))
+	admin.PUT("/moderation/reviews/:id/reject", controllers.Moderate(moderation.KindReview, models.ModerationRejected))
+	admin.PUT("/moderation/reviews/:id/hide", controllers.Moderate(moderation.KindReview, models.ModerationHidden))
+	admin.GET("/moderation/questions", controllers.ModerationQueue(moderation.KindQuestion))
+	admin.PUT("/moderation/questions/:id/approve", controllers.Moderate(moderation.KindQuestion, models.ModerationApproved))
+	admin.PUT("/moderation/questions/:id/reject", controllers.Moderate(moderation.KindQuestion, models.ModerationRejected))
+	admin.PUT("/moderation/questions/:id/hide", controllers.Moderate(moderation.KindQuestion, models.ModerationHidden))
+	admin.GET("/moderation/answers", controllers.ModerationQueue(moderation.KindAnswer))
+	admin.PUT("/moderation/answers/:id/approve", controllers.Moderate(moderation.KindAnswer, models.ModerationApproved))
+	admin.PUT("/moderation/answers/:id/reject", controllers.Moderate(moderation.KindAnswer, models.ModerationRejected))
+	admin.PUT("/moderation/answers/:id/hide", controllers.Moderate(moderation.KindAnswer, models.ModerationHidden))
+	admin.GET("/questions/unanswered", controllers.UnansweredQuestions())
+	admin.POST("/questions/:id/answers", controllers.StaffAnswer())
+	admin.GET("/moderation/log", controllers.ModerationLog())
+	admin.GET("/outbox", controllers.ListOutbox())
+	admin.POST("/outbox/:id/requeue", controllers.RequeueOutboxMessage())
+	admin.GET("/webhooks", controllers.ListWebhooks())
+	admin.POST("/webhooks", controllers.CreateWebhook())
+	admin.PUT("/webhooks/:id", controllers.UpdateWebhook())
+	admin.DELETE("/webhooks/:id", controllers.DeleteWebhook())
+	admin.POST("/webhooks/:id/secret", controllers.RotateWebhookSecret())
+	admin.GET("/webhooks/:id/deliveries", controllers.ListWebhookDeliveries())
+	admin.POST("/webhook-deliveries/:id/redeliver", controllers.RedeliverWebhook())
+	admin.GET("/login-attempts", controllers.LoginAttempts())
+	admin.GET("/login-locks", controllers.LockedLogins())
+	admin.POST("/users/:id/unlock", controllers.UnlockUser())
+	admin.DELETE("/login-locks/ip/:ip", controllers.UnlockIP())
 }
@@ -0,0 +1,182 @@
+package search
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	KindProduct  = "product"
+	KindCategory = "category"
+	KindQuery    = "query"
+)
+
+const (
+	// MaxQueries past search queries are remembered; beyond that the one
+	// searched least recently is forgotten.
+	MaxQueries = 5000
+	// MinSearchers different customers must have searched a query before it
+	// is suggested, so one customer can't plant suggestions.
+	MinSearchers = 3
+)
+
+type Suggestion struct {
+	Text string `json:"text"`
+	Kind string `json:"kind"`
+}
+
+type entry struct {
+	key  string
+	text string
+}
+
+// queryStat is how often a query was searched, by whom, and when last.
+type queryStat struct {
+	hits      int
+	searchers map[string]bool
+	used      uint64
+}
+
+// Index keeps product names, categories and past search queries in sorted
+// slices so that prefix lookups are a binary search instead of a db round trip.
+type Index struct {
+	mu         sync.RWMutex
+	products   []entry
+	categories []entry
+	queries    []entry
+	stats      map[string]*queryStat
+	clock      uint64
+}
+
+func NewIndex() *Index {
+	return &Index{stats: make(map[string]*queryStat)}
+}
+
+func normalize(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
+
+func build(values []string) []entry {
+	seen := make(map[string]bool)
+	entries := make([]entry, 0, len(values))
+	for _, v := range values {
+		key := normalize(v)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		entries = append(entries, entry{key: key, text: strings.TrimSpace(v)})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].key < entries[j].key })
+	return entries
+}
+
+// Load replaces the product names and categories in the index. Popular
+// queries are kept across reloads.
+func (i *Index) Load(names, categories []string) {
+	products := build(names)
+	cats := build(categories)
+
+	i.mu.Lock()
+	i.products = products
+	i.categories = cats
+	i.mu.Unlock()
+}
+
+// RecordQuery counts a search made by a customer, told apart by searcher,
+// so it can be offered as a suggestion to others once MinSearchers have made
+// it. Only MaxQueries queries are kept.
+func (i *Index) RecordQuery(query string, searcher string) {
+	key := normalize(query)
+	if key == "" {
+		return
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.clock++
+	stat, ok := i.stats[key]
+	if !ok {
+		if len(i.stats) >= MaxQueries {
+			i.forgetOldestQuery()
+		}
+		pos := sort.Search(len(i.queries), func(n int) bool { return i.queries[n].key >= key })
+		i.queries = append(i.queries, entry{})
+		copy(i.queries[pos+1:], i.queries[pos:])
+		i.queries[pos] = entry{key: key, text: key}
+		stat = &queryStat{searchers: make(map[string]bool)}
+		i.stats[key] = stat
+	}
+	stat.hits++
+	stat.used = i.clock
+	// past MinSearchers only the count matters
+	if len(stat.searchers) < MinSearchers {
+		stat.searchers[searcher] = true
+	}
+}
+
+// forgetOldestQuery drops the query searched least recently. i.mu must be
+// held for writing.
+func (i *Index) forgetOldestQuery() {
+	oldest := ""
+	for key, stat := range i.stats {
+		if oldest == "" || stat.used < i.stats[oldest].used {
+			oldest = key
+		}
+	}
+	delete(i.stats, oldest)
+	pos := sort.Search(len(i.queries), func(n int) bool { return i.queries[n].key >= oldest })
+	if pos < len(i.queries) && i.queries[pos].key == oldest {
+		i.queries = append(i.queries[:pos], i.queries[pos+1:]...)
+	}
+}
+
+func prefixMatches(entries []entry, prefix string) []entry {
+	start := sort.Search(len(entries), func(n int) bool { return entries[n].key >= prefix })
+	end := start
+	for end < len(entries) && strings.HasPrefix(entries[end].key, prefix) {
+		end++
+	}
+	return entries[start:end]
+}
+
+// Suggest returns up to limit suggestions for the prefix. Popular queries come
+// first (most searched first), followed by categories and product names.
+// Queries fewer than MinSearchers customers made are left out.
+func (i *Index) Suggest(prefix string, limit int) []Suggestion {
+	prefix = normalize(prefix)
+	suggestions := make([]Suggestion, 0, limit)
+	if prefix == "" || limit <= 0 {
+		return suggestions
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	queries := make([]entry, 0)
+	for _, e := range prefixMatches(i.queries, prefix) {
+		if len(i.stats[e.key].searchers) >= MinSearchers {
+			queries = append(queries, e)
+		}
+	}
+	sort.SliceStable(queries, func(a, b int) bool { return i.stats[queries[a].key].hits > i.stats[queries[b].key].hits })
+
+	seen := make(map[string]bool)
+	add := func(entries []entry, kind string) {
+		for _, e := range entries {
+			if len(suggestions) >= limit {
+				return
+			}
+			if seen[kind+e.key] {
+				continue
+			}
+			seen[kind+e.key] = true
+			suggestions = append(suggestions, Suggestion{Text: e.text, Kind: kind})
+		}
+	}
+	add(queries, KindQuery)
+	add(prefixMatches(i.categories, prefix), KindCategory)
+	add(prefixMatches(i.products, prefix), KindProduct)
+	return suggestions
+}
@@ -0,0 +1,136 @@
+package shipping
+
+import (
+	"errors"
+	"sort"
+	"strings"
+
+	"github.com/mreym/shopping/models"
+)
+
+var (
+	ErrMethodUnavailable = errors.New("this shipping method is not available for the cart")
+	ErrUnserviceable     = errors.New("the cart cannot be shipped to this address")
+)
+
+// Option is a way the cart can be shipped and what it costs.
+type Option struct {
+	Method        string       `json:"method"`
+	Zone          string       `json:"zone"`
+	Cost          models.Money `json:"cost"`
+	Delivery_Days int          `json:"delivery_days"`
+}
+
+var methodOrder = map[string]int{
+	models.ShippingStandard: 0,
+	models.ShippingExpress:  1,
+	models.ShippingPickup:   2,
+}
+
+// Check validates a rate table row, for admins creating one.
+func Check(rate models.ShippingRate) error {
+	if _, ok := methodOrder[rate.Method]; !ok {
+		return errors.New("method must be standard, express or pickup")
+	}
+	if rate.Max_Weight_Grams < 0 || rate.Delivery_Days < 0 {
+		return errors.New("weight and delivery days cannot be negative")
+	}
+	if rate.Price.IsNegative() {
+		return errors.New("price cannot be negative")
+	}
+	if rate.Price.Currency != models.DefaultCurrency {
+		return errors.New("price must be in " + models.DefaultCurrency)
+	}
+	return nil
+}
+
+// CartWeight is the total weight of the cart lines in grams.
+func CartWeight(lines []models.ProductUser) int {
+	weight := 0
+	for _, line := range lines {
+		weight += line.Weight_Grams
+	}
+	return weight
+}
+
+// zoneMatch is the length of the longest prefix of the rate matching the
+// pincode, 0 for a rate that covers every pincode, or -1 for no match.
+func zoneMatch(rate models.ShippingRate, pincode string) int {
+	if len(rate.Pincode_Prefixes) == 0 {
+		return 0
+	}
+	best := -1
+	for _, prefix := range rate.Pincode_Prefixes {
+		if pincode != "" && strings.HasPrefix(pincode, prefix) && len(prefix) > best {
+			best = len(prefix)
+		}
+	}
+	return best
+}
+
+// Options lists each method that can ship a parcel of weight grams to the
+// pincode. Per method the most specific zone is used, and within it the
+// smallest weight bracket the parcel fits in.
+func Options(rates []models.ShippingRate, weight int, pincode string) []Option {
+	pincode = strings.ReplaceAll(pincode, " ", "")
+
+	type pick struct {
+		rate  models.ShippingRate
+		match int
+	}
+	best := make(map[string]pick)
+	for _, rate := range rates {
+		match := zoneMatch(rate, pincode)
+		if match < 0 || (rate.Max_Weight_Grams > 0 && weight > rate.Max_Weight_Grams) {
+			continue
+		}
+		current, ok := best[rate.Method]
+		if ok && (match < current.match || (match == current.match && !bracketBelow(rate, current.rate))) {
+			continue
+		}
+		best[rate.Method] = pick{rate: rate, match: match}
+	}
+
+	options := make([]Option, 0, len(best))
+	for method, p := range best {
+		options = append(options, Option{
+			Method:        method,
+			Zone:          p.rate.Zone,
+			Cost:          p.rate.Price,
+			Delivery_Days: p.rate.Delivery_Days,
+		})
+	}
+	sort.Slice(options, func(i, j int) bool { return methodOrder[options[i].Method] < methodOrder[options[j].Method] })
+	return options
+}
+
+// bracketBelow reports whether a has a tighter weight limit than b.
+func bracketBelow(a, b models.ShippingRate) bool {
+	if a.Max_Weight_Grams == 0 {
+		return false
+	}
+	return b.Max_Weight_Grams == 0 || a.Max_Weight_Grams < b.Max_Weight_Grams
+}
+
+// Choose picks the option for method. An empty method falls back to the
+// first available in standard, express, pickup order. configured tells
+// whether the shop has any rates at all: without any, a nil option with no
+// error means the shop doesn't charge for shipping, but with some, a cart no
+// option covers can't be shipped.
+func Choose(options []Option, method string, configured bool) (*Option, error) {
+	if method == "" {
+		if len(options) > 0 {
+			return &options[0], nil
+		}
+		if configured {
+			return nil, ErrUnserviceable
+		}
+		return nil, nil
+	}
+	for i := range options {
+		if options[i].Method == method {
+			return &options[i], nil
+		}
+	}
+	return nil, ErrMethodUnavailable
+}
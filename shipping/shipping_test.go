@@ -0,0 +1,104 @@
+package shipping
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/mreym/shopping/models"
+)
+
+func inr(amount int64) models.Money {
+	return models.NewMoney(amount, "INR")
+}
+
+func TestOptions(t *testing.T) {
+	rates := []models.ShippingRate{
+		{Method: models.ShippingStandard, Zone: "India", Max_Weight_Grams: 5000, Price: inr(9000)},
+		{Method: models.ShippingStandard, Zone: "India", Max_Weight_Grams: 1000, Price: inr(5000)},
+		{Method: models.ShippingStandard, Zone: "India", Price: inr(15000)},
+		{Method: models.ShippingStandard, Zone: "Metro", Pincode_Prefixes: []string{"11", "40"}, Max_Weight_Grams: 1000, Price: inr(3000)},
+		{Method: models.ShippingExpress, Zone: "Delhi", Pincode_Prefixes: []string{"110"}, Price: inr(10000)},
+		{Method: models.ShippingPickup, Zone: "Store", Pincode_Prefixes: []string{"560"}, Price: inr(0)},
+	}
+	tests := []struct {
+		name    string
+		weight  int
+		pincode string
+		want    []string
+	}{
+		{"most specific zone", 500, "110001", []string{"standard Metro 3000", "express Delhi 10000"}},
+		{"too heavy for the zone", 2000, "110001", []string{"standard India 9000", "express Delhi 10000"}},
+		{"smallest bracket that fits", 800, "700001", []string{"standard India 5000"}},
+		{"no weight limit", 10000, "400001", []string{"standard India 15000"}},
+		{"spaces in the pincode", 500, "560 001", []string{"standard India 5000", "pickup Store 0"}},
+		{"no pincode", 500, "", []string{"standard India 5000"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, o := range Options(rates, tt.weight, tt.pincode) {
+				got = append(got, fmt.Sprintf("%s %s %d", o.Method, o.Zone, o.Cost.Amount))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Options() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestChoose(t *testing.T) {
+	options := []Option{
+		{Method: models.ShippingStandard, Cost: inr(5000)},
+		{Method: models.ShippingExpress, Cost: inr(10000)},
+	}
+	tests := []struct {
+		name       string
+		options    []Option
+		method     string
+		configured bool
+		want       string
+		err        error
+	}{
+		{"asked for", options, models.ShippingExpress, true, models.ShippingExpress, nil},
+		{"first by default", options, "", true, models.ShippingStandard, nil},
+		{"not offered", options, models.ShippingPickup, true, "", ErrMethodUnavailable},
+		{"nothing covers the cart", nil, "", true, "", ErrUnserviceable},
+		{"no rates set up", nil, "", false, "", nil},
+		{"no rates set up but a method asked for", nil, models.ShippingExpress, false, "", ErrMethodUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Choose(tt.options, tt.method, tt.configured)
+			method := ""
+			if got != nil {
+				method = got.Method
+			}
+			if err != tt.err || method != tt.want {
+				t.Errorf("Choose() = %v, %v, want %v, %v", method, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    models.ShippingRate
+		wantErr bool
+	}{
+		{"valid", models.ShippingRate{Method: models.ShippingStandard, Price: inr(5000)}, false},
+		{"free", models.ShippingRate{Method: models.ShippingPickup, Price: inr(0)}, false},
+		{"unknown method", models.ShippingRate{Method: "drone", Price: inr(5000)}, true},
+		{"negative weight", models.ShippingRate{Method: models.ShippingStandard, Max_Weight_Grams: -1, Price: inr(5000)}, true},
+		{"negative price", models.ShippingRate{Method: models.ShippingStandard, Price: inr(-1)}, true},
+		{"other currency", models.ShippingRate{Method: models.ShippingStandard, Price: models.NewMoney(500, "USD")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check(tt.rate); (err != nil) != tt.wantErr {
+				t.Errorf("Check() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
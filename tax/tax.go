@@ -0,0 +1,165 @@
+package tax
+
+import (
+	"errors"
+	"math/big"
+	"strings"
+
+	"github.com/mreym/shopping/models"
+)
+
+// Region is where an order ships to, as far as tax rates are concerned.
+type Region struct {
+	Pincode string
+	City    string
+}
+
+func RegionOf(address *models.Address) Region {
+	var region Region
+	if address == nil {
+		return region
+	}
+	if address.Pincode != nil {
+		region.Pincode = strings.ReplaceAll(*address.Pincode, " ", "")
+	}
+	if address.City != nil {
+		region.City = strings.TrimSpace(*address.City)
+	}
+	return region
+}
+
+// Check validates a tax rate definition, for admins creating one.
+func Check(rate models.TaxRate) error {
+	if strings.TrimSpace(rate.Name) == "" {
+		return errors.New("tax rate needs a name")
+	}
+	if rate.Rate < 0 || rate.Rate > 10000 {
+		return errors.New("rate must be between 0 and 10000 basis points")
+	}
+	return nil
+}
+
+// specificity ranks how closely a rate matches the region: the longest
+// pincode prefix wins, then a city match, then a rate that applies everywhere.
+// It returns -1 when the rate doesn't apply to the region at all.
+func specificity(rate models.TaxRate, region Region) int {
+	if rate.Pincode_Prefix != "" {
+		if !strings.HasPrefix(region.Pincode, rate.Pincode_Prefix) {
+			return -1
+		}
+		return 2 + len(rate.Pincode_Prefix)
+	}
+	if rate.City != "" {
+		if !strings.EqualFold(rate.City, region.City) {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
+
+// Match finds the rate for a tax class in a region, or nil if untaxed.
+func Match(rates []models.TaxRate, class string, region Region) *models.TaxRate {
+	var best *models.TaxRate
+	bestScore := -1
+	for i, rate := range rates {
+		if rate.Tax_Class != class {
+			continue
+		}
+		if score := specificity(rate, region); score > bestScore {
+			best, bestScore = &rates[i], score
+		}
+	}
+	return best
+}
+
+// allocate splits discount across the lines in proportion to their price.
+// The last line takes the rounding remainder so the shares add up exactly.
+func allocate(lines []models.ProductUser, subtotal, discount models.Money) ([]models.Money, error) {
+	shares := make([]models.Money, len(lines))
+	left := discount
+	for i, line := range lines {
+		if i == len(lines)-1 || subtotal.Amount == 0 {
+			shares[i] = left
+			left = models.ZeroMoney(discount.Currency)
+			continue
+		}
+		share, err := discount.MulRat(big.NewRat(line.Price.Amount, subtotal.Amount))
+		if err != nil {
+			return nil, err
+		}
+		if shares[i], err = share.Min(left); err != nil {
+			return nil, err
+		}
+		if left, err = left.Sub(shares[i]); err != nil {
+			return nil, err
+		}
+	}
+	return shares, nil
+}
+
+// Calculate works out the tax on each line after its share of the discount.
+// With inclusive prices the tax is the part of the price that is tax; with
+// exclusive prices it is charged on top. It returns the lines and their total.
+func Calculate(lines []models.ProductUser, discount models.Money, rates []models.TaxRate, region Region, inclusive bool) ([]models.TaxLine, models.Money, error) {
+	taxLines := make([]models.TaxLine, 0, len(lines))
+	if len(lines) == 0 {
+		return taxLines, models.ZeroMoney(discount.Currency), nil
+	}
+
+	subtotal := models.ZeroMoney(lines[0].Price.Currency)
+	for _, line := range lines {
+		var err error
+		if subtotal, err = subtotal.Add(line.Price); err != nil {
+			return nil, models.Money{}, err
+		}
+	}
+	total := models.ZeroMoney(subtotal.Currency)
+
+	shares, err := allocate(lines, subtotal, discount)
+	if err != nil {
+		return nil, models.Money{}, err
+	}
+
+	for i, line := range lines {
+		class := ""
+		if line.Tax_Class != nil {
+			class = *line.Tax_Class
+		}
+		rate := Match(rates, class, region)
+		if rate == nil || rate.Rate == 0 {
+			continue
+		}
+
+		net, err := line.Price.Sub(shares[i])
+		if err != nil {
+			return nil, models.Money{}, err
+		}
+
+		var amount models.Money
+		if inclusive {
+			amount, err = net.MulRat(big.NewRat(rate.Rate, 10000+rate.Rate))
+			if err == nil {
+				net, err = net.Sub(amount)
+			}
+		} else {
+			amount, err = net.Percent(rate.Rate)
+		}
+		if err != nil {
+			return nil, models.Money{}, err
+		}
+
+		taxLines = append(taxLines, models.TaxLine{
+			Product_ID: line.Product_ID,
+			Tax_Class:  class,
+			Rate_Name:  rate.Name,
+			Rate:       rate.Rate,
+			Taxable:    net,
+			Tax:        amount,
+		})
+		if total, err = total.Add(amount); err != nil {
+			return nil, models.Money{}, err
+		}
+	}
+	return taxLines, total, nil
+}
@@ -0,0 +1,81 @@
+package tax
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"github.com/mreym/shopping/models"
+)
+
+func inr(amount int64) models.Money {
+	return models.NewMoney(amount, "INR")
+}
+
+func line(class string, price int64) models.ProductUser {
+	return models.ProductUser{Product_ID: primitive.NewObjectID(), Tax_Class: &class, Price: inr(price)}
+}
+
+func TestCalculate(t *testing.T) {
+	rates := []models.TaxRate{
+		{Name: "GST", Tax_Class: "standard", Rate: 1800},
+		{Name: "Karnataka", Tax_Class: "standard", Pincode_Prefix: "56", Rate: 1200},
+		{Name: "Mumbai", Tax_Class: "standard", City: "Mumbai", Rate: 2800},
+		{Name: "Food", Tax_Class: "food", Rate: 500},
+		{Name: "Exempt", Tax_Class: "books", Rate: 0},
+	}
+	delhi := Region{Pincode: "110001", City: "Delhi"}
+	tests := []struct {
+		name      string
+		lines     []models.ProductUser
+		discount  models.Money
+		region    Region
+		inclusive bool
+		taxes     []int64
+		total     models.Money
+	}{
+		{"exclusive", []models.ProductUser{line("standard", 10000)}, inr(0), delhi, false, []int64{1800}, inr(1800)},
+		{"inclusive", []models.ProductUser{line("standard", 11800)}, inr(0), delhi, true, []int64{1800}, inr(1800)},
+		{"rounds to the nearest paisa", []models.ProductUser{line("standard", 999)}, inr(0), delhi, false, []int64{180}, inr(180)},
+		{"discount shared by price", []models.ProductUser{line("standard", 10000), line("food", 10000)}, inr(2000), delhi, false, []int64{1620, 450}, inr(2070)},
+		{"pincode prefix beats city", []models.ProductUser{line("standard", 10000)}, inr(0), Region{Pincode: "560001", City: "Mumbai"}, false, []int64{1200}, inr(1200)},
+		{"city beats everywhere", []models.ProductUser{line("standard", 10000)}, inr(0), Region{Pincode: "400001", City: "mumbai"}, false, []int64{2800}, inr(2800)},
+		{"zero rate", []models.ProductUser{line("books", 10000)}, inr(0), delhi, false, nil, inr(0)},
+		{"no rate for the class", []models.ProductUser{line("toys", 10000)}, inr(0), delhi, false, nil, inr(0)},
+		{"no lines", nil, inr(0), delhi, false, nil, inr(0)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, total, err := Calculate(tt.lines, tt.discount, rates, tt.region, tt.inclusive)
+			var taxes []int64
+			for _, l := range lines {
+				taxes = append(taxes, l.Tax.Amount)
+			}
+			if err != nil || !reflect.DeepEqual(taxes, tt.taxes) || total != tt.total {
+				t.Errorf("Calculate() = %v, %v, %v, want %v, %v", taxes, total, err, tt.taxes, tt.total)
+			}
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		rate    models.TaxRate
+		wantErr bool
+	}{
+		{"valid", models.TaxRate{Name: "GST", Rate: 1800}, false},
+		{"zero", models.TaxRate{Name: "Exempt"}, false},
+		{"no name", models.TaxRate{Name: " ", Rate: 1800}, true},
+		{"negative", models.TaxRate{Name: "GST", Rate: -1}, true},
+		{"over 100%", models.TaxRate{Name: "GST", Rate: 10001}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Check(tt.rate); (err != nil) != tt.wantErr {
+				t.Errorf("Check() = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package tokens
+
+import (
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// CartAudience marks guest cart tokens so they can't be used to sign in.
+const CartAudience = "guest-cart"
+
+// CartTokenLifetime is how long a guest cart survives without a login.
+const CartTokenLifetime = 30 * 24 * time.Hour
+
+type CartClaims struct {
+	Cart_ID string
+	jwt.StandardClaims
+}
+
+func GenerateCartToken(cartID string, expiresAt time.Time) (string, error) {
+	claims := &CartClaims{
+		Cart_ID: cartID,
+		StandardClaims: jwt.StandardClaims{
+			Audience:  CartAudience,
+			ExpiresAt: expiresAt.Unix(),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(SECRET_KEY))
+}
+
+func ValidateCartToken(signedtoken string) (claims *CartClaims, msg string) {
+	token, err := jwt.ParseWithClaims(signedtoken, &CartClaims{}, func(t *jwt.Token) (interface{}, error) {
+		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, jwt.ErrSignatureInvalid
+		}
+		return []byte(SECRET_KEY), nil
+	})
+	if err != nil {
+		msg = err.Error()
+		return
+	}
+
+	claims, ok := token.Claims.(*CartClaims)
+	if !ok || claims.Audience != CartAudience || claims.Cart_ID == "" {
+		msg = "the cart token is invalid"
+		return
+	}
+	return claims, msg
+}
@@ -0,0 +1,31 @@
+package tokens
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// CheckSession makes sure the token's session hasn't been signed out since
+// it was issued, as happens when the password is reset.
+func CheckSession(ctx context.Context, claims *SignedDetails) (msg string) {
+	var user struct {
+		Session_Version int `bson:"session_version"`
+	}
+	opts := options.FindOne().SetProjection(bson.D{{Key: "session_version", Value: 1}})
+	err := UserData.FindOne(ctx, bson.M{"user_id": claims.Uid}, opts).Decode(&user)
+	if err == mongo.ErrNoDocuments {
+		return "the user no longer exists"
+	}
+	if err != nil {
+		log.Println(err)
+		return "cannot check the session"
+	}
+	if user.Session_Version != claims.Session {
+		return "the session has been signed out, please sign in again"
+	}
+	return ""
+}
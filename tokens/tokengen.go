@@ -20,6 +20,9 @@ type SignedDetails struct {
 	First_Name string
 	Last_Name  string
 	Uid        string
+	// Session is the user's session version when the token was issued;
+	// bumping the version signs out every token issued before.
+	Session int
 	jwt.StandardClaims
 }
 
@@ -31,13 +34,14 @@ func init() {
 	UserData = database.UserData(database.Client, "Users")
 }
 
-func GenerateTokens(email string, firstname string, lastname string, uid string) (signedtoken string, singnedrefreshtoken string, err error) {
+func GenerateTokens(email string, firstname string, lastname string, uid string, session int) (signedtoken string, singnedrefreshtoken string, err error) {
 
 	claims := &SignedDetails{
 		Email:      email,
 		First_Name: firstname,
 		Last_Name:  lastname,
 		Uid:        uid,
+		Session:    session,
 		StandardClaims: jwt.StandardClaims{
 			ExpiresAt: time.Now().Add(time.Hour * 24).Unix(),
 		},
@@ -78,6 +82,10 @@ func ValidateToken(signedtoken string) (claims *SignedDetails, msg string) {
 		msg = "the token is valid"
 		return
 	}
+	if claims.Audience == CartAudience {
+		msg = "a cart token cannot be used to sign in"
+		return
+	}
 	if claims.ExpiresAt < time.Now().Local().Unix() {
 		msg = " toke is already expired"
 		return
@@ -0,0 +1,58 @@
+package webhooks
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// maxBody caps what Receiver reads from a request.
+const maxBody = 1 << 20
+
+// Receiver is a stand-in for a webhook endpoint, for trying deliveries out
+// locally. It checks each request's signature, logs the event and answers
+// 204. FailFirst makes it answer 500 to the first attempts of every
+// delivery, to watch the retries happen.
+type Receiver struct {
+	Secret    string
+	FailFirst int
+
+	mu       sync.Mutex
+	attempts map[string]int
+}
+
+func (r *Receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBody))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	delivery := req.Header.Get(HeaderDelivery)
+	if err = Verify(r.Secret, req.Header, body, time.Now()); err != nil {
+		log.Printf("rejected delivery %s: %v", delivery, err)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	r.mu.Lock()
+	if r.attempts == nil {
+		r.attempts = make(map[string]int)
+	}
+	r.attempts[delivery]++
+	attempt := r.attempts[delivery]
+	r.mu.Unlock()
+
+	if attempt <= r.FailFirst {
+		log.Printf("failing delivery %s on purpose (attempt %d)", delivery, attempt)
+		http.Error(w, "failing on purpose", http.StatusInternalServerError)
+		return
+	}
+	log.Printf("%s delivery %s (attempt %d): %s", req.Header.Get(HeaderEvent), delivery, attempt, body)
+	w.WriteHeader(http.StatusNoContent)
+}
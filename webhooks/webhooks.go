@@ -0,0 +1,174 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mreym/shopping/events"
+	"github.com/mreym/shopping/models"
+)
+
+// Headers sent with every delivery.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Tolerance is how old a delivery's timestamp may be before Verify refuses
+// it, so a captured request can't be replayed later.
+const Tolerance = 5 * time.Minute
+
+// maxResponse is how much of the endpoint's answer is kept with an attempt.
+const maxResponse = 512
+
+// Events are the event types a webhook may subscribe to.
+var Events = []string{
+	events.TypeOrderPlaced,
+	events.TypeOrderCancelled,
+	events.TypeProductUpdated,
+}
+
+var (
+	ErrInvalidURL     = errors.New("the webhook url must be an absolute http or https url")
+	ErrNoEvents       = errors.New("the webhook must subscribe to at least one event")
+	ErrUnknownEvent   = errors.New("unknown event type")
+	ErrBadSignature   = errors.New("the webhook signature does not match")
+	ErrStaleTimestamp = errors.New("the webhook timestamp is missing or too old")
+)
+
+// Check validates the url and event types of a webhook and removes
+// duplicate events.
+func Check(hook *models.Webhook) error {
+	u, err := url.Parse(hook.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrInvalidURL
+	}
+	if len(hook.Events) == 0 {
+		return ErrNoEvents
+	}
+	seen := make(map[string]bool, len(hook.Events))
+	list := make([]string, 0, len(hook.Events))
+	for _, e := range hook.Events {
+		if !Subscribable(e) {
+			return fmt.Errorf("%w: %s", ErrUnknownEvent, e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			list = append(list, e)
+		}
+	}
+	hook.Events = list
+	return nil
+}
+
+func Subscribable(eventType string) bool {
+	for _, e := range Events {
+		if e == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NewSecret makes a random signing secret for a webhook.
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Payload is the JSON body of a delivery. ID is the event's id, the same for
+// every webhook it goes to, so receivers can drop duplicates.
+type Payload struct {
+	ID         string       `json:"id"`
+	Type       string       `json:"type"`
+	Created_At time.Time    `json:"created_at"`
+	Data       events.Event `json:"data"`
+}
+
+func Encode(id string, createdAt time.Time, event events.Event) (string, error) {
+	body, err := json.Marshal(Payload{ID: id, Type: event.Type(), Created_At: createdAt.UTC(), Data: event})
+	if err != nil {
+		return "", err
+	}
+	return string(body), nil
+}
+
+// Sign is the hex HMAC-SHA256, keyed with the secret, of the timestamp, a dot
+// and the body. It is sent as "sha256=<hex>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature headers of a delivery received at now.
+func Verify(secret string, header http.Header, body []byte, now time.Time) error {
+	timestamp, err := strconv.ParseInt(header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return ErrStaleTimestamp
+	}
+	age := now.Sub(time.Unix(timestamp, 0))
+	if age > Tolerance || age < -Tolerance {
+		return ErrStaleTimestamp
+	}
+	if !hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(header.Get(HeaderSignature))) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Send posts a delivery to its webhook once and reports how it went. Any 2xx
+// answer counts as delivered.
+func Send(ctx context.Context, client *http.Client, hook models.Webhook, delivery models.WebhookDelivery) (models.WebhookAttempt, bool) {
+	start := time.Now()
+	attempt := models.WebhookAttempt{At: start}
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shopping-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event_Type)
+	req.Header.Set(HeaderDelivery, delivery.Delivery_ID.Hex())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(start.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(hook.Secret, start.Unix(), body))
+
+	resp, err := client.Do(req)
+	attempt.Duration_MS = time.Since(start).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt, false
+	}
+	defer resp.Body.Close()
+	answer, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponse))
+	attempt.Status_Code = resp.StatusCode
+	attempt.Response = strings.ToValidUTF8(string(answer), "")
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = resp.Status
+		return attempt, false
+	}
+	return attempt, true
+}
@@ -0,0 +1,83 @@
+package webhooks
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		want      string
+	}{
+		{"known signature", "whsec_test", 1700000000, body, "sha256=11bf4466ea17c3df3fd743af0b435368e16b7a05eb8eced85e8c4670767bdec5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Sign(tt.secret, tt.timestamp, tt.body); got != tt.want {
+				t.Errorf("Sign() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	base := Sign("whsec_test", 1700000000, body)
+	changed := []struct {
+		name string
+		got  string
+	}{
+		{"other secret", Sign("whsec_other", 1700000000, body)},
+		{"other timestamp", Sign("whsec_test", 1700000001, body)},
+		{"other body", Sign("whsec_test", 1700000000, []byte(`{"id":"2"}`))},
+	}
+	for _, tt := range changed {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got == base {
+				t.Errorf("Sign() = %v, want it to differ", tt.got)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"id":"1"}`)
+	header := func(timestamp string, signature string) http.Header {
+		h := http.Header{}
+		h.Set(HeaderTimestamp, timestamp)
+		h.Set(HeaderSignature, signature)
+		return h
+	}
+	signed := func(at time.Time) http.Header {
+		return header(strconv.FormatInt(at.Unix(), 10), Sign("whsec_test", at.Unix(), body))
+	}
+	tests := []struct {
+		name   string
+		secret string
+		header http.Header
+		body   []byte
+		err    error
+	}{
+		{"valid", "whsec_test", signed(now), body, nil},
+		{"slightly old", "whsec_test", signed(now.Add(-Tolerance)), body, nil},
+		{"slightly ahead", "whsec_test", signed(now.Add(Tolerance)), body, nil},
+		{"too old", "whsec_test", signed(now.Add(-Tolerance - time.Second)), body, ErrStaleTimestamp},
+		{"too far ahead", "whsec_test", signed(now.Add(Tolerance + time.Second)), body, ErrStaleTimestamp},
+		{"no timestamp", "whsec_test", header("", Sign("whsec_test", now.Unix(), body)), body, ErrStaleTimestamp},
+		{"wrong secret", "whsec_other", signed(now), body, ErrBadSignature},
+		{"body changed", "whsec_test", signed(now), []byte(`{"id":"2"}`), ErrBadSignature},
+		{"no signature", "whsec_test", header(strconv.FormatInt(now.Unix(), 10), ""), body, ErrBadSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := Verify(tt.secret, tt.header, tt.body, now); err != tt.err {
+				t.Errorf("Verify() = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}